@@ -12,3 +12,26 @@ def go_dependencies():
         importpath = "github.com/urfave/cli",
         tag = "v1.20.0",
     )
+
+    # Metrics dependencies for //workflows, fetched as modules so the
+    # contrib/tally submodule of the Temporal SDK resolves on its own
+    go_repository(
+        name = "com_github_prometheus_client_golang",
+        importpath = "github.com/prometheus/client_golang",
+        sum = "h1:+4eQaD7vAZ6DsfsxB15hbE0odUjGI5ARs9yskGu1v4s=",
+        version = "v1.11.1",
+    )
+
+    go_repository(
+        name = "com_github_uber_go_tally_v4",
+        importpath = "github.com/uber-go/tally/v4",
+        sum = "h1:YiKvvMKCCXlCKXI0i1hVk+xda8YxdIpjeFXohpvn8Zo=",
+        version = "v4.1.7",
+    )
+
+    go_repository(
+        name = "io_temporal_sdk_contrib_tally",
+        importpath = "go.temporal.io/sdk/contrib/tally",
+        sum = "h1:XnTJIQcjOv+WuCJ1u8Ve2nq+s2H4i/fys34MnWDRrOo=",
+        version = "v0.2.0",
+    )
@@ -2,21 +2,143 @@ package workflows
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
+// Activities holds the stores and services activities depend on. The
+// activities that need one are its methods, registered from the instance
+// NewActivities builds for a worker; tests build one with fakes.
+type Activities struct {
+	// Cache keeps reusable activity results, such as CVSS scores and
+	// finished scans
+	Cache ActivityCache
+
+	OrderArchive          OrderArchive
+	OrderArchiveRetention time.Duration
+	OrderCheckpoints      OrderCheckpointStore
+
+	SpendingLedger          SpendingLedger
+	CustomerTrust           CustomerTrustStore
+	ChargeLedger            ChargeLedger
+	ChargeGateway           func(ctx context.Context, request PaymentRequest) (*ChargeResult, error)
+	GatewayRateLimitBackoff time.Duration
+	CurrencyMinorUnits      map[string]int // Decimal places per currency code; unlisted ones use two
+	Confirmations           ConfirmationStore
+	DeliverConfirmation     func(ctx context.Context, transactionID string) error
+
+	ScanMetrics           ScanMetricsSink
+	ScanResults           ScanResultStore
+	Baselines             BaselineStore
+	RepoScanSlots         RepoScanSlotStore
+	MaxScansPerRepository int
+	RepoScanSlotLease     time.Duration
+	ListRepoFiles         func(ctx context.Context, repoURL string) ([]string, error)
+	FetchCodeowners       func(ctx context.Context, repoURL string) (string, error)
+	Secrets               SecretStore  // Resolves SecurityScanRequest.AuthSecret
+	ScannerHTTPClient     *http.Client // Scanner and report storage calls
+	DASTTarget            DASTTarget
+	DASTFlapBackoff       time.Duration // Wait after the first transient DAST target failure, doubling after each one
+
+	NotificationLog               NotificationLog
+	NotificationSuppressionWindow time.Duration
+}
+
+// NewActivities returns Activities backed by the production stores and
+// services, with config's worker settings applied
+func NewActivities(config WorkerConfig) *Activities {
+	a := &Activities{
+		Cache:                         newMemoryCache(),
+		OrderArchive:                  coldStorageOrderArchive{},
+		OrderArchiveRetention:         DefaultOrderArchiveRetention,
+		OrderCheckpoints:              orderDBCheckpointStore{},
+		SpendingLedger:                paymentsDBSpendingLedger{},
+		CustomerTrust:                 customersDBTrustStore{},
+		ChargeLedger:                  paymentsDBChargeLedger{},
+		ChargeGateway:                 chargeGateway,
+		GatewayRateLimitBackoff:       DefaultGatewayRateLimitBackoff,
+		CurrencyMinorUnits:            defaultCurrencyMinorUnits,
+		Confirmations:                 notificationsDBConfirmationStore{},
+		DeliverConfirmation:           deliverConfirmation,
+		ScanMetrics:                   warehouseMetricsSink{},
+		ScanResults:                   reportScanResultStore{},
+		Baselines:                     reportBaselineStore{},
+		RepoScanSlots:                 scansDBRepoScanSlots{},
+		MaxScansPerRepository:         DefaultMaxScansPerRepository,
+		RepoScanSlotLease:             DefaultRepoScanSlotLease,
+		ListRepoFiles:                 listRepoFiles,
+		FetchCodeowners:               fetchCodeowners,
+		Secrets:                       secretsManagerStore{},
+		ScannerHTTPClient:             &http.Client{Timeout: time.Minute},
+		DASTTarget:                    deployedDASTTarget{},
+		DASTFlapBackoff:               defaultDASTFlapBackoff,
+		NotificationLog:               notificationsDBNotificationLog{},
+		NotificationSuppressionWindow: DefaultNotificationSuppressionWindow,
+	}
+
+	if config.OrderArchiveRetention > 0 {
+		a.OrderArchiveRetention = config.OrderArchiveRetention
+	}
+	if config.GatewayRateLimitBackoff > 0 {
+		a.GatewayRateLimitBackoff = config.GatewayRateLimitBackoff
+	}
+	if len(config.CurrencyMinorUnits) > 0 {
+		units := make(map[string]int, len(defaultCurrencyMinorUnits)+len(config.CurrencyMinorUnits))
+		for currency, n := range defaultCurrencyMinorUnits {
+			units[currency] = n
+		}
+		for currency, n := range config.CurrencyMinorUnits {
+			units[strings.ToUpper(currency)] = n
+		}
+		a.CurrencyMinorUnits = units
+	}
+	if config.MaxScansPerRepository > 0 {
+		a.MaxScansPerRepository = config.MaxScansPerRepository
+	}
+	if config.RepoScanSlotLease > 0 {
+		a.RepoScanSlotLease = config.RepoScanSlotLease
+	}
+	if config.NotificationSuppressionWindow > 0 {
+		a.NotificationSuppressionWindow = config.NotificationSuppressionWindow
+	}
+	return a
+}
+
+// activities names Activities methods for workflow.ExecuteActivity, e.g.
+// activities.ArchiveOrder. Only the method's name is used, so it stays nil.
+var activities *Activities
+
 // Activity types and results
 
 type InventoryResult struct {
-	Available    bool
-	ReservedAt   time.Time
+	Available     bool
+	ReservedAt    time.Time
+	ReservedUntil time.Time // When the reservation lapses; zero if it doesn't
 	ReservationID string
 }
 
+// inventoryReservationTTL is how long ValidateInventory holds stock for. It
+// outlasts a payment clearance hold so a cleared order can still ship.
+const inventoryReservationTTL = 72 * time.Hour
+
 type ShippingResult struct {
 	TrackingNumber string
 	Carrier        string
+	Cost           float64
 	EstimatedDate  time.Time
 }
 
@@ -27,28 +149,255 @@ type FraudCheckResult struct {
 }
 
 type ChargeResult struct {
-	TransactionID string
-	Amount        float64
-	Currency      string
-	ChargedAt     time.Time
+	TransactionID     string
+	Amount            float64
+	Currency          string
+	PaymentMethodType string // "card", "bank_transfer", "unverified"
+	GatewayCode       string // Gateway response code, e.g. "approved"
+	ChargedAt         time.Time
 }
 
+// GatewayDeclinedError is the application error type ChargePaymentMethodV2
+// returns when the gateway refuses a charge. Its details hold the gateway
+// response code.
+const GatewayDeclinedError = "GatewayDeclinedError"
+
+// GatewayRateLimitedError is the application error type ChargePaymentMethodV2
+// returns when the gateway throttles a charge. It's retried, but only after
+// gatewayRateLimitBackoff so the gateway's limit window can reset.
+const GatewayRateLimitedError = "GatewayRateLimitedError"
+
+// InsufficientFundsError is the non-retryable application error type
+// ChargePaymentMethod returns when the payment method can't cover the amount
+const InsufficientFundsError = "InsufficientFundsError"
+
+// DefaultGatewayRateLimitBackoff is the wait before retrying a rate-limited
+// charge, well above PaymentWorkflowV2's normal retry interval
+const DefaultGatewayRateLimitBackoff = time.Minute
+
 type ScanTypeResult struct {
 	ScanType        string
 	Vulnerabilities []Vulnerability
 	Duration        time.Duration
+	RuleSetVersion  string // Rule set the scanner ran with, when it uses one
+	FilesScanned    int    // Source files or manifests the scanner read; zero for DAST
+	SBOMURL         string // Dependency scans only; the CycloneDX SBOM of the resolved dependencies
+}
+
+// CustomRulesUnavailableError is the application error type RunSASTScan
+// returns when a request's custom rules can't be loaded
+const CustomRulesUnavailableError = "CustomRulesUnavailable"
+
+// UnknownReportFormatError is the application error type for a report
+// format GenerateSecurityReport can't produce
+const UnknownReportFormatError = "UnknownReportFormat"
+
+// UnknownAdvisorySourceError is the application error type RunDependencyScan
+// returns for an AdvisorySource it doesn't know
+const UnknownAdvisorySourceError = "UnknownAdvisorySource"
+
+// DASTTargetUnavailableError is the application error type RunDASTScan
+// returns once the target has failed transiently more often than the
+// request's DASTFlappingTolerance
+const DASTTargetUnavailableError = "DASTTargetUnavailable"
+
+// DefaultAdvisorySource is used when a request doesn't name one
+const DefaultAdvisorySource = "github"
+
+// advisorySeverities holds each advisory database's severity per CVE. The
+// same CVE is often rated differently by GitHub, OSV and NVD.
+var advisorySeverities = map[string]map[string]string{
+	"github": {"CVE-2023-12345": "medium"},
+	"osv":    {"CVE-2023-12345": "high"},
+	"nvd":    {"CVE-2023-12345": "critical"},
+}
+
+// builtinSASTRuleSet is the rule set version bundled with the SAST engine
+const builtinSASTRuleSet = "builtin-2024.1"
+
+// SBOMResult locates a generated software bill of materials
+type SBOMResult struct {
+	Format string // "cyclonedx-json"
+	URL    string
 }
 
 type ReportResult struct {
-	ReportID string
-	URL      string
+	ReportID    string
+	URL         string
+	ContentType string // MIME type of the report at URL, per its ReportFormat
+}
+
+const (
+	ReportFormatJSON  = "json"
+	ReportFormatSARIF = "sarif" // SARIF 2.1.0, as GitHub code scanning consumes
+	ReportFormatHTML  = "html"
+)
+
+// reportContentTypes maps each report format to its MIME type
+var reportContentTypes = map[string]string{
+	ReportFormatJSON:  "application/json",
+	ReportFormatSARIF: "application/sarif+json",
+	ReportFormatHTML:  "text/html",
 }
 
 type NotificationRequest struct {
-	Type    string
-	Count   int
-	ScanID  string
-	AgentID string
+	Type     string
+	Count    int
+	ScanID   string
+	AgentID  string
+	DedupKey string // Notifications sharing a key are sent at most once per suppression window
+}
+
+// RepoScanConfig is a repository's default scan profile, applied when a
+// request doesn't specify its own settings. The thresholds mean the same as
+// the SecurityScanRequest fields of the same name; zero leaves them unset.
+type RepoScanConfig struct {
+	RepositoryURL    string
+	ScanTypes        []string
+	FailOnSeverity   string
+	MinFilesScanned  int
+	MaxTotalFindings int
+}
+
+// ScanMetricsRecord is the flattened per-scan row loaded into the
+// security analytics warehouse
+type ScanMetricsRecord struct {
+	ScanID          string
+	RepositoryURL   string
+	CommitSHA       string
+	Status          string
+	CriticalCount   int
+	HighCount       int
+	MediumCount     int
+	LowCount        int
+	DurationSeconds float64
+	CompletedAt     time.Time
+}
+
+// ScanMetricsSink is where ExportScanMetrics writes records
+type ScanMetricsSink interface {
+	Write(ctx context.Context, record ScanMetricsRecord) error
+}
+
+type warehouseMetricsSink struct{}
+
+func (warehouseMetricsSink) Write(ctx context.Context, record ScanMetricsRecord) error {
+	// Simulated warehouse load - would stream the row to the analytics pipeline
+	activity.GetLogger(ctx).Info("Exported scan metrics", "scanID", record.ScanID, "repo", record.RepositoryURL)
+	return nil
+}
+
+// ScanResultStore is where completed scan results are kept
+type ScanResultStore interface {
+	ListCompletedBefore(ctx context.Context, cutoff time.Time) ([]string, error)
+	Delete(ctx context.Context, scanIDs []string) error
+}
+
+type reportScanResultStore struct{}
+
+func (reportScanResultStore) ListCompletedBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	// Simulated query - would list report IDs completed before cutoff
+	return nil, nil
+}
+
+func (reportScanResultStore) Delete(ctx context.Context, scanIDs []string) error {
+	// Simulated delete - would remove the reports and their findings
+	activity.GetLogger(ctx).Info("Deleted scan results", "count", len(scanIDs))
+	return nil
+}
+
+// ScanBaseline is the commit a branch's scans are diffed against, with the
+// findings it was accepted with
+type ScanBaseline struct {
+	RepositoryURL   string
+	Branch          string
+	CommitSHA       string
+	Vulnerabilities []Vulnerability
+}
+
+// BaselineStore keeps each branch's scan baseline
+type BaselineStore interface {
+	Save(ctx context.Context, baseline ScanBaseline) error
+}
+
+type reportBaselineStore struct{}
+
+func (reportBaselineStore) Save(ctx context.Context, baseline ScanBaseline) error {
+	// Simulated upsert - would replace the branch's baseline row
+	activity.GetLogger(ctx).Info("Updated scan baseline",
+		"repo", baseline.RepositoryURL,
+		"branch", baseline.Branch,
+		"commit", baseline.CommitSHA)
+	return nil
+}
+
+// ConcurrencyResult reports whether a repository has a free scan slot
+type ConcurrencyResult struct {
+	Allowed     bool
+	ActiveScans int
+	Limit       int
+}
+
+// DefaultMaxScansPerRepository caps concurrent scans of one repository
+// unless WorkerConfig.MaxScansPerRepository overrides it
+const DefaultMaxScansPerRepository = 2
+
+// DefaultRepoScanSlotLease is how long a repository scan slot is held
+// unless WorkerConfig.RepoScanSlotLease overrides it. It outlasts a scan's
+// 30-minute scanners and retry rounds, so only a scan that died without
+// releasing its slot runs it out.
+const DefaultRepoScanSlotLease = 2 * time.Hour
+
+// RepoScanSlotStore holds repository scan slots where every security worker
+// sees them. Each slot is a lease held by one scan's workflow ID.
+type RepoScanSlotStore interface {
+	// Acquire takes a slot on repoURL for holder unless limit unexpired
+	// leases are held by others. A holder that already has a slot gets it
+	// back with its lease renewed, so a retried Acquire never takes two.
+	Acquire(ctx context.Context, repoURL, holder string, limit int, lease time.Duration) (ConcurrencyResult, error)
+	// Release frees holder's slot on repoURL. Releasing a slot that was
+	// never taken or already expired does nothing.
+	Release(ctx context.Context, repoURL, holder string) error
+}
+
+type scansDBRepoScanSlots struct{}
+
+func (scansDBRepoScanSlots) Acquire(ctx context.Context, repoURL, holder string, limit int, lease time.Duration) (ConcurrencyResult, error) {
+	// Simulated transaction - would lock the repo's slot rows, delete
+	// expired leases, then renew holder's row or insert one while fewer
+	// than limit remain
+	return ConcurrencyResult{Allowed: true, ActiveScans: 1, Limit: limit}, nil
+}
+
+func (scansDBRepoScanSlots) Release(ctx context.Context, repoURL, holder string) error {
+	// Simulated delete - would remove holder's slot row for the repo
+	return nil
+}
+
+// DefaultNotificationSuppressionWindow is how long a sent notification
+// suppresses identical ones unless WorkerConfig overrides it
+const DefaultNotificationSuppressionWindow = time.Hour
+
+// NotificationLog records when notifications were sent, shared by every
+// security worker
+type NotificationLog interface {
+	// SentSince reports whether a notification with key was sent at or
+	// after since
+	SentSince(ctx context.Context, key string, since time.Time) (bool, error)
+	MarkSent(ctx context.Context, key string, at time.Time) error
+}
+
+type notificationsDBNotificationLog struct{}
+
+func (notificationsDBNotificationLog) SentSince(ctx context.Context, key string, since time.Time) (bool, error) {
+	// Simulated lookup - would read the key's last send time from the
+	// notifications database
+	return false, nil
+}
+
+func (notificationsDBNotificationLog) MarkSent(ctx context.Context, key string, at time.Time) error {
+	// Simulated upsert - would store at as the key's last send time
+	return nil
 }
 
 // Order Activities
@@ -56,19 +405,30 @@ type NotificationRequest struct {
 func ValidateInventory(ctx context.Context, items []OrderItem) (*InventoryResult, error) {
 	// Simulated inventory check
 	// In production, this would call the inventory service
+	now := time.Now()
 	return &InventoryResult{
 		Available:     true,
-		ReservedAt:    time.Now(),
-		ReservationID: fmt.Sprintf("RES-%d", time.Now().UnixNano()),
+		ReservedAt:    now,
+		ReservedUntil: now.Add(inventoryReservationTTL),
+		ReservationID: fmt.Sprintf("RES-%d", now.UnixNano()),
 	}, nil
 }
 
-func GenerateShippingLabel(ctx context.Context, orderID string) (*ShippingResult, error) {
+// GenerateShippingLabel buys a label for items from the carrier strategy
+// picks, per selectCarrier
+func GenerateShippingLabel(ctx context.Context, orderID string, items []OrderItem, strategy string) (*ShippingResult, error) {
+	quote, ok := selectCarrier(quoteCarriers(items), strategy)
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unknown carrier strategy %q", strategy), UnknownCarrierStrategyError, nil)
+	}
+
 	// Simulated shipping label generation
 	return &ShippingResult{
 		TrackingNumber: fmt.Sprintf("TRK-%s-%d", orderID, time.Now().Unix()),
-		Carrier:        "FastShip",
-		EstimatedDate:  time.Now().AddDate(0, 0, 5),
+		Carrier:        quote.Carrier,
+		Cost:           quote.Cost,
+		EstimatedDate:  time.Now().AddDate(0, 0, quote.TransitDays),
 	}, nil
 }
 
@@ -77,6 +437,151 @@ func RefundPayment(ctx context.Context, transactionID string) error {
 	return nil
 }
 
+// GetRefundableAmount returns what's left of a charge after earlier refunds
+func GetRefundableAmount(ctx context.Context, transactionID string) (float64, error) {
+	// Simulated lookup - would read the charge and its refunds from the payments DB
+	return 100.00, nil
+}
+
+func RefundPaymentPartial(ctx context.Context, transactionID string, amount float64) (*RefundResult, error) {
+	// Simulated partial refund - would call payment gateway
+	return &RefundResult{
+		RefundID: fmt.Sprintf("RFD-%d", time.Now().UnixNano()),
+		Amount:   amount,
+	}, nil
+}
+
+func ReleaseInventory(ctx context.Context, reservationID string) error {
+	// Simulated release of a ValidateInventory reservation
+	return nil
+}
+
+func AuthorizePayment(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
+	// Simulated authorization hold - funds are reserved but not taken
+	return &ChargeResult{
+		TransactionID:     fmt.Sprintf("AUTH-%d", time.Now().UnixNano()),
+		Amount:            request.Amount,
+		Currency:          request.Currency,
+		PaymentMethodType: "card",
+	}, nil
+}
+
+// CapturePayment takes amount from an authorization hold. An authorization
+// can be captured in several parts, e.g. one per shipment.
+func CapturePayment(ctx context.Context, authorizationID string, amount float64) (*ChargeResult, error) {
+	// Simulated capture of an authorization hold - would call payment gateway
+	return &ChargeResult{
+		TransactionID: fmt.Sprintf("TXN-%d", time.Now().UnixNano()),
+		Amount:        amount,
+		ChargedAt:     time.Now(),
+	}, nil
+}
+
+func VoidPayment(ctx context.Context, authorizationID string) error {
+	// Simulated void - releases an authorization hold without charging
+	return nil
+}
+
+func PersistOrderAudit(ctx context.Context, orderID string, events []OrderEvent) error {
+	// Writes the order timeline to the audit store used for dispute resolution
+	activity.GetLogger(ctx).Info("Persisted order audit", "orderID", orderID, "events", len(events))
+	return nil
+}
+
+// ArchivedOrder is a finished order's final result as kept in the archive
+type ArchivedOrder struct {
+	Result      OrderResult
+	ArchivedAt  time.Time
+	RetainUntil time.Time // When the record may be purged
+}
+
+// OrderArchive is long-term storage for finished orders, kept independently
+// of the namespace's workflow history retention
+type OrderArchive interface {
+	Put(ctx context.Context, order ArchivedOrder) error
+}
+
+type coldStorageOrderArchive struct{}
+
+func (coldStorageOrderArchive) Put(ctx context.Context, order ArchivedOrder) error {
+	// Simulated write - would store a write-once object expiring at RetainUntil
+	activity.GetLogger(ctx).Info("Archived order", "orderID", order.Result.OrderID, "retainUntil", order.RetainUntil)
+	return nil
+}
+
+// DefaultOrderArchiveRetention is how long archived orders are kept when
+// WorkerConfig.OrderArchiveRetention is zero, seven years for financial records
+const DefaultOrderArchiveRetention = 7 * 365 * 24 * time.Hour
+
+// ArchiveOrder writes an order's final result to the archive, retained for
+// OrderArchiveRetention
+func (a *Activities) ArchiveOrder(ctx context.Context, result OrderResult) error {
+	now := time.Now()
+	return a.OrderArchive.Put(ctx, ArchivedOrder{
+		Result:      result,
+		ArchivedAt:  now,
+		RetainUntil: now.Add(a.OrderArchiveRetention),
+	})
+}
+
+// WebhookDeadLetter is an undeliverable webhook, kept so it can be replayed
+type WebhookDeadLetter struct {
+	URL      string
+	Payload  OrderWebhook
+	Error    string // Last delivery error
+	Attempts int32
+	FailedAt time.Time
+}
+
+func SendOrderWebhook(ctx context.Context, url string, payload OrderWebhook) error {
+	// Simulated POST of the JSON payload to the partner's callback URL
+	activity.GetLogger(ctx).Info("Sent order webhook", "orderID", payload.OrderID, "url", url)
+	return nil
+}
+
+func RecordWebhookDeadLetter(ctx context.Context, deadLetter WebhookDeadLetter) error {
+	// Simulated insert into the webhook dead letter table replay tooling reads
+	activity.GetLogger(ctx).Warn("Dead-lettered order webhook", "orderID", deadLetter.Payload.OrderID, "url", deadLetter.URL)
+	return nil
+}
+
+// OrderCheckpointStore keeps OrderCheckpoints outside workflow history
+type OrderCheckpointStore interface {
+	Get(ctx context.Context, orderID string) (OrderCheckpoint, error)
+	Save(ctx context.Context, checkpoint OrderCheckpoint) error
+}
+
+type orderDBCheckpointStore struct{}
+
+func (orderDBCheckpointStore) Get(ctx context.Context, orderID string) (OrderCheckpoint, error) {
+	// Simulated lookup - would read the order's checkpoint row
+	return OrderCheckpoint{OrderID: orderID}, nil
+}
+
+func (orderDBCheckpointStore) Save(ctx context.Context, checkpoint OrderCheckpoint) error {
+	// Simulated upsert - would write the order's checkpoint row
+	return nil
+}
+
+func (a *Activities) GetOrderCheckpoint(ctx context.Context, orderID string) (*OrderCheckpoint, error) {
+	checkpoint, err := a.OrderCheckpoints.Get(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (a *Activities) SaveOrderCheckpoint(ctx context.Context, checkpoint OrderCheckpoint) error {
+	return a.OrderCheckpoints.Save(ctx, checkpoint)
+}
+
+// Shared Activities
+
+func EvaluateFeatureFlag(ctx context.Context, flag string, key string) (bool, error) {
+	// Looks the flag up in the feature flag service, bucketing rollouts by key
+	return false, nil
+}
+
 // Payment Activities
 
 func CheckFraud(ctx context.Context, request PaymentRequest) (*FraudCheckResult, error) {
@@ -89,13 +594,90 @@ func CheckFraud(ctx context.Context, request PaymentRequest) (*FraudCheckResult,
 	}, nil
 }
 
+// MaxTransactionsPerHour is the transaction rate above which CheckFraudV2
+// treats a customer as exceeding their velocity limit
+const MaxTransactionsPerHour = 5
+
+// velocityRiskPenalty is added to the risk score of a payment over the
+// velocity limit. It's enough on its own to pass the V2 threshold.
+const velocityRiskPenalty = 0.7
+
 func CheckFraudV2(ctx context.Context, request PaymentRequest) (*FraudCheckResult, error) {
 	// Enhanced fraud detection with velocity checks
-	return &FraudCheckResult{
+	result := &FraudCheckResult{
 		RiskScore: 0.12,
 		Flags:     []string{},
 		CheckedAt: time.Now(),
-	}, nil
+	}
+	if velocityExceeded(request.Velocity) {
+		result.RiskScore = math.Min(result.RiskScore+velocityRiskPenalty, 1)
+		result.Flags = append(result.Flags, "VELOCITY_EXCEEDED")
+	}
+	return result, nil
+}
+
+// velocityExceeded reports whether the customer's recent transactions are
+// more than MaxTransactionsPerHour allows over their window
+func velocityExceeded(velocity VelocityContext) bool {
+	window := velocity.Window
+	if window <= 0 {
+		window = time.Hour
+	}
+	return float64(velocity.RecentTransactions) > MaxTransactionsPerHour*window.Hours()
+}
+
+// InvalidFraudRecordError is the non-retryable application error type
+// RecordFraudDecision returns for a record the compliance log would reject
+const InvalidFraudRecordError = "InvalidFraudRecord"
+
+var fraudDecisions = map[string]bool{
+	FraudDecisionApproved:  true,
+	FraudDecisionDeclined:  true,
+	FraudDecisionFlagged:   true,
+	FraudDecisionReview:    true,
+	FraudDecisionChallenge: true,
+}
+
+func RecordFraudDecision(ctx context.Context, request PaymentRequest, result FraudCheckResult, decision string) error {
+	if request.OrderID == "" || !fraudDecisions[decision] {
+		return temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("fraud decision %q for order %q can't be recorded", decision, request.OrderID),
+			InvalidFraudRecordError, nil)
+	}
+	// Appends to the write-once compliance log of fraud decisions
+	activity.GetLogger(ctx).Info("Recorded fraud decision",
+		"orderID", request.OrderID,
+		"customerID", request.CustomerID,
+		"riskScore", result.RiskScore,
+		"decision", decision)
+	return nil
+}
+
+// QueueForReview puts a borderline payment in front of the fraud team, who
+// answer with a FraudReviewDecisionSignal to the payment's workflow
+func QueueForReview(ctx context.Context, request PaymentRequest, result FraudCheckResult) error {
+	// Simulated enqueue - would open a case in the fraud review tool, linked
+	// to this workflow
+	info := activity.GetInfo(ctx)
+	activity.GetLogger(ctx).Info("Queued payment for fraud review",
+		"orderID", request.OrderID,
+		"riskScore", result.RiskScore,
+		"workflowID", info.WorkflowExecution.ID)
+	return nil
+}
+
+// Request3DSChallenge asks the card issuer to put a 3-D Secure challenge
+// to the customer. The checkout answers with a ChallengeResultSignal to the
+// payment's workflow once the customer completes or fails it.
+func Request3DSChallenge(ctx context.Context, request PaymentRequest) error {
+	// Simulated request - would start 3-D Secure authentication with the
+	// gateway, passing this workflow as the callback
+	info := activity.GetInfo(ctx)
+	activity.GetLogger(ctx).Info("Requested 3-D Secure challenge",
+		"orderID", request.OrderID,
+		"customerID", request.CustomerID,
+		"workflowID", info.WorkflowExecution.ID)
+	return nil
 }
 
 func ValidateCard(ctx context.Context, customerID string) (bool, error) {
@@ -103,40 +685,739 @@ func ValidateCard(ctx context.Context, customerID string) (bool, error) {
 	return true, nil
 }
 
+// SpendingLimitCurrency is the currency spending limits, and the spending
+// counted against them, are kept in
+const SpendingLimitCurrency = "USD"
+
+// SpendingLimit caps what a customer can spend over a rolling window, in
+// SpendingLimitCurrency
+type SpendingLimit struct {
+	Amount float64
+	Window time.Duration
+}
+
+// DefaultSpendingLimit applies to customers without a limit of their own
+var DefaultSpendingLimit = SpendingLimit{Amount: 5000, Window: time.Hour * 24}
+
+// LimitResult reports whether a charge fits the customer's spending limit
+type LimitResult struct {
+	Allowed bool
+	Limit   SpendingLimit
+	Spent   float64 // Charged within the window before this charge
+}
+
+// SpendingLedger holds customers' spending limits and recent charges
+type SpendingLedger interface {
+	// Limit returns the customer's limit, or false for DefaultSpendingLimit
+	Limit(ctx context.Context, customerID string) (SpendingLimit, bool, error)
+	SpentSince(ctx context.Context, customerID string, since time.Time) (float64, error)
+}
+
+type paymentsDBSpendingLedger struct{}
+
+func (paymentsDBSpendingLedger) Limit(ctx context.Context, customerID string) (SpendingLimit, bool, error) {
+	// Simulated lookup - would read the customer's configured limit
+	return SpendingLimit{}, false, nil
+}
+
+func (paymentsDBSpendingLedger) SpentSince(ctx context.Context, customerID string, since time.Time) (float64, error) {
+	// Simulated query - would sum the customer's settled and pending charges
+	return 0, nil
+}
+
+// CheckSpendingLimit reports whether charging amount in currency keeps the
+// customer within their rolling spending limit. The amount is converted to
+// SpendingLimitCurrency first.
+func (a *Activities) CheckSpendingLimit(ctx context.Context, customerID string, amount float64, currency string) (*LimitResult, error) {
+	amount, err := a.amountIn(ctx, amount, currency, SpendingLimitCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, ok, err := a.SpendingLedger.Limit(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("loading spending limit for %s: %w", customerID, err)
+	}
+	if !ok {
+		limit = DefaultSpendingLimit
+	}
+
+	spent, err := a.SpendingLedger.SpentSince(ctx, customerID, time.Now().Add(-limit.Window))
+	if err != nil {
+		return nil, fmt.Errorf("loading recent spending for %s: %w", customerID, err)
+	}
+
+	return &LimitResult{
+		Allowed: toCents(spent)+toCents(amount) <= toCents(limit.Amount),
+		Limit:   limit,
+		Spent:   spent,
+	}, nil
+}
+
+// CustomerTrustStore knows which customers are trusted: repeat customers in
+// good standing
+type CustomerTrustStore interface {
+	Trusted(ctx context.Context, customerID string) (bool, error)
+}
+
+type customersDBTrustStore struct{}
+
+func (customersDBTrustStore) Trusted(ctx context.Context, customerID string) (bool, error) {
+	// Simulated lookup - would read the customer's standing from the
+	// customers database
+	return false, nil
+}
+
+// TrustStatus is whether a payment may skip its fraud check
+type TrustStatus struct {
+	Trusted        bool
+	SkipFraudCheck bool // Trusted, and the amount is under trustedFraudCheckLimit
+}
+
+// CheckTrustStatus looks up whether customerID is trusted and, if so,
+// whether amount in currency is under trustedFraudCheckLimit once converted
+// to trustedFraudCheckCurrency
+func (a *Activities) CheckTrustStatus(ctx context.Context, customerID string, amount float64, currency string) (*TrustStatus, error) {
+	trusted, err := a.CustomerTrust.Trusted(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("loading trust status for %s: %w", customerID, err)
+	}
+	if !trusted {
+		return &TrustStatus{}, nil
+	}
+
+	amount, err = a.amountIn(ctx, amount, currency, trustedFraudCheckCurrency)
+	if err != nil {
+		return nil, err
+	}
+	return &TrustStatus{
+		Trusted:        true,
+		SkipFraudCheck: toCents(amount) < trustedFraudCheckLimit,
+	}, nil
+}
+
+func VerifyBalance(ctx context.Context, customerID string, amount float64) (bool, error) {
+	// Balance inquiry against the customer's funding source
+	return true, nil
+}
+
+// defaultCurrencyMinorUnits is how many decimal places each ISO 4217
+// currency is charged in. Currencies not listed use two.
+var defaultCurrencyMinorUnits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "JOD": 3, "OMR": 3, "TND": 3,
+}
+
+// ConversionResult is an amount converted into another currency
+type ConversionResult struct {
+	Amount   float64 // Rounded to Currency's minor units
+	Currency string
+	Rate     float64 // Units of Currency per unit of the source currency
+}
+
+// UnsupportedCurrencyError is the application error type ConvertCurrency
+// returns for a currency it has no exchange rate for
+const UnsupportedCurrencyError = "UnsupportedCurrency"
+
+// exchangeRates is each currency's units per US dollar
+var exchangeRates = map[string]float64{
+	"USD": 1, "EUR": 0.92, "GBP": 0.79, "CAD": 1.36, "AUD": 1.52, "JPY": 151.50,
+}
+
+func (a *Activities) ConvertCurrency(ctx context.Context, amount float64, from, to string) (*ConversionResult, error) {
+	// Simulated FX lookup - would quote the payment provider's current rate
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fromRate, ok := exchangeRates[from]
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError("no exchange rate for "+from, UnsupportedCurrencyError, nil)
+	}
+	toRate, ok := exchangeRates[to]
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError("no exchange rate for "+to, UnsupportedCurrencyError, nil)
+	}
+
+	rate := toRate / fromRate
+	return &ConversionResult{
+		Amount:   roundToMinorUnits(amount*rate, a.minorUnits(to)),
+		Currency: to,
+		Rate:     rate,
+	}, nil
+}
+
+// amountIn converts amount from currency to target, if they differ
+func (a *Activities) amountIn(ctx context.Context, amount float64, currency, target string) (float64, error) {
+	if strings.EqualFold(currency, target) {
+		return amount, nil
+	}
+	conversion, err := a.ConvertCurrency(ctx, amount, currency, target)
+	if err != nil {
+		return 0, err
+	}
+	return conversion.Amount, nil
+}
+
+// ValidateCurrencyAmount reports whether amount fits currency's minor units,
+// so 100.50 JPY is caught rather than charged as some other magnitude.
+func (a *Activities) ValidateCurrencyAmount(ctx context.Context, amount float64, currency string) (bool, error) {
+	// Allow for float noise such as 0.1 + 0.2
+	scaled := amount * math.Pow10(a.minorUnits(currency))
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6, nil
+}
+
+// minorUnits is how many decimal places currency is charged in
+func (a *Activities) minorUnits(currency string) int {
+	if units, ok := a.CurrencyMinorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
 func ChargePaymentMethod(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
 	// Simulated payment charge
 	return &ChargeResult{
-		TransactionID: fmt.Sprintf("TXN-%d", time.Now().UnixNano()),
-		Amount:        request.Amount,
-		Currency:      request.Currency,
-		ChargedAt:     time.Now(),
+		TransactionID:     fmt.Sprintf("TXN-%d", time.Now().UnixNano()),
+		Amount:            request.Amount,
+		Currency:          request.Currency,
+		PaymentMethodType: "card",
+		ChargedAt:         time.Now(),
 	}, nil
 }
 
-func ChargePaymentMethodV2(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
-	// V2 with idempotency key support
-	return ChargePaymentMethod(ctx, request)
+// chargeGateway sends a charge to the payment gateway
+func chargeGateway(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
+	result, err := ChargePaymentMethod(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	result.GatewayCode = "approved"
+	return result, nil
+}
+
+// ChargeLedger records gateway charges by idempotency key
+type ChargeLedger interface {
+	Lookup(ctx context.Context, idempotencyKey string) (*ChargeResult, error) // Nil when nothing was charged with the key
+	Record(ctx context.Context, idempotencyKey string, result ChargeResult) error
+}
+
+type paymentsDBChargeLedger struct{}
+
+func (paymentsDBChargeLedger) Lookup(ctx context.Context, idempotencyKey string) (*ChargeResult, error) {
+	// Simulated lookup - would read the charge row for the key
+	return nil, nil
+}
+
+func (paymentsDBChargeLedger) Record(ctx context.Context, idempotencyKey string, result ChargeResult) error {
+	// Simulated insert - would write the charge row for the key
+	return nil
+}
+
+func (a *Activities) ChargePaymentMethodV2(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
+	// A retry of a charge that already went through gets the original
+	// result instead of charging again
+	if request.IdempotencyKey != "" {
+		existing, err := a.ChargeLedger.Lookup(ctx, request.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			activityMetrics(ctx).Counter(metricChargeDeduplicated).Inc(1)
+			return existing, nil
+		}
+	}
+
+	// The gateway gets the key too, and dedupes on its side should
+	// recording the charge below fail
+	result, err := a.ChargeGateway(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only final outcomes are recorded; a charge that hit a processing
+	// error or rate limit is charged again, not replayed
+	if request.IdempotencyKey != "" && finalGatewayCode(result.GatewayCode) {
+		if err := a.ChargeLedger.Record(ctx, request.IdempotencyKey, *result); err != nil {
+			activity.GetLogger(ctx).Warn("Recording charge failed", "idempotencyKey", request.IdempotencyKey, "error", err)
+		}
+	}
+	if err := classifyGatewayCode(result.GatewayCode, a.GatewayRateLimitBackoff); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// finalGatewayCode reports whether code is a charge's final outcome, an
+// approval or a decline
+func finalGatewayCode(code string) bool {
+	if code == "rate_limited" {
+		return false
+	}
+	status, _ := mapGatewayResponse(code)
+	return status == "APPROVED" || status == "DECLINED"
+}
+
+// classifyGatewayCode turns gateway codes that must not be returned as a
+// result into typed errors: rate limits are retried after rateLimitBackoff,
+// declines are never retried. Both carry the gateway code as details.
+func classifyGatewayCode(code string, rateLimitBackoff time.Duration) error {
+	if code == "rate_limited" {
+		return temporal.NewApplicationErrorWithOptions("payment gateway rate limited the charge", GatewayRateLimitedError,
+			temporal.ApplicationErrorOptions{
+				Details:        []any{code},
+				NextRetryDelay: rateLimitBackoff,
+			})
+	}
+	// Every code mapGatewayResponse declines, including "fraudulent"
+	if status, _ := mapGatewayResponse(code); status == "DECLINED" {
+		return temporal.NewNonRetryableApplicationError("payment gateway declined the charge", GatewayDeclinedError, nil, code)
+	}
+	return nil
+}
+
+// ConfirmationStore records which payment confirmations have been sent, by
+// idempotency key
+type ConfirmationStore interface {
+	Sent(ctx context.Context, idempotencyKey string) (bool, error)
+	MarkSent(ctx context.Context, idempotencyKey string) error
+}
+
+type notificationsDBConfirmationStore struct{}
+
+func (notificationsDBConfirmationStore) Sent(ctx context.Context, idempotencyKey string) (bool, error) {
+	// Simulated lookup - would read the sent-notification row for the key
+	return false, nil
+}
+
+func (notificationsDBConfirmationStore) MarkSent(ctx context.Context, idempotencyKey string) error {
+	// Simulated insert - would write the sent-notification row for the key
+	return nil
 }
 
-func SendPaymentConfirmation(ctx context.Context, transactionID string) error {
+// deliverConfirmation emails the customer their payment confirmation
+func deliverConfirmation(ctx context.Context, transactionID string) error {
 	// Send confirmation email/notification
 	return nil
 }
 
+// confirmationIdempotencyKey identifies the one confirmation a transaction gets
+func confirmationIdempotencyKey(transactionID string) string {
+	return "payment-confirmation:" + transactionID
+}
+
+// SendPaymentConfirmation sends a transaction's confirmation at most once.
+// Activity retries and re-sends from replayed paths find it in
+// Confirmations and skip it, so customers don't get duplicate emails.
+func (a *Activities) SendPaymentConfirmation(ctx context.Context, transactionID string) error {
+	key := confirmationIdempotencyKey(transactionID)
+	sent, err := a.Confirmations.Sent(ctx, key)
+	if err != nil {
+		return err
+	}
+	if sent {
+		return nil
+	}
+
+	if err := a.DeliverConfirmation(ctx, transactionID); err != nil {
+		return err
+	}
+	// Already delivered, so a retry here would send a duplicate
+	if err := a.Confirmations.MarkSent(ctx, key); err != nil {
+		activity.GetLogger(ctx).Warn("Recording payment confirmation failed", "idempotencyKey", key, "error", err)
+	}
+	return nil
+}
+
+// ProcessPayment takes payment in a single activity, for orders with
+// PaymentModeActivity: the same fraud check, charge (or authorization) and
+// confirmation as PaymentWorkflow, returning the same statuses. It has no
+// fraud check feature flags and always uses CheckFraud. A declined or
+// failed payment is a status, not an error, so nothing retries a charge;
+// only a fraud decision that can't be recorded fails it, before charging.
+func (a *Activities) ProcessPayment(ctx context.Context, request PaymentRequest) (*PaymentResult, error) {
+	logger := activity.GetLogger(ctx)
+
+	// Round to the currency's minor units before anything is charged
+	request.Amount = roundToMinorUnits(request.Amount, a.minorUnits(orderCurrency(request)))
+
+	fraudResult, err := CheckFraud(ctx, request)
+	if err != nil {
+		return &PaymentResult{
+			Status:       "FRAUD_CHECK_FAILED",
+			ErrorMessage: err.Error(),
+		}, nil
+	}
+	// Like PaymentWorkflow, nothing goes ahead without its fraud record
+	decision := fraudDecision(*fraudResult, riskThreshold(request, v1RiskThreshold))
+	if err := RecordFraudDecision(ctx, request, *fraudResult, decision); err != nil {
+		logger.Error("Recording fraud decision failed", "orderID", request.OrderID, "decision", decision, "error", err)
+		return nil, temporal.NewApplicationErrorWithCause("recording fraud decision", FraudRecordError, err)
+	}
+	if decision == FraudDecisionDeclined {
+		logger.Warn("High fraud risk detected", "score", fraudResult.RiskScore)
+		return &PaymentResult{
+			Status:       "FRAUD_SUSPECTED",
+			ErrorMessage: fmt.Sprintf("Risk score %.2f exceeds threshold", fraudResult.RiskScore),
+		}, nil
+	}
+
+	charge, status := ChargePaymentMethod, "APPROVED"
+	if request.AuthorizeOnly {
+		charge, status = AuthorizePayment, "AUTHORIZED"
+	}
+	chargeResult, err := charge(ctx, request)
+	if err != nil {
+		logger.Error("Payment charge failed", "error", err)
+		return &PaymentResult{
+			Status:       "CHARGE_FAILED",
+			ErrorMessage: err.Error(),
+		}, nil
+	}
+
+	// The charge stands whether or not the customer hears about it
+	if !request.AuthorizeOnly {
+		if err := a.SendPaymentConfirmation(ctx, chargeResult.TransactionID); err != nil {
+			logger.Warn("Sending payment confirmation failed", "transactionID", chargeResult.TransactionID, "error", err)
+		}
+	}
+
+	return &PaymentResult{
+		TransactionID:     chargeResult.TransactionID,
+		Status:            status,
+		PaymentMethodType: chargeResult.PaymentMethodType,
+		ProcessedAt:       time.Now(),
+	}, nil
+}
+
 // Security Scan Activities
 
-func RunSASTScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+func LoadRepoScanConfig(ctx context.Context, repoURL string) (*RepoScanConfig, error) {
+	// Reads the repository's default scan profile from the scanner config service
+	return &RepoScanConfig{
+		RepositoryURL: repoURL,
+		ScanTypes:     []string{"sast", "dependency", "secrets"},
+	}, nil
+}
+
+// listRepoFiles lists a repository's tracked file paths
+func listRepoFiles(ctx context.Context, repoURL string) ([]string, error) {
+	// Reads the default branch's tree from the git hosting API
+	return nil, nil
+}
+
+// DetectApplicableScans returns the scan types a repository's manifests,
+// Dockerfiles and IaC files call for, e.g. "dependency" for a package.json
+func (a *Activities) DetectApplicableScans(ctx context.Context, repoURL string) ([]string, error) {
+	files, err := a.ListRepoFiles(ctx, repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("listing files in %s: %w", repoURL, err)
+	}
+	return detectScanTypes(files), nil
+}
+
+// CheckRepoScanConcurrency takes a scan slot on the repository for the scan
+// running as workflowID when one is free. The slot is leased for
+// RepoScanSlotLease, so a scan that dies without releasing it doesn't hold
+// it for good.
+func (a *Activities) CheckRepoScanConcurrency(ctx context.Context, repoURL, workflowID string) (*ConcurrencyResult, error) {
+	result, err := a.RepoScanSlots.Acquire(ctx, repoURL, workflowID, a.MaxScansPerRepository, a.RepoScanSlotLease)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring scan slot on %s: %w", repoURL, err)
+	}
+	return &result, nil
+}
+
+// ReleaseRepoScanSlot frees workflowID's scan slot on the repository
+func (a *Activities) ReleaseRepoScanSlot(ctx context.Context, repoURL, workflowID string) error {
+	return a.RepoScanSlots.Release(ctx, repoURL, workflowID)
+}
+
+// scanCacheTTL is how long a commit's scan result is reused. A commit's
+// code never changes, but advisories for its dependencies do.
+const scanCacheTTL = time.Hour * 24
+
+// scanCacheOptions are the request fields that change a scan's findings or
+// status, hashed into its cache key
+type scanCacheOptions struct {
+	ScanTypes                 []string
+	SuppressedVulnerabilities []string
+	FailOnSeverity            string
+	PromoteSecretsToCritical  bool
+	CustomRulesURL            string
+	AdvisorySource            string
+	MaxTotalFindings          int
+	MinFilesScanned           int
+}
+
+// scanCacheKey identifies a scan of the request's repository at its full
+// CommitSHA by every option that shapes the result. Scan types and
+// suppressions match in any order; empty ScanTypes is the repository's
+// default profile.
+func scanCacheKey(request SecurityScanRequest) string {
+	failOnSeverity := request.FailOnSeverity
+	if failOnSeverity == "" {
+		failOnSeverity = defaultFailOnSeverity
+	}
+	suppressed := append([]string(nil), request.SuppressedVulnerabilities...)
+	sort.Strings(suppressed)
+
+	// Marshalling a struct of strings, ints and bools can't fail
+	options, _ := json.Marshal(scanCacheOptions{
+		ScanTypes:                 sortedScanTypes(request.ScanTypes),
+		SuppressedVulnerabilities: suppressed,
+		FailOnSeverity:            failOnSeverity,
+		PromoteSecretsToCritical:  request.PromoteSecretsToCritical,
+		CustomRulesURL:            request.CustomRulesURL,
+		AdvisorySource:            request.AdvisorySource,
+		MaxTotalFindings:          request.MaxTotalFindings,
+		MinFilesScanned:           request.MinFilesScanned,
+	})
+	sum := sha256.Sum256(options)
+	return "scan:" + request.RepositoryURL + "@" + strings.ToLower(request.CommitSHA) + ":" + hex.EncodeToString(sum[:])
+}
+
+// CheckScanCache returns the result stored under key, from scanCacheKey,
+// or nil when there isn't one. Activities return a single value, so a nil
+// result stands in for a miss.
+func (a *Activities) CheckScanCache(ctx context.Context, key string) (*SecurityScanResult, error) {
+	data, ok := a.Cache.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	var result SecurityScanResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		// An entry from an older result format is a miss, not a failure
+		activity.GetLogger(ctx).Warn("Discarding undecodable scan cache entry", "key", key, "error", err)
+		return nil, nil
+	}
+	return &result, nil
+}
+
+// StoreScanCache stores result under key for CheckScanCache, for
+// scanCacheTTL
+func (a *Activities) StoreScanCache(ctx context.Context, key string, result SecurityScanResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	a.Cache.Set(key, data, scanCacheTTL)
+	return nil
+}
+
+func (a *Activities) RunSASTScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+	progress := startScanProgress(ctx)
+	defer progress.stop()
+
 	// Static Application Security Testing
 	// Calls internal SAST engine
+	ruleSetVersion := builtinSASTRuleSet
+	if request.CustomRulesURL != "" {
+		headers, err := a.authHeaders(ctx, request.AuthSecret)
+		if err != nil {
+			return nil, err
+		}
+		version, err := loadCustomSASTRules(ctx, a.ScannerHTTPClient, request.CustomRulesURL, headers)
+		if err != nil {
+			// Retrying won't fix a bad rules URL, and scanning without the
+			// rules the caller asked for would report a misleading result
+			return nil, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("loading custom SAST rules from %q: %v", request.CustomRulesURL, err),
+				CustomRulesUnavailableError, err)
+		}
+		ruleSetVersion = version
+	}
+	if err := progress.update(20); err != nil {
+		return nil, err
+	}
+
+	// Simulated analysis - would stream per-file results from the engine
+	if err := progress.update(100); err != nil {
+		return nil, err
+	}
+
 	return &ScanTypeResult{
 		ScanType:        "sast",
 		Vulnerabilities: []Vulnerability{},
 		Duration:        time.Minute * 5,
+		RuleSetVersion:  ruleSetVersion,
+		FilesScanned:    filesToScan(request, 240),
 	}, nil
 }
 
-func RunDASTScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+// RedactedHeaders are HTTP headers, such as auth tokens, added to outbound
+// scanner and report calls. Formatting them prints only the header names,
+// so a logged value never leaks a token.
+type RedactedHeaders map[string]string
+
+func (h RedactedHeaders) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name+":REDACTED")
+	}
+	sort.Strings(names)
+	return "map[" + strings.Join(names, " ") + "]"
+}
+
+func (h RedactedHeaders) GoString() string {
+	return "RedactedHeaders" + h.String()
+}
+
+// apply sets the headers on req
+func (h RedactedHeaders) apply(req *http.Request) {
+	for name, value := range h {
+		req.Header.Set(name, value)
+	}
+}
+
+// SecretStore resolves named secrets inside activities, so credentials are
+// passed around by name and never stored in workflow history
+type SecretStore interface {
+	// Headers returns the HTTP headers held by the secret called name
+	Headers(ctx context.Context, name string) (RedactedHeaders, error)
+}
+
+type secretsManagerStore struct{}
+
+func (secretsManagerStore) Headers(ctx context.Context, name string) (RedactedHeaders, error) {
+	// Simulated lookup - would read the secret from the secrets manager
+	// with the worker's own credentials
+	return RedactedHeaders{}, nil
+}
+
+// authHeaders resolves secretName to the headers for outbound scanner and
+// report calls. An empty name sends none.
+func (a *Activities) authHeaders(ctx context.Context, secretName string) (RedactedHeaders, error) {
+	if secretName == "" {
+		return nil, nil
+	}
+	headers, err := a.Secrets.Headers(ctx, secretName)
+	if err != nil {
+		return nil, fmt.Errorf("resolving auth secret %q: %w", secretName, err)
+	}
+	return headers, nil
+}
+
+// loadCustomSASTRules fetches the rule pack at rulesURL with httpClient on
+// top of the built-in rules and returns the combined rule set version
+func loadCustomSASTRules(ctx context.Context, httpClient *http.Client, rulesURL string, headers RedactedHeaders) (string, error) {
+	u, err := url.Parse(rulesURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("rules must be served over https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rulesURL, nil)
+	if err != nil {
+		return "", err
+	}
+	headers.apply(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("rules server returned %s", resp.Status)
+	}
+	// Would verify the rule pack's signature before loading it
+	return builtinSASTRuleSet + "+" + path.Base(u.Path), nil
+}
+
+// dastPhases are RunDASTScan's steps, in order
+var dastPhases = []string{"crawl", "attack", "verify"}
+
+// ErrDASTTargetUnavailable marks a transient DAST target failure, such as
+// a 503 from a deployment that's still starting. DASTTarget returns it
+// wrapped; any other error fails the scan at once.
+var ErrDASTTargetUnavailable = errors.New("DAST target unavailable")
+
+// DASTTarget is the deployment a DAST scan attacks
+type DASTTarget interface {
+	// Ready checks the scan's environment is up
+	Ready(ctx context.Context, request SecurityScanRequest) error
+	// Probe sends the engine's initial request
+	Probe(ctx context.Context, request SecurityScanRequest) error
+}
+
+type deployedDASTTarget struct{}
+
+func (deployedDASTTarget) Ready(ctx context.Context, request SecurityScanRequest) error {
+	// Simulated health check - would poll the review environment's readiness endpoint
+	return nil
+}
+
+func (deployedDASTTarget) Probe(ctx context.Context, request SecurityScanRequest) error {
+	// Simulated request - would have the DAST engine fetch the target's entry point
+	return nil
+}
+
+// defaultDASTFlappingTolerance is how many transient target failures a DAST
+// scan rides out when the request doesn't say
+const defaultDASTFlappingTolerance = 3
+
+// defaultDASTFlapBackoff is the wait after the first transient target
+// failure, doubling after each one
+const defaultDASTFlapBackoff = 5 * time.Second
+
+// awaitDASTTarget runs step until it succeeds, waiting backoff after the
+// first ErrDASTTargetUnavailable and doubling it after each one. Transient
+// failures count against *flaps across steps, and once they pass tolerance
+// it gives up with a DASTTargetUnavailableError.
+func awaitDASTTarget(ctx context.Context, step func() error, flaps *int, tolerance int, backoff time.Duration) error {
+	for {
+		err := step()
+		if err == nil || !errors.Is(err, ErrDASTTargetUnavailable) {
+			return err
+		}
+		*flaps++
+		if *flaps > tolerance {
+			return temporal.NewApplicationError(
+				fmt.Sprintf("DAST target still failing after %d transient failures: %v", tolerance, err),
+				DASTTargetUnavailableError, err)
+		}
+		if activity.IsActivity(ctx) {
+			activity.GetLogger(ctx).Warn("DAST target failed transiently", "flaps", *flaps, "tolerance", tolerance, "error", err)
+		}
+
+		timer := time.NewTimer(backoff << (*flaps - 1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *Activities) RunDASTScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+	progress := startScanProgress(ctx)
+	defer progress.stop()
+
+	// Review environments flap while they start, so a few transient
+	// failures getting the target up aren't fatal
+	tolerance := request.DASTFlappingTolerance
+	switch {
+	case tolerance == 0:
+		tolerance = defaultDASTFlappingTolerance
+	case tolerance < 0:
+		tolerance = 0
+	}
+	var flaps int
+	if err := awaitDASTTarget(ctx, func() error { return a.DASTTarget.Ready(ctx, request) }, &flaps, tolerance, a.DASTFlapBackoff); err != nil {
+		return nil, err
+	}
+	if err := awaitDASTTarget(ctx, func() error { return a.DASTTarget.Probe(ctx, request) }, &flaps, tolerance, a.DASTFlapBackoff); err != nil {
+		return nil, err
+	}
+
 	// Dynamic Application Security Testing
+	for i := range dastPhases {
+		// Simulated phase - would drive the DAST engine against the deployment
+		if err := progress.update((i + 1) * 100 / len(dastPhases)); err != nil {
+			return nil, err
+		}
+	}
+
 	return &ScanTypeResult{
 		ScanType:        "dast",
 		Vulnerabilities: []Vulnerability{},
@@ -145,21 +1426,57 @@ func RunDASTScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeRes
 }
 
 func RunDependencyScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+	progress := startScanProgress(ctx)
+	defer progress.stop()
+
+	source := request.AdvisorySource
+	if source == "" {
+		source = DefaultAdvisorySource
+	}
+	severities, ok := advisorySeverities[source]
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unknown advisory source %q", source), UnknownAdvisorySourceError, nil)
+	}
+
+	// Resolve the dependency tree before matching it against advisories
+	if err := progress.update(50); err != nil {
+		return nil, err
+	}
+
 	// Dependency vulnerability scanning (like Dependabot)
-	return &ScanTypeResult{
-		ScanType: "dependency",
-		Vulnerabilities: []Vulnerability{
-			{
-				ID:          "CVE-2023-12345",
-				Severity:    "medium",
-				Title:       "Prototype Pollution in lodash",
-				Description: "Versions before 4.17.21 are vulnerable",
-				FilePath:    "package.json",
-				LineNumber:  45,
-				Remediation: "Upgrade lodash to >= 4.17.21",
-			},
+	vulns := []Vulnerability{
+		{
+			ID:          "CVE-2023-12345",
+			Title:       "Prototype Pollution in lodash",
+			Description: "Versions before 4.17.21 are vulnerable",
+			FilePath:    "package.json",
+			LineNumber:  45,
+			Remediation: "Upgrade lodash to >= 4.17.21",
 		},
-		Duration: time.Minute * 2,
+	}
+	for i := range vulns {
+		vulns[i].Severity = severities[vulns[i].ID]
+		vulns[i].AdvisorySource = source
+	}
+	if err := progress.update(100); err != nil {
+		return nil, err
+	}
+
+	// The resolved dependency graph is the SBOM's component list, so it's
+	// written here rather than resolved again. Uncommitted changes have no
+	// commit to attach one to.
+	var sbomURL string
+	if !request.LocalMode {
+		sbomURL = sbomLocation(request.CommitSHA)
+	}
+
+	return &ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: vulns,
+		Duration:        time.Minute * 2,
+		FilesScanned:    2, // package.json, go.mod
+		SBOMURL:         sbomURL,
 	}, nil
 }
 
@@ -169,17 +1486,246 @@ func RunSecretsScan(ctx context.Context, request SecurityScanRequest) (*ScanType
 		ScanType:        "secrets",
 		Vulnerabilities: []Vulnerability{},
 		Duration:        time.Minute * 1,
+		FilesScanned:    filesToScan(request, 240),
+	}, nil
+}
+
+// scanHeartbeatInterval is how often scanners heartbeat between progress
+// updates, well inside the scans' 2-minute HeartbeatTimeout
+const scanHeartbeatInterval = time.Second * 30
+
+// scanProgress heartbeats a scanner's percent complete on each update and
+// every scanHeartbeatInterval in between, so a stuck scan fails at its
+// HeartbeatTimeout rather than its 30-minute StartToCloseTimeout
+type scanProgress struct {
+	ctx     context.Context
+	percent int32
+	stopped chan struct{}
+}
+
+// startScanProgress starts heartbeating at 0%. Call stop when the scan returns.
+func startScanProgress(ctx context.Context) *scanProgress {
+	p := &scanProgress{ctx: ctx, stopped: make(chan struct{})}
+	p.heartbeat()
+	go func() {
+		ticker := time.NewTicker(scanHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.heartbeat()
+			case <-p.stopped:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// update records percent complete. It returns ctx's error once the scan is
+// cancelled, so scanners stop at their next update.
+func (p *scanProgress) update(percent int) error {
+	atomic.StoreInt32(&p.percent, int32(percent))
+	p.heartbeat()
+	return p.ctx.Err()
+}
+
+func (p *scanProgress) stop() {
+	close(p.stopped)
+}
+
+func (p *scanProgress) heartbeat() {
+	// Only activities heartbeat; tests also call scanners directly
+	if activity.IsActivity(p.ctx) {
+		activity.RecordHeartbeat(p.ctx, int(atomic.LoadInt32(&p.percent)))
+	}
+}
+
+// filesToScan is how many files a scanner reads: just the staged files in
+// local mode, the changed files in an incremental scan, otherwise the
+// checkout's tracked files
+func filesToScan(request SecurityScanRequest, tracked int) int {
+	if request.LocalMode {
+		return len(request.StagedFiles)
+	}
+	if request.Diff != nil {
+		return len(request.Diff.ChangedFiles)
+	}
+	return tracked
+}
+
+// ComputeChangedFiles lists the files added or modified in repo between the
+// base and head commits, for incremental scans. Deleted files are left out,
+// since there's nothing left in them to scan.
+func ComputeChangedFiles(ctx context.Context, repo, base, head string) ([]string, error) {
+	// Simulated diff - would run `git diff --name-only --diff-filter=d base...head`
+	// in a checkout of repo
+	activity.GetLogger(ctx).Info("Computed changed files", "repo", repo, "base", base, "head", head)
+	return []string{}, nil
+}
+
+func GenerateSBOM(ctx context.Context, request SecurityScanRequest) (*SBOMResult, error) {
+	// Builds a CycloneDX SBOM from the repository's dependency manifests
+	return &SBOMResult{
+		Format: "cyclonedx-json",
+		URL:    sbomLocation(request.CommitSHA),
 	}, nil
 }
 
-func GenerateSecurityReport(ctx context.Context, vulnerabilities []Vulnerability) (*ReportResult, error) {
+// sbomLocation is where a commit's CycloneDX JSON SBOM is stored
+func sbomLocation(commitSHA string) string {
+	return fmt.Sprintf("https://security.example.com/sboms/%s.json", commitSHA)
+}
+
+func GenerateAttestation(ctx context.Context, result SecurityScanResult) (*AttestationResult, error) {
+	// Signs the statement with the attestation key and stores the DSSE envelope
+	statement := newAttestationStatement(result)
+	return &AttestationResult{
+		URL:       fmt.Sprintf("https://security.example.com/attestations/%s.intoto.jsonl", result.ScanID),
+		Statement: statement,
+	}, nil
+}
+
+// fetchCodeowners reads a repository's CODEOWNERS file
+func fetchCodeowners(ctx context.Context, repoURL string) (string, error) {
+	// Reads CODEOWNERS (root, .github/ or docs/) from the default branch
+	return "", nil
+}
+
+// ResolveOwnership maps each of filePaths to its owning team under the
+// repository's CODEOWNERS. Files no rule covers are left out.
+func (a *Activities) ResolveOwnership(ctx context.Context, repoURL string, filePaths []string) (map[string]string, error) {
+	content, err := a.FetchCodeowners(ctx, repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("reading CODEOWNERS for %s: %w", repoURL, err)
+	}
+
+	rules := parseCodeowners(content)
+	owners := make(map[string]string, len(filePaths))
+	for _, file := range filePaths {
+		if owner := codeownersOwner(rules, file); owner != "" {
+			owners[file] = owner
+		}
+	}
+	return owners, nil
+}
+
+// cvssCacheTTL is how long a CVE's CVSS score is reused. Scores are rarely
+// revised, and scans of similar code keep hitting the same CVEs.
+const cvssCacheTTL = time.Hour * 24
+
+// EnrichVulnerabilities fills in CVSS scores for findings with a CVE ID
+func (a *Activities) EnrichVulnerabilities(ctx context.Context, vulnerabilities []Vulnerability) ([]Vulnerability, error) {
+	enriched := make([]Vulnerability, len(vulnerabilities))
+	for i, vuln := range vulnerabilities {
+		if strings.HasPrefix(vuln.ID, "CVE-") {
+			score, err := withCache(ctx, a.Cache, "cvss:"+vuln.ID, cvssCacheTTL, func(ctx context.Context) (float64, error) {
+				return lookupCVSSScore(ctx, vuln)
+			})
+			if err != nil {
+				return nil, err
+			}
+			vuln.CVSSScore = score
+		}
+		enriched[i] = vuln
+	}
+	return enriched, nil
+}
+
+func lookupCVSSScore(ctx context.Context, vuln Vulnerability) (float64, error) {
+	// Simulated NVD lookup - would fetch the CVE's CVSS v3 base score
+	scores := map[string]float64{"critical": 9.8, "high": 7.5, "medium": 5.3, "low": 3.1}
+	return scores[vuln.Severity], nil
+}
+
+// GenerateSecurityReport stores a report of vulnerabilities in format, one
+// of the ReportFormat constants (empty is JSON), linking the scan's SBOM
+// when sbomURL is set. Uploads carry the headers of the authSecret secret.
+func (a *Activities) GenerateSecurityReport(ctx context.Context, vulnerabilities []Vulnerability, sbomURL, format, authSecret string) (*ReportResult, error) {
+	if format == "" {
+		format = ReportFormatJSON
+	}
+	contentType, ok := reportContentTypes[format]
+	if !ok {
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unknown report format %q", format), UnknownReportFormatError, nil)
+	}
+	if _, err := a.authHeaders(ctx, authSecret); err != nil {
+		return nil, err
+	}
+
+	// Simulated render and upload to report storage, sent with the headers
 	reportID := fmt.Sprintf("SEC-%d", time.Now().Unix())
 	return &ReportResult{
-		ReportID: reportID,
-		URL:      fmt.Sprintf("https://security.example.com/reports/%s", reportID),
+		ReportID:    reportID,
+		URL:         fmt.Sprintf("https://security.example.com/reports/%s.%s", reportID, format),
+		ContentType: contentType,
 	}, nil
 }
 
+func (a *Activities) ExportScanMetrics(ctx context.Context, result SecurityScanResult) error {
+	return a.ScanMetrics.Write(ctx, newScanMetricsRecord(result))
+}
+
+// UpdateBaseline advances the branch's scan baseline to commitSHA, so later
+// diffs only report findings introduced after it
+func (a *Activities) UpdateBaseline(ctx context.Context, repoURL, branch, commitSHA string, vulns []Vulnerability) error {
+	return a.Baselines.Save(ctx, ScanBaseline{
+		RepositoryURL:   repoURL,
+		Branch:          branch,
+		CommitSHA:       commitSHA,
+		Vulnerabilities: vulns,
+	})
+}
+
+func newScanMetricsRecord(result SecurityScanResult) ScanMetricsRecord {
+	return ScanMetricsRecord{
+		ScanID:          result.ScanID,
+		RepositoryURL:   result.RepositoryURL,
+		CommitSHA:       result.CommitSHA,
+		Status:          result.Status,
+		CriticalCount:   countBySeverity(result.Vulnerabilities, "critical"),
+		HighCount:       countBySeverity(result.Vulnerabilities, "high"),
+		MediumCount:     countBySeverity(result.Vulnerabilities, "medium"),
+		LowCount:        countBySeverity(result.Vulnerabilities, "low"),
+		DurationSeconds: result.CompletedAt.Sub(result.StartedAt).Seconds(),
+		CompletedAt:     result.CompletedAt,
+	}
+}
+
+// CheckNotificationSuppression reports whether a notification with key was
+// sent within the suppression window. It only checks; the workflow calls
+// RecordNotificationSent once the notification has gone out.
+func (a *Activities) CheckNotificationSuppression(ctx context.Context, key string) (bool, error) {
+	return a.NotificationLog.SentSince(ctx, key, time.Now().Add(-a.NotificationSuppressionWindow))
+}
+
+// RecordNotificationSent starts key's suppression window
+func (a *Activities) RecordNotificationSent(ctx context.Context, key string) error {
+	return a.NotificationLog.MarkSent(ctx, key, time.Now())
+}
+
+func (a *Activities) ListExpiredScans(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return a.ScanResults.ListCompletedBefore(ctx, cutoff)
+}
+
+func (a *Activities) DeleteScanResults(ctx context.Context, scanIDs []string) error {
+	return a.ScanResults.Delete(ctx, scanIDs)
+}
+
+func VerifyRemediation(ctx context.Context, remediation string) (*VerificationResult, error) {
+	// Applies the change on a scratch branch and runs the build and tests
+	// in a sandbox
+	return &VerificationResult{Safe: true}, nil
+}
+
+func ApplyRemediations(ctx context.Context, repositoryURL, branch string, remediations []string) error {
+	// Commits the changes to branch
+	return nil
+}
+
 func NotifyComplianceTeam(ctx context.Context, notification NotificationRequest) error {
 	// Send notification to compliance Slack channel
 	return nil
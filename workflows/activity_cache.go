@@ -0,0 +1,82 @@
+package workflows
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+)
+
+// ActivityCache stores encoded activity results so repeated lookups of the
+// same thing (a CVE's CVSS score, an inventory check) skip the external call
+type ActivityCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// withCache returns the result cached under key if there is one, and
+// otherwise calls fn and caches its result for ttl. Errors are never cached,
+// and a cache entry that no longer decodes is treated as a miss.
+func withCache[T any](ctx context.Context, cache ActivityCache, key string, ttl time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	if data, ok := cache.Get(key); ok {
+		var cached T
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	result, err := fn(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	if data, err := json.Marshal(result); err == nil {
+		cache.Set(key, data, ttl)
+	} else {
+		activity.GetLogger(ctx).Warn("Activity result not cacheable", "key", key, "error", err)
+	}
+	return result, nil
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// memoryCache is a per-process ActivityCache
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	now     func() time.Time
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		entries: make(map[string]memoryCacheEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = memoryCacheEntry{value: value, expiresAt: c.now().Add(ttl)}
+}
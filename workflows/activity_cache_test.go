@@ -0,0 +1,148 @@
+package workflows
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithCache_SecondCallHitsCache(t *testing.T) {
+	cache := newMemoryCache()
+	calls := 0
+	lookup := func(ctx context.Context) (float64, error) {
+		calls++
+		return 9.8, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		score, err := withCache(context.Background(), cache, "cvss:CVE-2024-99999", time.Hour, lookup)
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		if score != 9.8 {
+			t.Errorf("Expected score 9.8, got %v", score)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected 1 underlying call, got %d", calls)
+	}
+}
+
+func TestMemoryCache_ExpiresAfterTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := newMemoryCache()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key", []byte("1"), time.Minute)
+
+	if _, ok := cache.Get("key"); !ok {
+		t.Fatal("Expected a hit within the TTL")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Expected a miss once the TTL passed")
+	}
+}
+
+func TestEnrichVulnerabilities_UsesCachedScore(t *testing.T) {
+	a := &Activities{Cache: newMemoryCache()}
+	a.Cache.Set("cvss:CVE-2023-12345", []byte("6.1"), time.Hour)
+
+	vulns := []Vulnerability{
+		{ID: "CVE-2023-12345", Severity: "medium"},
+		{ID: "SECRET-AWS-KEY", Severity: "high"},
+	}
+
+	enriched, err := a.EnrichVulnerabilities(context.Background(), vulns)
+	if err != nil {
+		t.Fatalf("Enrichment failed: %v", err)
+	}
+
+	if enriched[0].CVSSScore != 6.1 {
+		t.Errorf("Expected cached score 6.1, got %v", enriched[0].CVSSScore)
+	}
+
+	if enriched[1].CVSSScore != 0 {
+		t.Errorf("Expected no score for a non-CVE finding, got %v", enriched[1].CVSSScore)
+	}
+}
+
+func TestScanCache_RoundTrips(t *testing.T) {
+	a := &Activities{Cache: newMemoryCache()}
+	ctx := context.Background()
+	key := scanCacheKey(SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "0123456789abcdef0123456789abcdef01234567",
+		ScanTypes:     []string{"sast", "secrets"},
+	})
+	if cached, err := a.CheckScanCache(ctx, key); err != nil || cached != nil {
+		t.Fatalf("Expected a miss on an empty cache, got %+v, %v", cached, err)
+	}
+
+	stored := SecurityScanResult{ScanID: "SEC-123", CommitSHA: "0123456789abcdef0123456789abcdef01234567", Status: "PASSED"}
+	if err := a.StoreScanCache(ctx, key, stored); err != nil {
+		t.Fatalf("StoreScanCache failed: %v", err)
+	}
+
+	cached, err := a.CheckScanCache(ctx, key)
+	if err != nil {
+		t.Fatalf("CheckScanCache failed: %v", err)
+	}
+	if cached == nil || cached.ScanID != "SEC-123" || cached.Status != "PASSED" {
+		t.Errorf("Expected the stored result, got %+v", cached)
+	}
+}
+
+func TestScanCacheKey(t *testing.T) {
+	base := SecurityScanRequest{
+		RepositoryURL:             "https://github.com/example/repo",
+		CommitSHA:                 "0123456789abcdef0123456789abcdef01234567",
+		ScanTypes:                 []string{"sast", "secrets"},
+		SuppressedVulnerabilities: []string{"CVE-2023-1", "CVE-2023-2"},
+	}
+	key := scanCacheKey(base)
+
+	same := []struct {
+		name   string
+		modify func(r *SecurityScanRequest)
+	}{
+		{"scan type order", func(r *SecurityScanRequest) { r.ScanTypes = []string{"secrets", "sast"} }},
+		{"suppression order", func(r *SecurityScanRequest) { r.SuppressedVulnerabilities = []string{"CVE-2023-2", "CVE-2023-1"} }},
+		{"SHA case", func(r *SecurityScanRequest) { r.CommitSHA = strings.ToUpper(r.CommitSHA) }},
+		{"default FailOnSeverity", func(r *SecurityScanRequest) { r.FailOnSeverity = "high" }},
+		{"branch", func(r *SecurityScanRequest) { r.Branch = "main" }},
+	}
+	for _, tt := range same {
+		request := base
+		tt.modify(&request)
+		if got := scanCacheKey(request); got != key {
+			t.Errorf("Expected %s to share the key, got %s and %s", tt.name, got, key)
+		}
+	}
+
+	different := []struct {
+		name   string
+		modify func(r *SecurityScanRequest)
+	}{
+		{"repository", func(r *SecurityScanRequest) { r.RepositoryURL = "https://github.com/example/fork" }},
+		{"commit", func(r *SecurityScanRequest) { r.CommitSHA = "fedcba9876543210fedcba9876543210fedcba98" }},
+		{"scan types", func(r *SecurityScanRequest) { r.ScanTypes = []string{"sast"} }},
+		{"suppressions", func(r *SecurityScanRequest) { r.SuppressedVulnerabilities = nil }},
+		{"FailOnSeverity", func(r *SecurityScanRequest) { r.FailOnSeverity = "medium" }},
+		{"PromoteSecretsToCritical", func(r *SecurityScanRequest) { r.PromoteSecretsToCritical = true }},
+		{"CustomRulesURL", func(r *SecurityScanRequest) { r.CustomRulesURL = "https://rules.example.com/extra.yml" }},
+		{"AdvisorySource", func(r *SecurityScanRequest) { r.AdvisorySource = "osv" }},
+		{"MaxTotalFindings", func(r *SecurityScanRequest) { r.MaxTotalFindings = 500 }},
+		{"MinFilesScanned", func(r *SecurityScanRequest) { r.MinFilesScanned = 10 }},
+	}
+	for _, tt := range different {
+		request := base
+		tt.modify(&request)
+		if scanCacheKey(request) == key {
+			t.Errorf("Expected a different %s to change the key", tt.name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/worker"
+)
+
+// ActivityPanicError is the application error type an activity registered
+// through recoverActivityPanics fails with when it panics. The error's
+// details hold the stack trace. It's retried like any other failure; add it
+// to a retry policy's NonRetryableErrorTypes to stop at the first panic.
+const ActivityPanicError = "ActivityPanic"
+
+// metricActivityPanic counts recovered activity panics, tagged with the
+// activity name
+const metricActivityPanic = "activity_panic"
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// panicRecoveringRegistry registers every activity wrapped by
+// recoverPanics, under the name it would have had unwrapped
+type panicRecoveringRegistry struct {
+	worker.Registry
+}
+
+// recoverActivityPanics wraps r so the activities registered with it turn
+// panics into ActivityPanicError failures. The Start*Worker functions
+// register through it.
+func recoverActivityPanics(r worker.Registry) worker.Registry {
+	return panicRecoveringRegistry{Registry: r}
+}
+
+func (r panicRecoveringRegistry) RegisterActivity(a any) {
+	r.RegisterActivityWithOptions(a, activity.RegisterOptions{})
+}
+
+func (r panicRecoveringRegistry) RegisterActivityWithOptions(a any, options activity.RegisterOptions) {
+	if options.Name == "" {
+		options.Name = activityName(a)
+	}
+	r.Registry.RegisterActivityWithOptions(recoverPanics(options.Name, a), options)
+}
+
+// activityName is the name the SDK registers activity function fn under
+func activityName(fn any) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+}
+
+// recoverPanics returns fn with the same signature, but a panic returns an
+// ActivityPanicError instead. Only functions whose last result is an error
+// can report one, so anything else is returned unwrapped.
+func recoverPanics(name string, fn any) any {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumOut() == 0 || t.Out(t.NumOut()-1) != errorType {
+		return fn
+	}
+
+	return reflect.MakeFunc(t, func(args []reflect.Value) (results []reflect.Value) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			ctx := context.Background()
+			if t.NumIn() > 0 && t.In(0) == contextType {
+				ctx = args[0].Interface().(context.Context)
+			}
+			err := activityPanic(ctx, name, recovered)
+
+			results = make([]reflect.Value, t.NumOut())
+			for i := range results {
+				results[i] = reflect.Zero(t.Out(i))
+			}
+			results[len(results)-1] = reflect.ValueOf(&err).Elem()
+		}()
+
+		if t.IsVariadic() {
+			return v.CallSlice(args)
+		}
+		return v.Call(args)
+	}).Interface()
+}
+
+// activityPanic reports a recovered panic and builds its error
+func activityPanic(ctx context.Context, name string, recovered any) error {
+	stack := string(debug.Stack())
+	activityMetrics(ctx).WithTags(map[string]string{"activity": name}).Counter(metricActivityPanic).Inc(1)
+	if activity.IsActivity(ctx) {
+		activity.GetLogger(ctx).Error("Activity panicked", "activity", name, "panic", recovered, "stack", stack)
+	}
+	return temporal.NewApplicationError(fmt.Sprintf("activity %s panicked: %v", name, recovered), ActivityPanicError, stack)
+}
@@ -0,0 +1,77 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+// panickingScan is a scanner with a bug: it indexes past its findings
+func panickingScan(ctx context.Context, request SecurityScanRequest) (*ScanTypeResult, error) {
+	var findings []Vulnerability
+	return &ScanTypeResult{Vulnerabilities: findings[:1]}, nil
+}
+
+// optionsRegistry records activities registered with options
+type optionsRegistry struct {
+	worker.Registry
+	activities map[string]any
+}
+
+func (r *optionsRegistry) RegisterActivityWithOptions(a any, options activity.RegisterOptions) {
+	r.activities[options.Name] = a
+}
+
+func assertActivityPanicError(t *testing.T, err error) {
+	t.Helper()
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != ActivityPanicError {
+		t.Fatalf("Expected an %s error, got %v", ActivityPanicError, err)
+	}
+	if !strings.Contains(appErr.Error(), "panickingScan panicked") {
+		t.Errorf("Expected the error to name the activity, got %q", appErr.Error())
+	}
+}
+
+func TestRecoverActivityPanics_RegistersWrappedUnderOriginalName(t *testing.T) {
+	registry := &optionsRegistry{activities: make(map[string]any)}
+	recoverActivityPanics(registry).RegisterActivity(panickingScan)
+
+	wrapped, ok := registry.activities["panickingScan"].(func(context.Context, SecurityScanRequest) (*ScanTypeResult, error))
+	if !ok {
+		t.Fatalf("Expected panickingScan registered with its signature, got %v", registry.activities)
+	}
+
+	result, err := wrapped(context.Background(), SecurityScanRequest{})
+	if result != nil {
+		t.Errorf("Expected no result from a panicking activity, got %+v", result)
+	}
+	assertActivityPanicError(t, err)
+}
+
+func TestRecoverPanics_SurfacesTypedActivityError(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestActivityEnvironment()
+	env.RegisterActivityWithOptions(recoverPanics("panickingScan", panickingScan), activity.RegisterOptions{Name: "panickingScan"})
+
+	_, err := env.ExecuteActivity("panickingScan", SecurityScanRequest{RepositoryURL: "https://github.com/example/repo"})
+	assertActivityPanicError(t, err)
+}
+
+func TestRecoverPanics_PassesThroughResults(t *testing.T) {
+	wrapped := recoverPanics("RunSecretsScan", RunSecretsScan).(func(context.Context, SecurityScanRequest) (*ScanTypeResult, error))
+
+	result, err := wrapped(context.Background(), SecurityScanRequest{RepositoryURL: "https://github.com/example/repo"})
+	if err != nil {
+		t.Fatalf("Expected the scan to succeed, got %v", err)
+	}
+	if result == nil || result.ScanType != "secrets" {
+		t.Errorf("Expected the secrets scan result, got %+v", result)
+	}
+}
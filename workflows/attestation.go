@@ -0,0 +1,60 @@
+package workflows
+
+import "time"
+
+// In-toto statement and predicate types of scan attestations
+const (
+	inTotoStatementType      = "https://in-toto.io/Statement/v1"
+	scanAttestationPredicate = "https://security.example.com/attestations/security-scan/v1"
+)
+
+// AttestationResult locates a signed scan attestation
+type AttestationResult struct {
+	URL       string
+	Statement AttestationStatement // What was signed
+}
+
+// AttestationStatement is an in-toto statement attesting that a scan ran
+// on a commit
+type AttestationStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []AttestationSubject `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     ScanPredicate        `json:"predicate"`
+}
+
+// AttestationSubject is the repository commit an attestation covers
+type AttestationSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// ScanPredicate records which scanners ran and what they found
+type ScanPredicate struct {
+	ScanID               string    `json:"scanId"`
+	Scanners             []string  `json:"scanners"`
+	Status               string    `json:"status"`
+	TotalVulnerabilities int       `json:"totalVulnerabilities"`
+	StartedOn            time.Time `json:"startedOn"`
+	FinishedOn           time.Time `json:"finishedOn"`
+}
+
+// newAttestationStatement builds the statement attesting result
+func newAttestationStatement(result SecurityScanResult) AttestationStatement {
+	return AttestationStatement{
+		Type: inTotoStatementType,
+		Subject: []AttestationSubject{{
+			Name:   result.RepositoryURL,
+			Digest: map[string]string{"gitCommit": result.CommitSHA},
+		}},
+		PredicateType: scanAttestationPredicate,
+		Predicate: ScanPredicate{
+			ScanID:               result.ScanID,
+			Scanners:             result.ScannersRun,
+			Status:               result.Status,
+			TotalVulnerabilities: result.TotalVulnerabilities,
+			StartedOn:            result.StartedAt,
+			FinishedOn:           result.CompletedAt,
+		},
+	}
+}
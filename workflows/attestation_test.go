@@ -0,0 +1,42 @@
+package workflows
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerateAttestation_AttestsCommitAndScanners(t *testing.T) {
+	result := SecurityScanResult{
+		ScanID:        "SEC-123",
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		Status:        "PASSED",
+		StartedAt:     time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		CompletedAt:   time.Date(2024, 1, 15, 10, 12, 0, 0, time.UTC),
+		ScannersRun:   []string{"dependency", "sast", "secrets"},
+	}
+
+	attestation, err := GenerateAttestation(context.Background(), result)
+	if err != nil {
+		t.Fatalf("Generating attestation failed: %v", err)
+	}
+
+	if attestation.URL == "" {
+		t.Error("Expected an attestation URL")
+	}
+
+	statement := attestation.Statement
+	if statement.Type != inTotoStatementType {
+		t.Errorf("Expected an in-toto statement, got type %q", statement.Type)
+	}
+
+	if len(statement.Subject) != 1 || statement.Subject[0].Digest["gitCommit"] != "abc123def456" {
+		t.Errorf("Expected the statement to cover commit abc123def456, got %+v", statement.Subject)
+	}
+
+	if !reflect.DeepEqual(statement.Predicate.Scanners, result.ScannersRun) {
+		t.Errorf("Expected scanners %v, got %v", result.ScannersRun, statement.Predicate.Scanners)
+	}
+}
@@ -0,0 +1,82 @@
+package workflows
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+type BatchOrderRequest struct {
+	BatchID        string
+	Orders         []OrderRequest
+	MaxConcurrency int // Max child orders in flight at once; 0 runs them all together
+}
+
+type BatchOrderResult struct {
+	BatchID   string
+	Results   []OrderResult // Same order as BatchOrderRequest.Orders
+	Completed int
+	Failed    int
+}
+
+// BatchOrderWorkflow fulfills a batch of orders by running an OrderWorkflow
+// child per order.
+//
+// At most MaxConcurrency children run at a time to protect downstream
+// inventory and payment systems; the next order starts as soon as an
+// earlier one finishes.
+func BatchOrderWorkflow(ctx workflow.Context, request BatchOrderRequest) (*BatchOrderResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting batch order workflow", "batchID", request.BatchID, "orders", len(request.Orders))
+
+	limit := request.MaxConcurrency
+	if limit <= 0 || limit > len(request.Orders) {
+		limit = len(request.Orders)
+	}
+
+	result := &BatchOrderResult{
+		BatchID: request.BatchID,
+		Results: make([]OrderResult, len(request.Orders)),
+	}
+
+	selector := workflow.NewSelector(ctx)
+	next, running := 0, 0
+
+	startNext := func() {
+		i := next
+		order := request.Orders[i]
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: OrderWorkflowID(order.OrderID),
+			TaskQueue:  OrderTaskQueue,
+		})
+
+		future := workflow.ExecuteChildWorkflow(childCtx, OrderWorkflow, order)
+		selector.AddFuture(future, func(f workflow.Future) {
+			running--
+
+			var orderResult OrderResult
+			if err := f.Get(ctx, &orderResult); err != nil {
+				logger.Error("Order in batch failed", "orderID", order.OrderID, "error", err)
+				result.Results[i] = OrderResult{OrderID: order.OrderID, Status: "FAILED"}
+				result.Failed++
+				return
+			}
+			result.Results[i] = orderResult
+			if orderResult.Status == "COMPLETED" {
+				result.Completed++
+			} else {
+				result.Failed++
+			}
+		})
+
+		next++
+		running++
+	}
+
+	for next < len(request.Orders) || running > 0 {
+		for running < limit && next < len(request.Orders) {
+			startNext()
+		}
+		selector.Select(ctx)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package workflows
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestBatchOrderWorkflow_MaxConcurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	running, maxRunning := 0, 0
+	env.OnWorkflow(OrderWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, request OrderRequest) (*OrderResult, error) {
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			err := workflow.Sleep(ctx, time.Minute)
+			running--
+			if err != nil {
+				return nil, err
+			}
+			return &OrderResult{OrderID: request.OrderID, Status: "COMPLETED"}, nil
+		})
+
+	request := BatchOrderRequest{
+		BatchID:        "batch-1",
+		MaxConcurrency: 2,
+	}
+	for i := 1; i <= 5; i++ {
+		request.Orders = append(request.Orders, OrderRequest{
+			OrderID:     fmt.Sprintf("order-%d", i),
+			CustomerID:  "customer-456",
+			Items:       []OrderItem{},
+			TotalAmount: 10.00,
+		})
+	}
+
+	env.ExecuteWorkflow(BatchOrderWorkflow, request)
+
+	var result BatchOrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if maxRunning != 2 {
+		t.Errorf("Expected at most 2 concurrent child orders, saw %d", maxRunning)
+	}
+
+	if result.Completed != 5 {
+		t.Errorf("Expected 5 completed orders, got %d", result.Completed)
+	}
+
+	for i, orderResult := range result.Results {
+		if orderResult.OrderID != request.Orders[i].OrderID {
+			t.Errorf("Expected result %d for %s, got %s", i, request.Orders[i].OrderID, orderResult.OrderID)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package workflows
+
+import "testing"
+
+func TestSelectCarrier(t *testing.T) {
+	quotes := []CarrierQuote{
+		{Carrier: "FastShip", Cost: 6.99, TransitDays: 5},
+		{Carrier: "ParcelPost", Cost: 5.99, TransitDays: 7},
+		{Carrier: "ExpressAir", Cost: 16.24, TransitDays: 2},
+	}
+
+	tests := []struct {
+		name     string
+		quotes   []CarrierQuote
+		strategy string
+		carrier  string
+	}{
+		{"cheapest", quotes, CarrierStrategyCheapest, "ParcelPost"},
+		{"fastest", quotes, CarrierStrategyFastest, "ExpressAir"},
+		{"preferred", quotes, CarrierStrategyPreferred, "FastShip"},
+		{"empty strategy is preferred", quotes, "", "FastShip"},
+		{"preferred falls back to cheapest", quotes[1:], CarrierStrategyPreferred, "ParcelPost"},
+		{"cost ties go to the first name", []CarrierQuote{
+			{Carrier: "ParcelPost", Cost: 5.99},
+			{Carrier: "AirLink", Cost: 5.99},
+		}, CarrierStrategyCheapest, "AirLink"},
+		{"transit ties go to the first name", []CarrierQuote{
+			{Carrier: "ZoomFreight", TransitDays: 2},
+			{Carrier: "ExpressAir", TransitDays: 2},
+		}, CarrierStrategyFastest, "ExpressAir"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, ok := selectCarrier(tt.quotes, tt.strategy)
+			if !ok {
+				t.Fatalf("Expected a carrier for strategy %q", tt.strategy)
+			}
+			if quote.Carrier != tt.carrier {
+				t.Errorf("Expected %s, got %s", tt.carrier, quote.Carrier)
+			}
+		})
+	}
+}
+
+func TestSelectCarrier_RejectsUnknownStrategy(t *testing.T) {
+	if _, ok := selectCarrier(quoteCarriers(nil), "slowest"); ok {
+		t.Error("Expected an unknown strategy to select nothing")
+	}
+
+	if _, ok := selectCarrier(nil, CarrierStrategyCheapest); ok {
+		t.Error("Expected no quotes to select nothing")
+	}
+}
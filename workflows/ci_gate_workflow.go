@@ -0,0 +1,66 @@
+package workflows
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+// CI gate exit codes, so a CI job can exit with CIGateResult.ExitCode as-is
+const (
+	CIExitPassed   = 0 // No findings that block the merge
+	CIExitFindings = 1 // Critical or high findings
+	CIExitError    = 2 // The scan couldn't run, e.g. bad input or permissions
+)
+
+type CIGateResult struct {
+	Passed    bool
+	ExitCode  int
+	Status    string // The SecurityScanWorkflow status the gate was decided on
+	ScanID    string
+	ReportURL string
+}
+
+// CIGateWorkflow is the single entry point for CI: it runs a
+// SecurityScanWorkflow child, which validates the input, checks permissions
+// and scans, then reduces the outcome to pass/fail and an exit code.
+func CIGateWorkflow(ctx workflow.Context, request SecurityScanRequest, agentCtx AgentContext) (*CIGateResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting CI gate", "repo", request.RepositoryURL, "commit", request.CommitSHA)
+
+	childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+		WorkflowID: workflow.GetInfo(ctx).WorkflowExecution.ID + "-scan",
+		TaskQueue:  RouteScan(request),
+	})
+
+	var scanResult SecurityScanResult
+	if err := workflow.ExecuteChildWorkflow(childCtx, SecurityScanWorkflow, request, agentCtx).Get(ctx, &scanResult); err != nil {
+		// A scan that couldn't finish must not let the change through
+		logger.Error("CI gate scan failed", "error", err)
+		return &CIGateResult{
+			ExitCode: CIExitError,
+			Status:   "SCAN_FAILED",
+		}, nil
+	}
+
+	passed, exitCode := ciGateOutcome(scanResult.Status)
+	logger.Info("CI gate decided", "status", scanResult.Status, "passed", passed)
+	return &CIGateResult{
+		Passed:    passed,
+		ExitCode:  exitCode,
+		Status:    scanResult.Status,
+		ScanID:    scanResult.ScanID,
+		ReportURL: scanResult.ReportURL,
+	}, nil
+}
+
+// ciGateOutcome maps a SecurityScanWorkflow status to the gate's verdict.
+// Unknown statuses fail closed.
+func ciGateOutcome(status string) (passed bool, exitCode int) {
+	switch status {
+	case "PASSED", "PASSED_WITH_WARNINGS":
+		return true, CIExitPassed
+	case "FAILED_CRITICAL", "FAILED_HIGH", "FAILED_MEDIUM", "FAILED_LOW":
+		return false, CIExitFindings
+	default:
+		return false, CIExitError
+	}
+}
@@ -0,0 +1,71 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestCIGateWorkflow_CriticalFindingsFail(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	env.OnWorkflow(SecurityScanWorkflow, mock.Anything, mock.Anything, mock.Anything).Return(&SecurityScanResult{
+		ScanID: "SEC-123",
+		Status: "FAILED_CRITICAL",
+	}, nil)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+	}
+	agentCtx := AgentContext{
+		AgentID:     "ci",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.ExecuteWorkflow(CIGateWorkflow, request, agentCtx)
+
+	var result CIGateResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Passed {
+		t.Error("Expected FAILED_CRITICAL to fail the gate")
+	}
+
+	if result.ExitCode == 0 {
+		t.Error("Expected a non-zero exit code")
+	}
+}
+
+func TestCIGateOutcome(t *testing.T) {
+	tests := []struct {
+		status   string
+		passed   bool
+		exitCode int
+	}{
+		{"PASSED", true, CIExitPassed},
+		{"PASSED_WITH_WARNINGS", true, CIExitPassed},
+		{"FAILED_CRITICAL", false, CIExitFindings},
+		{"FAILED_HIGH", false, CIExitFindings},
+		{"FAILED_MEDIUM", false, CIExitFindings},
+		{"FAILED_LOW", false, CIExitFindings},
+		{"PERMISSION_DENIED", false, CIExitError},
+		{"INVALID_REPOSITORY_URL", false, CIExitError},
+		{"SOMETHING_NEW", false, CIExitError},
+	}
+
+	for _, tt := range tests {
+		passed, exitCode := ciGateOutcome(tt.status)
+		if passed != tt.passed || exitCode != tt.exitCode {
+			t.Errorf("Expected %s to give passed=%v exit=%d, got passed=%v exit=%d",
+				tt.status, tt.passed, tt.exitCode, passed, exitCode)
+		}
+	}
+}
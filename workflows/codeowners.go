@@ -0,0 +1,92 @@
+package workflows
+
+import (
+	"path"
+	"strings"
+)
+
+// UnownedFindings groups findings in files no CODEOWNERS rule covers.
+// CODEOWNERS owners start with "@" or contain "@", so it can't collide.
+const UnownedFindings = "unowned"
+
+// codeownersRule is one CODEOWNERS line: a pattern and its first owner
+type codeownersRule struct {
+	pattern string
+	owner   string
+}
+
+// parseCodeowners reads CODEOWNERS content. Lines without an owner unset
+// ownership for their pattern, as on GitHub.
+func parseCodeowners(content string) []codeownersRule {
+	var rules []codeownersRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		rule := codeownersRule{pattern: fields[0]}
+		if len(fields) > 1 {
+			rule.owner = fields[1]
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// codeownersOwner returns file's owner under rules, where the last
+// matching rule wins. Empty means unowned.
+func codeownersOwner(rules []codeownersRule, file string) string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if codeownersMatch(rules[i].pattern, file) {
+			return rules[i].owner
+		}
+	}
+	return ""
+}
+
+// codeownersMatch implements the common subset of CODEOWNERS patterns:
+// "*", extension globs like "*.go", anchored paths like "/api/", and
+// directory names that match at any depth like "docs/"
+func codeownersMatch(pattern, file string) bool {
+	if pattern == "*" {
+		return true
+	}
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	if strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(pattern, "/")
+		if anchored || strings.Contains(dir, "/") {
+			return strings.HasPrefix(file, dir+"/")
+		}
+		return strings.HasPrefix(file, dir+"/") || strings.Contains(file, "/"+dir+"/")
+	}
+
+	if !anchored && !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	if ok, _ := path.Match(pattern, file); ok {
+		return true
+	}
+	// A pattern naming a directory owns everything under it
+	return strings.HasPrefix(file, pattern+"/")
+}
+
+// groupFindingsByOwner buckets vulns by the owner of their file, per
+// owners from ResolveOwnership
+func groupFindingsByOwner(vulns []Vulnerability, owners map[string]string) map[string][]Vulnerability {
+	if len(vulns) == 0 {
+		return nil
+	}
+	groups := make(map[string][]Vulnerability)
+	for _, v := range vulns {
+		owner := owners[v.FilePath]
+		if owner == "" {
+			owner = UnownedFindings
+		}
+		groups[owner] = append(groups[owner], v)
+	}
+	return groups
+}
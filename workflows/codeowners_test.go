@@ -0,0 +1,79 @@
+package workflows
+
+import (
+	"context"
+	"testing"
+)
+
+const sampleCodeowners = `# Default reviewers
+*                   @example/platform
+
+/api/               @example/api-team
+*.tf                @example/infra
+docs/               @example/docs
+/api/generated/
+`
+
+func TestCodeownersOwner(t *testing.T) {
+	rules := parseCodeowners(sampleCodeowners)
+
+	tests := []struct {
+		file  string
+		owner string
+	}{
+		{"cmd/server/main.go", "@example/platform"},
+		{"api/handler.go", "@example/api-team"},
+		{"api/v2/routes.go", "@example/api-team"},
+		{"infra/main.tf", "@example/infra"},
+		{"services/billing/docs/README.md", "@example/docs"},
+		{"api/generated/client.go", ""},
+	}
+
+	for _, tt := range tests {
+		if owner := codeownersOwner(rules, tt.file); owner != tt.owner {
+			t.Errorf("Expected %s to be owned by %q, got %q", tt.file, tt.owner, owner)
+		}
+	}
+}
+
+func TestResolveOwnership_GroupsFindingsByOwner(t *testing.T) {
+	a := &Activities{
+		FetchCodeowners: func(ctx context.Context, repoURL string) (string, error) {
+			return "/api/ @example/api-team\n/web/ @example/web-team\n", nil
+		},
+	}
+
+	vulns := []Vulnerability{
+		{ID: "SAST-001", Severity: "high", FilePath: "api/handler.go"},
+		{ID: "SAST-002", Severity: "medium", FilePath: "web/login.tsx"},
+		{ID: "SAST-003", Severity: "low", FilePath: "api/auth.go"},
+		{ID: "SECRET-001", Severity: "critical", FilePath: "scripts/deploy.sh"},
+	}
+
+	owners, err := a.ResolveOwnership(context.Background(), "https://github.com/example/repo", findingFiles(vulns))
+	if err != nil {
+		t.Fatalf("Resolving ownership failed: %v", err)
+	}
+
+	groups := groupFindingsByOwner(vulns, owners)
+
+	expected := map[string][]string{
+		"@example/api-team": {"SAST-001", "SAST-003"},
+		"@example/web-team": {"SAST-002"},
+		UnownedFindings:     {"SECRET-001"},
+	}
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %d owner groups, got %d: %v", len(expected), len(groups), groups)
+	}
+	for owner, ids := range expected {
+		if len(groups[owner]) != len(ids) {
+			t.Errorf("Expected %s to own %v, got %v", owner, ids, groups[owner])
+			continue
+		}
+		for i, id := range ids {
+			if groups[owner][i].ID != id {
+				t.Errorf("Expected %s finding %d to be %s, got %s", owner, i, id, groups[owner][i].ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package workflows
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+type BranchComparisonResult struct {
+	RepositoryURL string
+	BaseBranch    string
+	HeadBranch    string
+	BaseStatus    string
+	HeadStatus    string
+	Added         []Vulnerability // Findings only on the head branch
+	Removed       []Vulnerability // Findings fixed on the head branch
+}
+
+// CompareBranchesWorkflow scans a feature branch and its base side by side so
+// a merge can be judged on the findings it introduces, not the ones it inherits.
+//
+// Both branches run as child SecurityScanWorkflows using the repository's
+// default scan profile.
+func CompareBranchesWorkflow(ctx workflow.Context, repoURL, baseBranch, headBranch string, agentCtx AgentContext) (*BranchComparisonResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting branch comparison workflow",
+		"repo", repoURL,
+		"base", baseBranch,
+		"head", headBranch)
+
+	workflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	scanBranch := func(suffix, branch string) workflow.ChildWorkflowFuture {
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: workflowID + "-" + suffix,
+			TaskQueue:  SecurityTaskQueue,
+		})
+		return workflow.ExecuteChildWorkflow(childCtx, SecurityScanWorkflow, SecurityScanRequest{
+			RepositoryURL: repoURL,
+			Branch:        branch,
+		}, agentCtx)
+	}
+
+	// Scan both branches in parallel
+	baseFuture := scanBranch("base", baseBranch)
+	headFuture := scanBranch("head", headBranch)
+
+	var baseResult, headResult SecurityScanResult
+	if err := baseFuture.Get(ctx, &baseResult); err != nil {
+		logger.Error("Base branch scan failed", "branch", baseBranch, "error", err)
+		return nil, err
+	}
+	if err := headFuture.Get(ctx, &headResult); err != nil {
+		logger.Error("Head branch scan failed", "branch", headBranch, "error", err)
+		return nil, err
+	}
+
+	added, removed := diffVulnerabilities(baseResult.Vulnerabilities, headResult.Vulnerabilities)
+
+	return &BranchComparisonResult{
+		RepositoryURL: repoURL,
+		BaseBranch:    baseBranch,
+		HeadBranch:    headBranch,
+		BaseStatus:    baseResult.Status,
+		HeadStatus:    headResult.Status,
+		Added:         added,
+		Removed:       removed,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestCompareBranchesWorkflow_FindingsUniqueToHead(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	shared := Vulnerability{ID: "CVE-2023-12345", Severity: "medium", FilePath: "package.json"}
+	fixed := Vulnerability{ID: "CVE-2022-11111", Severity: "high", FilePath: "go.mod"}
+	introduced := Vulnerability{ID: "SAST-042", Severity: "critical", FilePath: "api/handler.go"}
+
+	env.OnWorkflow(SecurityScanWorkflow, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, request SecurityScanRequest, agentCtx AgentContext) (*SecurityScanResult, error) {
+			if request.Branch == "feature/login" {
+				return &SecurityScanResult{
+					Status:          "FAILED_CRITICAL",
+					Vulnerabilities: []Vulnerability{shared, introduced},
+				}, nil
+			}
+			return &SecurityScanResult{
+				Status:          "FAILED_HIGH",
+				Vulnerabilities: []Vulnerability{shared, fixed},
+			}, nil
+		})
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.ExecuteWorkflow(CompareBranchesWorkflow, "https://github.com/example/repo", "main", "feature/login", agentCtx)
+
+	var result BranchComparisonResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(result.Added) != 1 || result.Added[0].ID != introduced.ID {
+		t.Errorf("Expected only %s to be added, got %v", introduced.ID, result.Added)
+	}
+
+	if len(result.Removed) != 1 || result.Removed[0].ID != fixed.ID {
+		t.Errorf("Expected only %s to be removed, got %v", fixed.ID, result.Removed)
+	}
+
+	if result.HeadStatus != "FAILED_CRITICAL" {
+		t.Errorf("Expected head status FAILED_CRITICAL, got %s", result.HeadStatus)
+	}
+}
@@ -0,0 +1,106 @@
+package workflows
+
+import (
+	"go.temporal.io/sdk/workflow"
+)
+
+// Compensation is one activity that undoes an earlier step, e.g. a refund
+type Compensation struct {
+	Name     string // Identifies the compensation in the CompensationReport
+	Activity any
+	Args     []any
+}
+
+// CompensationReport is what happened to each compensation runCompensations ran
+type CompensationReport struct {
+	Succeeded []string
+	Failed    []CompensationFailure
+}
+
+type CompensationFailure struct {
+	Name  string
+	Error string
+}
+
+// runCompensations runs stages in order and the compensations within a
+// stage concurrently, at most maxConcurrency at a time (zero for no
+// limit). A failure never stops the rest: every compensation is attempted
+// and the report says which ones didn't go through. It lists them in stage
+// order, not the order they finished in. Put compensations that depend on
+// each other in separate stages.
+func runCompensations(ctx workflow.Context, maxConcurrency int, stages ...[]Compensation) CompensationReport {
+	logger := workflow.GetLogger(ctx)
+
+	var report CompensationReport
+	for _, stage := range stages {
+		errs := make([]error, len(stage))
+		selector := workflow.NewSelector(ctx)
+		pending := 0
+		for i, compensation := range stage {
+			if maxConcurrency > 0 && pending >= maxConcurrency {
+				selector.Select(ctx)
+				pending--
+			}
+
+			i, compensation := i, compensation
+			future := workflow.ExecuteActivity(ctx, compensation.Activity, compensation.Args...)
+			selector.AddFuture(future, func(f workflow.Future) {
+				if errs[i] = f.Get(ctx, nil); errs[i] != nil {
+					logger.Error("Compensation failed", "compensation", compensation.Name, "error", errs[i])
+				}
+			})
+			pending++
+		}
+		for ; pending > 0; pending-- {
+			selector.Select(ctx)
+		}
+
+		for i, compensation := range stage {
+			if errs[i] != nil {
+				report.Failed = append(report.Failed, CompensationFailure{Name: compensation.Name, Error: errs[i].Error()})
+				continue
+			}
+			report.Succeeded = append(report.Succeeded, compensation.Name)
+		}
+	}
+	return report
+}
+
+// compensationStack is a saga's undo log, in stages. Each step that
+// completes pushes the compensation that undoes it, and a later failure
+// unwinds them.
+type compensationStack [][]Compensation
+
+// push adds compensation as a new stage, undone only once everything
+// pushed after it has been
+func (s *compensationStack) push(compensation Compensation) {
+	*s = append(*s, []Compensation{compensation})
+}
+
+// pushAlongside adds compensation to the newest stage, to be undone
+// concurrently with it. It's for steps that don't depend on each other.
+func (s *compensationStack) pushAlongside(compensation Compensation) {
+	if len(*s) == 0 {
+		s.push(compensation)
+		return
+	}
+	top := len(*s) - 1
+	(*s)[top] = append((*s)[top], compensation)
+}
+
+// unwind runs the stages newest first, with runCompensations running each
+// stage's compensations newest first and at most maxConcurrency at a time.
+// Every compensation is attempted. The stack is emptied so nothing is
+// compensated twice.
+func (s *compensationStack) unwind(ctx workflow.Context, maxConcurrency int) CompensationReport {
+	stages := make([][]Compensation, 0, len(*s))
+	for i := len(*s) - 1; i >= 0; i-- {
+		stage := make([]Compensation, 0, len((*s)[i]))
+		for j := len((*s)[i]) - 1; j >= 0; j-- {
+			stage = append(stage, (*s)[i][j])
+		}
+		stages = append(stages, stage)
+	}
+	*s = nil
+	return runCompensations(ctx, maxConcurrency, stages...)
+}
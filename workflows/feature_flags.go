@@ -0,0 +1,56 @@
+package workflows
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Feature flags gating gradual rollouts inside workflows
+const (
+	// FlagPaymentFraudV2 moves PaymentWorkflow onto CheckFraudV2 scoring
+	FlagPaymentFraudV2 = "payment.fraud-check-v2"
+)
+
+// featureFlags evaluates flags through the EvaluateFeatureFlag activity at
+// most once per flag per workflow run and caches the answer in workflow
+// state. Every check within a run sees the same value, and replays read it
+// back from the activity result in history instead of re-evaluating.
+type featureFlags struct {
+	ctx   workflow.Context
+	key   string
+	cache map[string]bool
+}
+
+// newFeatureFlags returns flags evaluated for key (e.g. a customer ID), so a
+// rollout percentage buckets consistently per key.
+func newFeatureFlags(ctx workflow.Context, key string) *featureFlags {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 10,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+	return &featureFlags{
+		ctx:   ctx,
+		key:   key,
+		cache: make(map[string]bool),
+	}
+}
+
+// Enabled reports whether flag is on for this run. If the flag service is
+// unavailable the flag is treated as off, keeping the existing behavior.
+func (f *featureFlags) Enabled(flag string) bool {
+	if enabled, ok := f.cache[flag]; ok {
+		return enabled
+	}
+
+	var enabled bool
+	if err := workflow.ExecuteActivity(f.ctx, EvaluateFeatureFlag, flag, f.key).Get(f.ctx, &enabled); err != nil {
+		workflow.GetLogger(f.ctx).Warn("Feature flag evaluation failed, treating as disabled", "flag", flag, "error", err)
+		enabled = false
+	}
+	f.cache[flag] = enabled
+	return enabled
+}
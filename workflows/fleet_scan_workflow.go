@@ -0,0 +1,118 @@
+package workflows
+
+import (
+	"strconv"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// FleetProgressQuery returns a FleetSecurityScanWorkflow's FleetProgress
+const FleetProgressQuery = "fleetProgress"
+
+type FleetScanRequest struct {
+	FleetID        string
+	Repositories   []SecurityScanRequest
+	MaxConcurrency int // Max child scans in flight at once; 0 runs them all together
+}
+
+type FleetScanResult struct {
+	FleetID  string
+	Results  []SecurityScanResult // Same order as FleetScanRequest.Repositories
+	Progress FleetProgress
+}
+
+// FleetProgress is a fleet scan's overall progress. ReposScanned counts
+// finished scans, failed ones included.
+type FleetProgress struct {
+	ReposScanned   int
+	ReposPending   int
+	TotalCriticals int
+	Repos          []FleetRepoStatus // Same order as FleetScanRequest.Repositories
+}
+
+type FleetRepoStatus struct {
+	RepositoryURL string
+	Branch        string
+	Status        string // "PENDING", "FAILED", or the scan's SecurityScanResult.Status
+}
+
+// FleetSecurityScanWorkflow scans many repositories by running a
+// SecurityScanWorkflow child per repository, at most MaxConcurrency at a
+// time. Operators can follow along through FleetProgressQuery.
+func FleetSecurityScanWorkflow(ctx workflow.Context, request FleetScanRequest, agentCtx AgentContext) (*FleetScanResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting fleet security scan", "fleetID", request.FleetID, "repos", len(request.Repositories))
+
+	progress := FleetProgress{
+		ReposPending: len(request.Repositories),
+		Repos:        make([]FleetRepoStatus, len(request.Repositories)),
+	}
+	for i, repo := range request.Repositories {
+		progress.Repos[i] = FleetRepoStatus{
+			RepositoryURL: repo.RepositoryURL,
+			Branch:        repo.Branch,
+			Status:        "PENDING",
+		}
+	}
+	err := workflow.SetQueryHandler(ctx, FleetProgressQuery, func() (FleetProgress, error) {
+		return progress, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limit := request.MaxConcurrency
+	if limit <= 0 || limit > len(request.Repositories) {
+		limit = len(request.Repositories)
+	}
+
+	result := &FleetScanResult{
+		FleetID: request.FleetID,
+		Results: make([]SecurityScanResult, len(request.Repositories)),
+	}
+
+	workflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	selector := workflow.NewSelector(ctx)
+	next, running := 0, 0
+
+	startNext := func() {
+		i := next
+		repo := request.Repositories[i]
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID: workflowID + "-" + strconv.Itoa(i),
+			TaskQueue:  RouteScan(repo),
+		})
+
+		future := workflow.ExecuteChildWorkflow(childCtx, SecurityScanWorkflow, repo, agentCtx)
+		selector.AddFuture(future, func(f workflow.Future) {
+			running--
+			progress.ReposScanned++
+			progress.ReposPending--
+
+			var scanResult SecurityScanResult
+			if err := f.Get(ctx, &scanResult); err != nil {
+				logger.Error("Repository scan in fleet failed", "repo", repo.RepositoryURL, "error", err)
+				scanResult = SecurityScanResult{RepositoryURL: repo.RepositoryURL, Status: "FAILED"}
+			}
+			result.Results[i] = scanResult
+			progress.Repos[i].Status = scanResult.Status
+			progress.TotalCriticals += countBySeverity(scanResult.Vulnerabilities, "critical")
+		})
+
+		next++
+		running++
+	}
+
+	for next < len(request.Repositories) || running > 0 {
+		for running < limit && next < len(request.Repositories) {
+			startNext()
+		}
+		selector.Select(ctx)
+	}
+
+	logger.Info("Fleet security scan finished",
+		"fleetID", request.FleetID,
+		"criticals", progress.TotalCriticals)
+	result.Progress = progress
+	return result, nil
+}
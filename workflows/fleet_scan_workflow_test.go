@@ -0,0 +1,90 @@
+package workflows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestFleetSecurityScanWorkflow_ProgressQuery(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	// The API repo finishes right away; the web repo takes two hours
+	env.OnWorkflow(SecurityScanWorkflow, mock.Anything, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, request SecurityScanRequest, agentCtx AgentContext) (*SecurityScanResult, error) {
+			if request.RepositoryURL == "https://github.com/example/web" {
+				if err := workflow.Sleep(ctx, time.Hour*2); err != nil {
+					return nil, err
+				}
+				return &SecurityScanResult{RepositoryURL: request.RepositoryURL, Status: "PASSED"}, nil
+			}
+			return &SecurityScanResult{
+				RepositoryURL: request.RepositoryURL,
+				Status:        "FAILED_CRITICAL",
+				Vulnerabilities: []Vulnerability{
+					{ID: "SAST-001", Severity: "critical"},
+					{ID: "SAST-002", Severity: "critical"},
+					{ID: "SAST-003", Severity: "low"},
+				},
+			}, nil
+		})
+
+	var progress FleetProgress
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(FleetProgressQuery)
+		if err != nil {
+			t.Errorf("Query failed: %v", err)
+			return
+		}
+		if err := value.Get(&progress); err != nil {
+			t.Errorf("Decoding progress failed: %v", err)
+		}
+	}, time.Hour)
+
+	request := FleetScanRequest{
+		FleetID: "fleet-1",
+		Repositories: []SecurityScanRequest{
+			{RepositoryURL: "https://github.com/example/api", Branch: "main"},
+			{RepositoryURL: "https://github.com/example/web", Branch: "main"},
+		},
+	}
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.ExecuteWorkflow(FleetSecurityScanWorkflow, request, agentCtx)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if progress.ReposScanned != 1 {
+		t.Errorf("Expected 1 repo scanned mid-fleet, got %d", progress.ReposScanned)
+	}
+
+	if progress.ReposPending != 1 {
+		t.Errorf("Expected 1 repo pending mid-fleet, got %d", progress.ReposPending)
+	}
+
+	if progress.TotalCriticals != 2 {
+		t.Errorf("Expected 2 criticals mid-fleet, got %d", progress.TotalCriticals)
+	}
+
+	if len(progress.Repos) != 2 || progress.Repos[0].Status != "FAILED_CRITICAL" || progress.Repos[1].Status != "PENDING" {
+		t.Errorf("Expected repo statuses [FAILED_CRITICAL PENDING], got %+v", progress.Repos)
+	}
+
+	var result FleetScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Decoding result failed: %v", err)
+	}
+
+	if result.Progress.ReposScanned != 2 || result.Progress.ReposPending != 0 {
+		t.Errorf("Expected all repos scanned at the end, got %+v", result.Progress)
+	}
+}
@@ -0,0 +1,254 @@
+//go:build integration
+
+package workflows
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+// Integration tests run the real worker registrations against a Temporal
+// dev server instead of mocking activities. They catch registration and
+// signature mismatches the unit tests can't see.
+//
+// Run with: go test -tags integration ./workflows/...
+
+// integrationHarness owns a dev server and the workers started against it.
+type integrationHarness struct {
+	t        *testing.T
+	client   client.Client
+	hostPort string // For workers that dial their own client
+}
+
+// newIntegrationHarness starts a dev server that is torn down with the test.
+func newIntegrationHarness(t *testing.T) *integrationHarness {
+	t.Helper()
+
+	server, err := testsuite.StartDevServer(context.Background(), testsuite.DevServerOptions{
+		ClientOptions: &client.Options{Namespace: "default"},
+		LogLevel:      "warn",
+	})
+	if err != nil {
+		t.Fatalf("Failed to start dev server: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := server.Stop(); err != nil {
+			t.Logf("Failed to stop dev server: %v", err)
+		}
+	})
+
+	return &integrationHarness{t: t, client: server.Client(), hostPort: server.FrontendHostPort()}
+}
+
+// startWorker runs a worker on taskQueue using one of the production
+// register functions and production Activities, stopping it when the test
+// ends.
+func (h *integrationHarness) startWorker(taskQueue string, register func(worker.Registry, *Activities)) {
+	h.t.Helper()
+
+	w := worker.New(h.client, taskQueue, worker.Options{})
+	register(w, NewActivities(WorkerConfig{}))
+	if err := w.Start(); err != nil {
+		h.t.Fatalf("Failed to start worker on %s: %v", taskQueue, err)
+	}
+	h.t.Cleanup(w.Stop)
+}
+
+// executeWorkflow starts a workflow and blocks until it completes.
+func (h *integrationHarness) executeWorkflow(options client.StartWorkflowOptions, workflowFn interface{}, valuePtr interface{}, args ...interface{}) error {
+	h.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	run, err := h.client.ExecuteWorkflow(ctx, options, workflowFn, args...)
+	if err != nil {
+		return err
+	}
+	return run.Get(ctx, valuePtr)
+}
+
+func TestIntegration_OrderWorkflow(t *testing.T) {
+	h := newIntegrationHarness(t)
+	h.startWorker(OrderTaskQueue, registerOrderWorker)
+	h.startWorker(PaymentTaskQueue, registerPaymentWorker)
+
+	request := OrderRequest{
+		OrderID:    "order-integration-1",
+		CustomerID: "customer-456",
+		Items: []OrderItem{
+			{BookID: "book-1", Title: "The Maltese Falcon", Quantity: 1, Price: 19.99},
+		},
+		TotalAmount: 19.99,
+	}
+
+	var result OrderResult
+	err := h.executeWorkflow(client.StartWorkflowOptions{
+		ID:        "order-" + request.OrderID,
+		TaskQueue: OrderTaskQueue,
+	}, OrderWorkflow, &result, request)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+
+	if result.PaymentID == "" {
+		t.Error("Expected a payment ID from the payment child workflow")
+	}
+}
+
+func TestIntegration_StartOrderIsIdempotent(t *testing.T) {
+	h := newIntegrationHarness(t)
+	h.startWorker(OrderTaskQueue, registerOrderWorker)
+	h.startWorker(PaymentTaskQueue, registerPaymentWorker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Held for approval, so the order is still running when it's resubmitted
+	request := OrderRequest{
+		OrderID:               "order-integration-idempotent",
+		CustomerID:            "customer-456",
+		Items:                 []OrderItem{{BookID: "book-1", Title: "The Maltese Falcon", Quantity: 1, Price: 19.99}},
+		TotalAmount:           19.99,
+		RequireManualApproval: true,
+	}
+	first, err := StartOrder(ctx, h.client, request)
+	if err != nil {
+		t.Fatalf("StartOrder failed: %v", err)
+	}
+
+	retried, err := StartOrder(ctx, h.client, request)
+	if err != nil {
+		t.Fatalf("Expected a retried start to return the running order, got %v", err)
+	}
+	if retried.GetRunID() != first.GetRunID() {
+		t.Errorf("Expected run %s, got a second run %s", first.GetRunID(), retried.GetRunID())
+	}
+
+	if err := h.client.SignalWorkflow(ctx, first.GetID(), first.GetRunID(), OrderApprovalSignal, true); err != nil {
+		t.Fatalf("Approving the order failed: %v", err)
+	}
+	var result OrderResult
+	if err := first.Get(ctx, &result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	// A closed order can't be submitted again
+	_, err = StartOrder(ctx, h.client, request)
+	var alreadyStarted *serviceerror.WorkflowExecutionAlreadyStarted
+	if !errors.As(err, &alreadyStarted) {
+		t.Fatalf("Expected a second start with the same OrderID to be rejected, got %v", err)
+	}
+}
+
+func TestIntegration_WorkerDrainsOnCancel(t *testing.T) {
+	h := newIntegrationHarness(t)
+	h.startWorker(PaymentTaskQueue, registerPaymentWorker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartOrderWorker(ctx, WorkerConfig{
+			TemporalHost:      h.hostPort,
+			TemporalNamespace: "default",
+			WorkerID:          "order-worker-drain",
+			DrainTimeout:      time.Second * 10,
+		})
+	}()
+
+	// The worker serves orders until it's cancelled
+	request := OrderRequest{
+		OrderID:     "order-integration-drain",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{{BookID: "book-1", Title: "The Maltese Falcon", Quantity: 1, Price: 19.99}},
+		TotalAmount: 19.99,
+	}
+	var result OrderResult
+	err := h.executeWorkflow(client.StartWorkflowOptions{
+		ID:        "order-" + request.OrderID,
+		TaskQueue: OrderTaskQueue,
+	}, OrderWorkflow, &result, request)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(time.Second * 15):
+		t.Fatal("Expected the worker to stop within its drain timeout")
+	}
+}
+
+func TestIntegration_WorkerServesMetrics(t *testing.T) {
+	h := newIntegrationHarness(t)
+	h.startWorker(PaymentTaskQueue, registerPaymentWorker)
+
+	const metricsAddr = "127.0.0.1:19464"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartOrderWorker(ctx, WorkerConfig{
+			TemporalHost:      h.hostPort,
+			TemporalNamespace: "default",
+			WorkerID:          "order-worker-metrics",
+			MetricsListenAddr: metricsAddr,
+		})
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	request := OrderRequest{
+		OrderID:     "order-integration-metrics",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{{BookID: "book-1", Title: "The Maltese Falcon", Quantity: 1, Price: 19.99}},
+		TotalAmount: 19.99,
+	}
+	var result OrderResult
+	err := h.executeWorkflow(client.StartWorkflowOptions{
+		ID:        "order-" + request.OrderID,
+		TaskQueue: OrderTaskQueue,
+	}, OrderWorkflow, &result, request)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	// Metrics are reported to the registry every second
+	var body string
+	deadline := time.Now().Add(time.Second * 10)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get("http://" + metricsAddr + "/metrics")
+		if err == nil {
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(data)
+			if resp.StatusCode == http.StatusOK && strings.Contains(body, " counter\n") {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 200)
+	}
+	t.Fatalf("Expected the metrics endpoint to report a counter, got:\n%s", body)
+}
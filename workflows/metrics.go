@@ -0,0 +1,38 @@
+package workflows
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Metrics emitted by the workflows and activities
+const (
+	metricScanCompleted      = "security_scan_completed"     // Tagged with the scan's status
+	metricOrderCompleted     = "order_completed"             // Tagged with the order's status
+	metricChargeDeduplicated = "payment_charge_deduplicated" // Charges answered from the ChargeLedger
+)
+
+// workflowMetrics returns ctx's metrics handler, or a no-op handler when
+// there isn't one, as in test environments, so instrumentation can never
+// fail a workflow. Emit workflow metrics only through it.
+func workflowMetrics(ctx workflow.Context) client.MetricsHandler {
+	if handler := workflow.GetMetricsHandler(ctx); handler != nil {
+		return handler
+	}
+	return client.MetricsNopHandler
+}
+
+// activityMetrics is workflowMetrics for activities. It's also safe outside
+// an activity, e.g. when tests call an activity function directly.
+func activityMetrics(ctx context.Context) client.MetricsHandler {
+	if !activity.IsActivity(ctx) {
+		return client.MetricsNopHandler
+	}
+	if handler := activity.GetMetricsHandler(ctx); handler != nil {
+		return handler
+	}
+	return client.MetricsNopHandler
+}
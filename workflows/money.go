@@ -0,0 +1,60 @@
+package workflows
+
+import (
+	"math"
+	"strings"
+)
+
+// Cents is a money amount in integer minor units. Amounts are summed and
+// charged as Cents so float64 rounding (0.1 + 0.2 != 0.3) can't leak into
+// what a customer is billed.
+type Cents int64
+
+// toCents rounds a float amount to the nearest minor unit.
+func toCents(amount float64) Cents {
+	return Cents(math.Round(amount * 100))
+}
+
+// Float64 converts back to the float amount used on the wire. The result is
+// the closest float64 to the exact decimal, so equal Cents always produce
+// equal floats.
+func (c Cents) Float64() float64 {
+	return float64(c) / 100
+}
+
+// roundToMinorUnits rounds amount to units decimal places, e.g. 3 for
+// 1.234 BHD, where toCents would charge 1.23.
+func roundToMinorUnits(amount float64, units int) float64 {
+	scale := math.Pow10(units)
+	return math.Round(amount*scale) / scale
+}
+
+// currencyMinorUnits is how many decimal places currency is charged in by
+// default. Workers can override it with WorkerConfig.CurrencyMinorUnits.
+func currencyMinorUnits(currency string) int {
+	if units, ok := defaultCurrencyMinorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// splitCents divides total into n parts that sum to it exactly. The parts
+// are equal except the first, which also takes the remainder, so the same
+// total always splits the same way: 100.00 in 3 is 33.34, 33.33, 33.33.
+func splitCents(total Cents, n int) []Cents {
+	parts := make([]Cents, n)
+	for i := range parts {
+		parts[i] = total / Cents(n)
+	}
+	parts[0] += total % Cents(n)
+	return parts
+}
+
+// itemsTotal sums line items in minor units.
+func itemsTotal(items []OrderItem) Cents {
+	var total Cents
+	for _, item := range items {
+		total += toCents(item.Price) * Cents(item.Quantity)
+	}
+	return total
+}
@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"context"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/client"
+)
+
+// Search attributes StartOrderWithAttributes sets on an order and its
+// payment, so they can be filtered by customer and value in the Temporal
+// UI. Register them on the namespace before use: CustomerID as Keyword and
+// OrderValue as Double.
+const (
+	SearchAttributeCustomerID = "CustomerID"
+	SearchAttributeOrderValue = "OrderValue"
+)
+
+// OrderWorkflowID returns the workflow ID every run for orderID uses, so
+// Temporal can refuse to process the same order twice
+func OrderWorkflowID(orderID string) string {
+	return "order-" + orderID
+}
+
+// StartOrder starts an OrderWorkflow for request and returns without
+// waiting for it to finish. It is safe for clients to retry: while the
+// order is still running, a repeat start returns the existing run instead
+// of starting another, and once it has closed, a repeat start is rejected
+// with a *serviceerror.WorkflowExecutionAlreadyStarted error.
+func StartOrder(ctx context.Context, c client.Client, request OrderRequest) (client.WorkflowRun, error) {
+	return c.ExecuteWorkflow(ctx, orderStartOptions(request), OrderWorkflow, request)
+}
+
+func orderStartOptions(request OrderRequest) client.StartWorkflowOptions {
+	return client.StartWorkflowOptions{
+		ID:                    OrderWorkflowID(request.OrderID),
+		TaskQueue:             OrderTaskQueue,
+		WorkflowIDReusePolicy: enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+		// Left false so a start racing a running order gets its run back
+		WorkflowExecutionErrorWhenAlreadyStarted: false,
+	}
+}
+
+// StartOrderWithAttributes is StartOrder, with the order indexed under its
+// customer and value (see SearchAttributeCustomerID) and a memo naming its
+// currency and item count. The PaymentWorkflow it starts is indexed too.
+func StartOrderWithAttributes(ctx context.Context, c client.Client, request OrderRequest) (client.WorkflowRun, error) {
+	options := orderStartOptions(request)
+	options.SearchAttributes = customerSearchAttributes(request.CustomerID, orderChargeAmount(request))
+	options.Memo = map[string]any{
+		"Currency":  request.Currency,
+		"ItemCount": len(request.Items),
+	}
+	return c.ExecuteWorkflow(ctx, options, OrderWorkflow, request)
+}
+
+func customerSearchAttributes(customerID string, value Cents) map[string]any {
+	return map[string]any{
+		SearchAttributeCustomerID: customerID,
+		SearchAttributeOrderValue: value.Float64(),
+	}
+}
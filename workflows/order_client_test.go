@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	enumspb "go.temporal.io/api/enums/v1"
+)
+
+func TestStartOrder_RejectsDuplicateOrderIDs(t *testing.T) {
+	c := &recordingClient{}
+	request := OrderRequest{OrderID: "order-123", CustomerID: "customer-456"}
+
+	if _, err := StartOrder(context.Background(), c, request); err != nil {
+		t.Fatalf("StartOrder failed: %v", err)
+	}
+
+	if c.options.ID != "order-order-123" {
+		t.Errorf("Expected workflow ID order-order-123, got %s", c.options.ID)
+	}
+	if c.options.TaskQueue != OrderTaskQueue {
+		t.Errorf("Expected task queue %s, got %s", OrderTaskQueue, c.options.TaskQueue)
+	}
+	if c.options.WorkflowIDReusePolicy != enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE {
+		t.Errorf("Expected duplicate order IDs to be rejected, got reuse policy %v", c.options.WorkflowIDReusePolicy)
+	}
+	if c.options.WorkflowExecutionErrorWhenAlreadyStarted {
+		t.Error("Expected a start racing a running order to return the existing run")
+	}
+}
+
+func TestStartOrderWithAttributes_SetsSearchAttributes(t *testing.T) {
+	c := &recordingClient{}
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{{BookID: "book-1", Quantity: 1, Price: 99.99}},
+		TotalAmount: 99.99,
+		Currency:    "EUR",
+	}
+
+	if _, err := StartOrderWithAttributes(context.Background(), c, request); err != nil {
+		t.Fatalf("StartOrderWithAttributes failed: %v", err)
+	}
+
+	expected := map[string]any{
+		SearchAttributeCustomerID: "customer-456",
+		SearchAttributeOrderValue: 99.99,
+	}
+	if !reflect.DeepEqual(c.options.SearchAttributes, expected) {
+		t.Errorf("Expected search attributes %v, got %v", expected, c.options.SearchAttributes)
+	}
+	if c.options.Memo["Currency"] != "EUR" || c.options.Memo["ItemCount"] != 1 {
+		t.Errorf("Expected a memo with currency EUR and 1 item, got %v", c.options.Memo)
+	}
+
+	// Attributes don't replace the duplicate protection
+	if c.options.ID != OrderWorkflowID("order-123") || c.options.WorkflowIDReusePolicy != enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE {
+		t.Errorf("Expected StartOrder's ID and reuse policy, got %+v", c.options)
+	}
+}
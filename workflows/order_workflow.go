@@ -1,17 +1,112 @@
 package workflows
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
+// PaymentClearanceSignal is sent with a bool once a held payment has cleared
+// (true) or been reversed (false)
+const PaymentClearanceSignal = "payment-clearance"
+
+// OrderApprovalSignal is sent with a bool to approve (true) or reject
+// (false) an order held for manual review
+const OrderApprovalSignal = "order-approval"
+
+// CancelOrderSignal cancels an order that hasn't started shipping. Any
+// payment taken is refunded and reserved inventory released.
+const CancelOrderSignal = "cancel_order"
+
+// OrderStatusQuery returns an in-flight order's OrderStatus
+const OrderStatusQuery = "order_status"
+
+// OrderStatus is where an order is in its fulfillment
+type OrderStatus struct {
+	Step      string // "inventory", "payment", "shipping" or "done"
+	PaymentID string // Set once payment is taken
+	UpdatedAt time.Time
+}
+
 type OrderRequest struct {
 	OrderID     string
 	CustomerID  string
 	Items       []OrderItem
-	TotalAmount float64
+	TotalAmount float64 // Includes any tax/shipping; zero charges the sum of Items
+	Currency    string  // ISO code of the amounts, passed on to the payment
+
+	// RequireManualApproval only authorizes the payment, then holds the
+	// order until OrderApprovalSignal. Approval captures and ships;
+	// rejection voids the authorization.
+	RequireManualApproval bool
+
+	// ChargePerShipment only authorizes the payment, then captures each
+	// shipment's share as its label is generated. Shipments lists them in
+	// shipping order; empty ships all Items at once.
+	ChargePerShipment bool
+	Shipments         []Shipment
+
+	// PaymentMode is how payment is taken: PaymentModeChildWorkflow (the
+	// default when empty) runs a PaymentWorkflow child, PaymentModeActivity
+	// runs the ProcessPayment activity instead
+	PaymentMode string
+
+	// CarrierStrategy picks the shipping carrier: CarrierStrategyCheapest,
+	// CarrierStrategyFastest or CarrierStrategyPreferred (the default)
+	CarrierStrategy string
+
+	WebhookURL         string // Partner callback sent when the order completes; empty skips it
+	WebhookMaxAttempts int32  // Deliveries tried before dead-lettering; zero uses defaultWebhookMaxAttempts
+
+	// ArchiveResults writes the final OrderResult with ArchiveOrder once the
+	// workflow finishes, for retention beyond the workflow's own history
+	ArchiveResults bool
+
+	// MaxConcurrentCompensations caps how many compensations, such as the
+	// refund and inventory release, run at once when the order fails or is
+	// cancelled. Zero runs them all at once.
+	MaxConcurrentCompensations int
+}
+
+const (
+	PaymentModeChildWorkflow = "child_workflow"
+	PaymentModeActivity      = "activity"
+)
+
+// UnknownPaymentModeError is the non-retryable application error type
+// OrderWorkflow fails with for a PaymentMode it doesn't know
+const UnknownPaymentModeError = "UnknownPaymentMode"
+
+func validatePaymentMode(mode string) error {
+	switch mode {
+	case "", PaymentModeChildWorkflow, PaymentModeActivity:
+		return nil
+	}
+	return temporal.NewNonRetryableApplicationError(
+		fmt.Sprintf("unknown PaymentMode %q, want child_workflow or activity", mode),
+		UnknownPaymentModeError, nil)
+}
+
+// OrderWebhook is the body of a partner's order completion callback
+type OrderWebhook struct {
+	OrderID       string
+	Status        string
+	PaymentID     string
+	ShippingLabel string
+	CompletedAt   time.Time
+}
+
+// defaultWebhookMaxAttempts spreads deliveries over about ten minutes,
+// enough to ride out a partner deploy or brief outage
+const defaultWebhookMaxAttempts = 6
+
+// Shipment is the part of a ChargePerShipment order that ships together
+type Shipment struct {
+	ShipmentID string // Passed to GenerateShippingLabel
+	Items      []OrderItem
 }
 
 type OrderItem struct {
@@ -22,92 +117,705 @@ type OrderItem struct {
 }
 
 type OrderResult struct {
-	OrderID       string
-	Status        string
-	PaymentID     string
-	ShippingLabel string
-	CompletedAt   time.Time
+	OrderID        string
+	Status         string
+	PaymentID      string
+	ShippingLabel  string   // The last shipment's label for ChargePerShipment orders
+	ShipmentLabels []string // ChargePerShipment only; one label per shipment, in order
+	CompletedAt    time.Time
+	Events         []OrderEvent  // Timeline of the order, oldest first
+	Failure        *OrderFailure // Set when Status is "FAILED"
+}
+
+// OrderFailure records why an order FAILED and what was undone, so a
+// failed order keeps its context rather than ending in a bare error
+type OrderFailure struct {
+	Step                string // The step the order was on: "inventory", "payment" or "shipping"
+	ErrorType           string // The workflow error type, e.g. ShippingError
+	ErrorMessage        string
+	Compensations       []string // Compensations that ran, e.g. "REFUNDED", newest step first
+	FailedCompensations []CompensationFailure
+}
+
+// newOrderFailure describes err, which stopped an order at step after the
+// compensations in compensated had run
+func newOrderFailure(step string, err error, compensated CompensationReport) *OrderFailure {
+	failure := &OrderFailure{
+		Step:                step,
+		ErrorMessage:        err.Error(),
+		Compensations:       compensated.Succeeded,
+		FailedCompensations: compensated.Failed,
+	}
+	var appErr *temporal.ApplicationError
+	if errors.As(err, &appErr) {
+		failure.ErrorType = appErr.Type()
+	}
+	return failure
+}
+
+// OrderEvent is one step in an order's timeline, kept for dispute resolution
+type OrderEvent struct {
+	Type       string // e.g. "INVENTORY_RESERVED", "PAYMENT_APPROVED", "SHIPPED"
+	Detail     string
+	OccurredAt time.Time
+}
+
+// orderConcurrentCompensationChange versions OrderWorkflow undoing the
+// payment alongside the inventory release instead of before it
+const orderConcurrentCompensationChange = "order-concurrent-compensation"
+
+// orderCheckpointChange versions OrderWorkflow's GetOrderCheckpoint and
+// SaveOrderCheckpoint activities
+const orderCheckpointChange = "order-checkpoint"
+
+// OrderCheckpoint records the external effects of an order that must not be
+// repeated, keyed by OrderID so they outlive any single workflow run
+type OrderCheckpoint struct {
+	OrderID           string
+	PaymentID         string // Set once payment is captured; cleared again on refund
+	PaymentMethodType string
+	PaymentCleared    bool   // A held payment has cleared
+	ShippingLabel     string // Set once a label is created
+
+	// ChargePerShipment only; labels of the shipments already shipped and
+	// captured, in order
+	ShipmentLabels []string
 }
 
 // OrderWorkflow orchestrates the complete order fulfillment process
 // including inventory check, payment processing, and shipping.
 //
-// Retry Policy: 3 attempts with exponential backoff starting at 1 second.
-// This workflow calls: ValidateInventory, ProcessPayment, GenerateShippingLabel
-func OrderWorkflow(ctx workflow.Context, request OrderRequest) (*OrderResult, error) {
+// Retry Policy: defaultRetryPolicy(RetryPolicyOrder), 3 attempts with
+// exponential backoff starting at 1 second.
+// This workflow calls: ValidateInventory, PaymentWorkflow (or the
+// ProcessPayment activity with PaymentModeActivity), GenerateShippingLabel
+//
+// An order that fails returns a "FAILED" result whose Failure says what
+// went wrong and which compensations ran, rather than an error. Only a
+// cancelled workflow, or a request rejected before the order starts, ends
+// with an error.
+//
+// Every run, however it ends, records its timeline with PersistOrderAudit,
+// and with ArchiveResults set, archives any result with ArchiveOrder.
+func OrderWorkflow(ctx workflow.Context, request OrderRequest) (result *OrderResult, err error) {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("Starting order workflow", "orderID", request.OrderID)
 
+	if err := validatePaymentMode(request.PaymentMode); err != nil {
+		return nil, err
+	}
+
 	// Configure activity options with retry policy
-	// NOTE: RetryPolicy backoff coefficient should match PaymentWorkflow
 	activityOptions := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute * 5,
-		RetryPolicy: &temporal.RetryPolicy{
-			InitialInterval:    time.Second,
-			BackoffCoefficient: 2.0,
-			MaximumInterval:    time.Minute,
-			MaximumAttempts:    3,
-		},
+		RetryPolicy:         defaultRetryPolicy(RetryPolicyOrder),
 	}
 	ctx = workflow.WithActivityOptions(ctx, activityOptions)
 
+	status := OrderStatus{Step: "inventory", UpdatedAt: workflow.Now(ctx)}
+	setStep := func(step string) {
+		status.Step = step
+		status.UpdatedAt = workflow.Now(ctx)
+	}
+	err = workflow.SetQueryHandler(ctx, OrderStatusQuery, func() (OrderStatus, error) {
+		return status, nil
+	})
+	if err != nil {
+		return nil, workflowError(OrderStateError, "registering order status query", err)
+	}
+
+	var events []OrderEvent
+	recordEvent := func(eventType, detail string) {
+		events = append(events, OrderEvent{
+			Type:       eventType,
+			Detail:     detail,
+			OccurredAt: workflow.Now(ctx),
+		})
+	}
+	recordEvent("ORDER_RECEIVED", "")
+
+	// What compensate has undone so far, for the failure record
+	var compensated CompensationReport
+
+	defer func() {
+		if err != nil {
+			recordEvent("FAILED", err.Error())
+			if !temporal.IsCanceledError(err) {
+				result = &OrderResult{
+					OrderID:   request.OrderID,
+					Status:    "FAILED",
+					PaymentID: status.PaymentID,
+					Failure:   newOrderFailure(status.Step, err, compensated),
+				}
+				err = nil
+			}
+		}
+
+		setStep("done")
+		outcome := "FAILED"
+		if result != nil {
+			outcome = result.Status
+		}
+		workflowMetrics(ctx).WithTags(map[string]string{"status": outcome}).Counter(metricOrderCompleted).Inc(1)
+
+		if result != nil {
+			result.Events = events
+		}
+
+		// Disconnected so the audit is still written if the order was cancelled
+		auditCtx, _ := workflow.NewDisconnectedContext(ctx)
+		if auditErr := workflow.ExecuteActivity(auditCtx, PersistOrderAudit, request.OrderID, events).Get(auditCtx, nil); auditErr != nil {
+			logger.Error("Persisting order audit failed", "orderID", request.OrderID, "error", auditErr)
+		}
+		if request.ArchiveResults && result != nil {
+			if archiveErr := workflow.ExecuteActivity(auditCtx, activities.ArchiveOrder, *result).Get(auditCtx, nil); archiveErr != nil {
+				logger.Error("Archiving order failed", "orderID", request.OrderID, "error", archiveErr)
+			}
+		}
+	}()
+
+	// Load effects an earlier run of this order already made durable, e.g.
+	// a run that was reset or restarted after a worker crash, so charges and
+	// labels are recovered rather than made twice. Runs started before
+	// checkpointing existed replay without its activities, from an empty
+	// checkpoint.
+	checkpointing := workflow.GetVersion(ctx, orderCheckpointChange, workflow.DefaultVersion, 1) == 1
+	checkpoint := OrderCheckpoint{OrderID: request.OrderID}
+	if checkpointing {
+		err = workflow.ExecuteActivity(ctx, activities.GetOrderCheckpoint, request.OrderID).Get(ctx, &checkpoint)
+		if err != nil {
+			logger.Error("Loading order checkpoint failed", "error", err)
+			return nil, workflowError(OrderStateError, "loading order checkpoint", err)
+		}
+		checkpoint.OrderID = request.OrderID
+	}
+	saveCheckpoint := func() {
+		if !checkpointing {
+			return
+		}
+		// Best effort: failing the order after the charge would be worse
+		if err := workflow.ExecuteActivity(ctx, activities.SaveOrderCheckpoint, checkpoint).Get(ctx, nil); err != nil {
+			logger.Error("Saving order checkpoint failed", "orderID", request.OrderID, "error", err)
+		}
+	}
+
+	// A cancel that arrives mid-step lets the step finish, so whatever it did
+	// can be undone, and the order is cancelled instead of moving on
+	cancelCh := workflow.GetSignalChannel(ctx, CancelOrderSignal)
+	cancelRequested := false
+	receiveCancel := func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, nil)
+		cancelRequested = true
+	}
+	cancelled := func() bool {
+		if !cancelRequested {
+			cancelRequested = cancelCh.ReceiveAsync(nil)
+		}
+		return cancelRequested
+	}
+	// awaitStep waits for f to be ready or a cancel to arrive, whichever is
+	// first. A cancel also calls stop, if set, to cut the step short.
+	awaitStep := func(f workflow.Future, stop workflow.CancelFunc) {
+		if cancelled() {
+			return
+		}
+		selector := workflow.NewSelector(ctx)
+		selector.AddFuture(f, func(workflow.Future) {})
+		selector.AddReceive(cancelCh, func(c workflow.ReceiveChannel, more bool) {
+			receiveCancel(c, more)
+			if stop != nil {
+				stop()
+			}
+		})
+		selector.Select(ctx)
+	}
+
 	// Step 1: Validate inventory availability
 	var inventoryResult InventoryResult
-	err := workflow.ExecuteActivity(ctx, ValidateInventory, request.Items).Get(ctx, &inventoryResult)
+	inventoryFuture := workflow.ExecuteActivity(ctx, ValidateInventory, request.Items)
+	awaitStep(inventoryFuture, nil)
+	err = inventoryFuture.Get(ctx, &inventoryResult)
 	if err != nil {
 		logger.Error("Inventory validation failed", "error", err)
-		return nil, err
+		return nil, workflowError(InventoryError, "validating inventory", err)
 	}
 
 	if !inventoryResult.Available {
+		recordEvent("INVENTORY_UNAVAILABLE", "")
 		return &OrderResult{
 			OrderID: request.OrderID,
 			Status:  "INVENTORY_UNAVAILABLE",
 		}, nil
 	}
+	recordEvent("INVENTORY_RESERVED", inventoryResult.ReservationID)
 
-	// Step 2: Process payment via child workflow
-	childOptions := workflow.ChildWorkflowOptions{
-		WorkflowID: "payment-" + request.OrderID,
+	// Every step that completes pushes what undoes it, starting with the
+	// reservation; compensate unwinds them newest first
+	var compensations compensationStack
+	compensations.push(Compensation{Name: "INVENTORY_RELEASED", Activity: ReleaseInventory, Args: []any{inventoryResult.ReservationID}})
+	compensate := func() {
+		report := compensations.unwind(ctx, request.MaxConcurrentCompensations)
+		compensated.Succeeded = append(compensated.Succeeded, report.Succeeded...)
+		compensated.Failed = append(compensated.Failed, report.Failed...)
+		for _, name := range report.Succeeded {
+			switch name {
+			case "REFUNDED", "PAYMENT_VOIDED":
+				recordEvent(name, checkpoint.PaymentID)
+				checkpoint.PaymentID = ""
+				saveCheckpoint()
+			case "INVENTORY_RELEASED":
+				recordEvent(name, inventoryResult.ReservationID)
+			}
+		}
+		for _, failure := range report.Failed {
+			recordEvent("COMPENSATION_FAILED", failure.Name+": "+failure.Error)
+		}
 	}
-	childCtx := workflow.WithChildOptions(ctx, childOptions)
+
+	// An expired reservation may already have been handed to another order,
+	// so the order stops rather than charge or ship against it
+	reservationExpired := func() (*OrderResult, bool) {
+		if inventoryResult.ReservedUntil.IsZero() || workflow.Now(ctx).Before(inventoryResult.ReservedUntil) {
+			return nil, false
+		}
+		logger.Warn("Inventory reservation expired",
+			"orderID", request.OrderID,
+			"reservationID", inventoryResult.ReservationID,
+			"reservedUntil", inventoryResult.ReservedUntil)
+		recordEvent("RESERVATION_EXPIRED", inventoryResult.ReservationID)
+		compensate()
+		return &OrderResult{
+			OrderID:   request.OrderID,
+			Status:    "RESERVATION_EXPIRED",
+			PaymentID: status.PaymentID,
+		}, true
+	}
+	cancelOrder := func() *OrderResult {
+		logger.Info("Cancelling order", "orderID", request.OrderID)
+		recordEvent("CANCELLED", "")
+		compensate()
+		return &OrderResult{
+			OrderID:   request.OrderID,
+			Status:    "CANCELLED",
+			PaymentID: status.PaymentID,
+		}
+	}
+	if cancelled() {
+		return cancelOrder(), nil
+	}
+	if expired, ok := reservationExpired(); ok {
+		return expired, nil
+	}
+
+	// Step 2: Process payment via child workflow, unless a previous run of
+	// this order already charged it
+	setStep("payment")
+	var paymentResult PaymentResult
+	if checkpoint.PaymentID != "" {
+		logger.Info("Recovered payment from checkpoint", "orderID", request.OrderID, "paymentID", checkpoint.PaymentID)
+		paymentResult = PaymentResult{
+			TransactionID:     checkpoint.PaymentID,
+			Status:            "APPROVED",
+			PaymentMethodType: checkpoint.PaymentMethodType,
+		}
+		recordEvent("PAYMENT_RECOVERED", checkpoint.PaymentID)
+	} else {
+		// Run the charge alongside the cancel signal. A cancel is passed on
+		// to the payment child, which voids a charge it had in flight.
+		chargeCtx, cancelCharge := workflow.WithCancel(ctx)
+		chargeFuture, settleCharge := workflow.NewFuture(ctx)
+		workflow.Go(chargeCtx, func(ctx workflow.Context) {
+			charged, outcome, chargeErr := chargeOrder(ctx, request, recordEvent)
+			settleCharge.Set(chargeOutcome{Payment: charged, Result: outcome}, chargeErr)
+		})
+		awaitStep(chargeFuture, cancelCharge)
+
+		// Nothing was charged unless the payment went through, so only
+		// inventory needs releasing if the order was cancelled meanwhile
+		var charge chargeOutcome
+		if chargeErr := chargeFuture.Get(ctx, &charge); chargeErr != nil {
+			if cancelled() {
+				return cancelOrder(), nil
+			}
+			compensate()
+			return nil, chargeErr
+		}
+		if charge.Result != nil {
+			if cancelled() {
+				return cancelOrder(), nil
+			}
+			compensate()
+			return charge.Result, nil
+		}
+		paymentResult = *charge.Payment
+
+		checkpoint.PaymentID = paymentResult.TransactionID
+		checkpoint.PaymentMethodType = paymentResult.PaymentMethodType
+		saveCheckpoint()
+	}
+
+	// Per-shipment orders are only authorized until the first shipment, so
+	// the authorization is voided instead of refunded
+	undoPayment := Compensation{Name: "REFUNDED", Activity: RefundPayment, Args: []any{paymentResult.TransactionID}}
+	if request.ChargePerShipment {
+		undoPayment = Compensation{Name: "PAYMENT_VOIDED", Activity: VoidPayment, Args: []any{paymentResult.TransactionID}}
+	}
+	// The refund doesn't depend on the inventory release, so they're undone
+	// together. Runs started before that undo them one at a time on replay.
+	if workflow.GetVersion(ctx, orderConcurrentCompensationChange, workflow.DefaultVersion, 1) == 1 {
+		compensations.pushAlongside(undoPayment)
+	} else {
+		compensations.push(undoPayment)
+	}
+
+	status.PaymentID = paymentResult.TransactionID
+
+	// Hold shipment until payments that can still be reversed have cleared
+	if HoldForClearance(paymentResult) && !checkpoint.PaymentCleared {
+		logger.Info("Holding shipment for payment clearance",
+			"orderID", request.OrderID,
+			"paymentMethod", paymentResult.PaymentMethodType)
+		recordEvent("PAYMENT_HELD", paymentResult.PaymentMethodType)
+
+		var cleared bool
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(workflow.GetSignalChannel(ctx, PaymentClearanceSignal), func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, &cleared)
+		})
+		selector.AddReceive(cancelCh, receiveCancel)
+		selector.Select(ctx)
+		if cancelRequested {
+			return cancelOrder(), nil
+		}
+		if !cleared {
+			recordEvent("PAYMENT_NOT_CLEARED", paymentResult.TransactionID)
+			compensate()
+			return &OrderResult{
+				OrderID:   request.OrderID,
+				Status:    "PAYMENT_NOT_CLEARED",
+				PaymentID: paymentResult.TransactionID,
+			}, nil
+		}
+		recordEvent("PAYMENT_CLEARED", paymentResult.TransactionID)
+		checkpoint.PaymentCleared = true
+		saveCheckpoint()
+	}
+
+	// Shipping can't be undone, so this is the last chance to cancel
+	if cancelled() {
+		return cancelOrder(), nil
+	}
+	if expired, ok := reservationExpired(); ok {
+		return expired, nil
+	}
+
+	// Step 3: Generate shipping label, reusing one a previous run created
+	setStep("shipping")
+	if request.ChargePerShipment {
+		err = shipAndCapture(ctx, request, paymentResult.TransactionID, &checkpoint, saveCheckpoint, recordEvent)
+		if err != nil {
+			logger.Error("Shipment failed", "error", err)
+			if len(checkpoint.ShipmentLabels) == 0 {
+				compensate()
+				return nil, err
+			}
+			// Earlier shipments are out the door and paid for; release
+			// the rest of the authorization so it isn't left hanging
+			if voidErr := workflow.ExecuteActivity(ctx, VoidPayment, paymentResult.TransactionID).Get(ctx, nil); voidErr != nil {
+				logger.Error("Voiding remaining authorization failed", "authorizationID", paymentResult.TransactionID, "error", voidErr)
+				compensated.Failed = append(compensated.Failed, CompensationFailure{Name: "PAYMENT_VOIDED", Error: voidErr.Error()})
+			} else {
+				recordEvent("PAYMENT_VOIDED", paymentResult.TransactionID)
+				compensated.Succeeded = append(compensated.Succeeded, "PAYMENT_VOIDED")
+			}
+			return nil, err
+		}
+		checkpoint.ShippingLabel = checkpoint.ShipmentLabels[len(checkpoint.ShipmentLabels)-1]
+	} else {
+		if checkpoint.ShippingLabel == "" {
+			var shippingResult ShippingResult
+			err = workflow.ExecuteActivity(ctx, GenerateShippingLabel, request.OrderID, request.Items, request.CarrierStrategy).Get(ctx, &shippingResult)
+			if err != nil {
+				logger.Error("Shipping label generation failed", "error", err)
+				compensate()
+				return nil, workflowError(ShippingError, "generating shipping label", err)
+			}
+			checkpoint.ShippingLabel = shippingResult.TrackingNumber
+			saveCheckpoint()
+		}
+		recordEvent("SHIPPED", checkpoint.ShippingLabel)
+	}
+
+	result = &OrderResult{
+		OrderID:        request.OrderID,
+		Status:         "COMPLETED",
+		PaymentID:      paymentResult.TransactionID,
+		ShippingLabel:  checkpoint.ShippingLabel,
+		ShipmentLabels: checkpoint.ShipmentLabels,
+		CompletedAt:    workflow.Now(ctx),
+	}
+	if request.WebhookURL != "" {
+		sendOrderWebhook(ctx, request, result)
+	}
+	return result, nil
+}
+
+// sendOrderWebhook delivers the completion callback with its own retry
+// policy, and dead-letters it once retries run out so it can be replayed.
+// The order has already completed, so nothing here can fail it.
+func sendOrderWebhook(ctx workflow.Context, request OrderRequest, result *OrderResult) {
+	logger := workflow.GetLogger(ctx)
+
+	maxAttempts := request.WebhookMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+	webhookCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second * 10,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute * 5,
+			MaximumAttempts:    maxAttempts,
+		},
+	})
+
+	payload := OrderWebhook{
+		OrderID:       result.OrderID,
+		Status:        result.Status,
+		PaymentID:     result.PaymentID,
+		ShippingLabel: result.ShippingLabel,
+		CompletedAt:   result.CompletedAt,
+	}
+	err := workflow.ExecuteActivity(webhookCtx, SendOrderWebhook, request.WebhookURL, payload).Get(ctx, nil)
+	if err == nil {
+		return
+	}
+
+	logger.Warn("Order webhook failed, dead-lettering", "orderID", request.OrderID, "url", request.WebhookURL, "error", err)
+	deadLetter := WebhookDeadLetter{
+		URL:      request.WebhookURL,
+		Payload:  payload,
+		Error:    err.Error(),
+		Attempts: maxAttempts,
+		FailedAt: workflow.Now(ctx),
+	}
+	if err := workflow.ExecuteActivity(ctx, RecordWebhookDeadLetter, deadLetter).Get(ctx, nil); err != nil {
+		logger.Error("Recording webhook dead letter failed", "orderID", request.OrderID, "error", err)
+	}
+}
+
+// shipAndCapture ships a ChargePerShipment order one shipment at a time,
+// capturing each shipment's share of the authorization once its label is
+// generated. The last shipment captures whatever is left, so any tax or
+// shipping in TotalAmount is taken with it. Shipments a previous run
+// already shipped, per the checkpoint, are skipped.
+func shipAndCapture(ctx workflow.Context, request OrderRequest, authorizationID string, checkpoint *OrderCheckpoint, saveCheckpoint func(), recordEvent func(eventType, detail string)) error {
+	shipments := request.Shipments
+	if len(shipments) == 0 {
+		shipments = []Shipment{{ShipmentID: request.OrderID, Items: request.Items}}
+	}
+
+	remaining := orderChargeAmount(request)
+	for i, shipment := range shipments {
+		amount := itemsTotal(shipment.Items)
+		if i == len(shipments)-1 || amount > remaining {
+			amount = remaining
+		}
+		remaining -= amount
+		if i < len(checkpoint.ShipmentLabels) {
+			continue
+		}
+
+		var shippingResult ShippingResult
+		err := workflow.ExecuteActivity(ctx, GenerateShippingLabel, shipment.ShipmentID, shipment.Items, request.CarrierStrategy).Get(ctx, &shippingResult)
+		if err != nil {
+			return workflowError(ShippingError, "generating shipping label for "+shipment.ShipmentID, err)
+		}
+		if amount > 0 {
+			var captureResult ChargeResult
+			err = workflow.ExecuteActivity(ctx, CapturePayment, authorizationID, amount.Float64()).Get(ctx, &captureResult)
+			if err != nil {
+				return workflowError(PaymentGatewayError, "capturing payment for "+shipment.ShipmentID, err)
+			}
+			recordEvent("PAYMENT_CAPTURED", captureResult.TransactionID)
+		}
+		recordEvent("SHIPPED", shippingResult.TrackingNumber)
+
+		checkpoint.ShipmentLabels = append(checkpoint.ShipmentLabels, shippingResult.TrackingNumber)
+		saveCheckpoint()
+	}
+	return nil
+}
+
+// orderChargeAmount is what request is charged in total, in cents so
+// multi-item totals don't drift
+func orderChargeAmount(request OrderRequest) Cents {
+	if amount := toCents(request.TotalAmount); amount != 0 {
+		return amount
+	}
+	return itemsTotal(request.Items)
+}
+
+// indexPayment gives a payment child the search attributes and memo of the
+// order starting it, when the order has them. Orders started without them
+// leave their payments unindexed, so namespaces that never registered the
+// attributes keep working.
+func indexPayment(ctx workflow.Context, options *workflow.ChildWorkflowOptions, request PaymentRequest) {
+	if _, ok := workflow.GetInfo(ctx).SearchAttributes.GetIndexedFields()[SearchAttributeCustomerID]; !ok {
+		return
+	}
+	options.SearchAttributes = customerSearchAttributes(request.CustomerID, toCents(request.Amount))
+	options.Memo = map[string]any{
+		"OrderID":  request.OrderID,
+		"Currency": request.Currency,
+	}
+}
+
+// processPayment runs the ProcessPayment activity into result. A charge
+// can't safely be retried or abandoned partway, so it gets one attempt and
+// runs to completion even if the order is cancelled meanwhile. Like
+// PaymentWorkflow, a payment taken after a cancel is voided and reported
+// as CANCELLED.
+func processPayment(ctx workflow.Context, request PaymentRequest, result *PaymentResult) error {
+	paymentCtx, _ := workflow.NewDisconnectedContext(ctx)
+	paymentCtx = workflow.WithActivityOptions(paymentCtx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 1,
+		},
+	})
+	if err := workflow.ExecuteActivity(paymentCtx, activities.ProcessPayment, request).Get(paymentCtx, result); err != nil {
+		return err
+	}
+	if ctx.Err() != nil && (result.Status == "APPROVED" || result.Status == "AUTHORIZED") {
+		*result = *voidCancelledCharge(paymentCtx, ChargeResult{
+			TransactionID:     result.TransactionID,
+			PaymentMethodType: result.PaymentMethodType,
+		}, request.AuthorizeOnly)
+	}
+	return nil
+}
+
+// chargeOutcome is what chargeOrder returned, passed through a Future
+type chargeOutcome struct {
+	Payment *PaymentResult
+	Result  *OrderResult
+}
+
+// chargeOrder takes payment for request through a PaymentWorkflow child,
+// or the ProcessPayment activity per request.PaymentMode, including the
+// manual approval hold. It returns the completed payment, or
+// the order's final result when payment didn't go through.
+func chargeOrder(ctx workflow.Context, request OrderRequest, recordEvent func(eventType, detail string)) (*PaymentResult, *OrderResult, error) {
+	logger := workflow.GetLogger(ctx)
+
+	chargeAmount := orderChargeAmount(request)
+	authorizeOnly := request.RequireManualApproval || request.ChargePerShipment
 
 	paymentRequest := PaymentRequest{
-		OrderID:    request.OrderID,
-		CustomerID: request.CustomerID,
-		Amount:     request.TotalAmount,
+		OrderID:       request.OrderID,
+		CustomerID:    request.CustomerID,
+		Amount:        chargeAmount.Float64(),
+		Currency:      request.Currency,
+		AuthorizeOnly: authorizeOnly,
+	}
+
+	childOptions := workflow.ChildWorkflowOptions{
+		WorkflowID: "payment-" + request.OrderID,
+		TaskQueue:  PaymentTaskQueue,
+		// On cancel, wait for the child to void its charge and say so
+		WaitForCancellation: true,
 	}
+	indexPayment(ctx, &childOptions, paymentRequest)
+	childCtx := workflow.WithChildOptions(ctx, childOptions)
 
 	var paymentResult PaymentResult
-	err = workflow.ExecuteChildWorkflow(childCtx, PaymentWorkflow, paymentRequest).Get(ctx, &paymentResult)
+	var err error
+	if request.PaymentMode == PaymentModeActivity {
+		err = processPayment(ctx, paymentRequest, &paymentResult)
+	} else {
+		err = workflow.ExecuteChildWorkflow(childCtx, PaymentWorkflow, paymentRequest).Get(ctx, &paymentResult)
+	}
 	if err != nil {
 		logger.Error("Payment processing failed", "error", err)
-		return nil, err
+		return nil, nil, workflowError(PaymentGatewayError, "processing payment", err)
 	}
 
-	if paymentResult.Status != "APPROVED" {
-		return &OrderResult{
+	if paymentResult.Status == "CANCELLED" {
+		recordEvent("PAYMENT_CANCELLED", paymentResult.TransactionID)
+		return nil, &OrderResult{
+			OrderID: request.OrderID,
+			Status:  "CANCELLED",
+		}, nil
+	}
+
+	expectedStatus := "APPROVED"
+	if authorizeOnly {
+		expectedStatus = "AUTHORIZED"
+	}
+	if paymentResult.Status != expectedStatus {
+		recordEvent("PAYMENT_DECLINED", paymentResult.Status)
+		return nil, &OrderResult{
 			OrderID:   request.OrderID,
 			Status:    "PAYMENT_DECLINED",
 			PaymentID: paymentResult.TransactionID,
 		}, nil
 	}
+	recordEvent("PAYMENT_"+expectedStatus, paymentResult.TransactionID)
 
-	// Step 3: Generate shipping label
-	var shippingResult ShippingResult
-	err = workflow.ExecuteActivity(ctx, GenerateShippingLabel, request.OrderID).Get(ctx, &shippingResult)
-	if err != nil {
-		logger.Error("Shipping label generation failed", "error", err)
-		// Compensate: refund payment
-		_ = workflow.ExecuteActivity(ctx, RefundPayment, paymentResult.TransactionID).Get(ctx, nil)
-		return nil, err
+	// Hold for manual review with the funds authorized but not yet taken
+	if request.RequireManualApproval {
+		logger.Info("Holding order for manual approval", "orderID", request.OrderID)
+		recordEvent("AWAITING_APPROVAL", "")
+
+		// A signal Receive ignores cancellation, so wait on the context too
+		var approved bool
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(workflow.GetSignalChannel(ctx, OrderApprovalSignal), func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, &approved)
+		})
+		selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {})
+		selector.Select(ctx)
+		if !approved {
+			// Also reached when the order is cancelled during the hold, so
+			// the void must run on a context that isn't cancelled
+			status := "REJECTED"
+			if ctx.Err() != nil {
+				status = "CANCELLED"
+			} else {
+				recordEvent("REJECTED", "")
+			}
+			voidCtx, _ := workflow.NewDisconnectedContext(ctx)
+			if voidErr := workflow.ExecuteActivity(voidCtx, VoidPayment, paymentResult.TransactionID).Get(voidCtx, nil); voidErr != nil {
+				logger.Error("Voiding authorization failed", "authorizationID", paymentResult.TransactionID, "error", voidErr)
+			} else {
+				recordEvent("PAYMENT_VOIDED", paymentResult.TransactionID)
+			}
+			return nil, &OrderResult{
+				OrderID:   request.OrderID,
+				Status:    status,
+				PaymentID: paymentResult.TransactionID,
+			}, nil
+		}
+		recordEvent("APPROVED", "")
+		if request.ChargePerShipment {
+			// Each shipment captures its own share
+			return &paymentResult, nil, nil
+		}
+
+		var captureResult ChargeResult
+		err = workflow.ExecuteActivity(ctx, CapturePayment, paymentResult.TransactionID, chargeAmount.Float64()).Get(ctx, &captureResult)
+		if err != nil {
+			logger.Error("Capturing payment failed", "error", err)
+			// Compensate: release the held funds
+			_ = workflow.ExecuteActivity(ctx, VoidPayment, paymentResult.TransactionID).Get(ctx, nil)
+			recordEvent("PAYMENT_VOIDED", paymentResult.TransactionID)
+			return nil, nil, workflowError(PaymentGatewayError, "capturing payment", err)
+		}
+		paymentResult.TransactionID = captureResult.TransactionID
+		recordEvent("PAYMENT_CAPTURED", captureResult.TransactionID)
 	}
 
-	return &OrderResult{
-		OrderID:       request.OrderID,
-		Status:        "COMPLETED",
-		PaymentID:     paymentResult.TransactionID,
-		ShippingLabel: shippingResult.TrackingNumber,
-		CompletedAt:   workflow.Now(ctx),
-	}, nil
+	return &paymentResult, nil, nil
 }
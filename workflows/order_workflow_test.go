@@ -1,21 +1,33 @@
 package workflows
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
 )
 
 func TestOrderWorkflow_Success(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
 
 	// Mock activities
-	env.OnActivity(ValidateInventory, []OrderItem{}).Return(&InventoryResult{Available: true}, nil)
-	env.OnActivity(GenerateShippingLabel, "order-123").Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnActivity(ValidateInventory, mock.Anything, []OrderItem{}).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	// Mock child workflow
-	env.OnWorkflow(PaymentWorkflow, PaymentRequest{
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     99.99,
@@ -49,11 +61,81 @@ func TestOrderWorkflow_Success(t *testing.T) {
 	}
 }
 
+func TestOrderWorkflow_PaymentModes(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+	}{
+		{"default", ""},
+		{"child workflow", PaymentModeChildWorkflow},
+		{"activity", PaymentModeActivity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			noOrderCheckpoint(env)
+
+			env.OnActivity(ValidateInventory, mock.Anything, []OrderItem{}).Return(&InventoryResult{Available: true}, nil)
+			env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+			env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			payment := &PaymentResult{TransactionID: "txn-789", Status: "APPROVED"}
+			if tt.mode == PaymentModeActivity {
+				env.OnActivity(activities.ProcessPayment, mock.Anything, mock.Anything).Return(payment, nil).Once()
+				env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(nil, nil).Never()
+			} else {
+				env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(payment, nil).Once()
+				env.OnActivity(activities.ProcessPayment, mock.Anything, mock.Anything).Return(nil, nil).Never()
+			}
+
+			env.ExecuteWorkflow(OrderWorkflow, OrderRequest{
+				OrderID:     "order-123",
+				CustomerID:  "customer-456",
+				Items:       []OrderItem{},
+				TotalAmount: 99.99,
+				PaymentMode: tt.mode,
+			})
+
+			var result OrderResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+			if result.Status != "COMPLETED" || result.PaymentID != "txn-789" {
+				t.Errorf("Expected COMPLETED with payment txn-789, got %s with %q", result.Status, result.PaymentID)
+			}
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderWorkflow_UnknownPaymentMode(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	env.ExecuteWorkflow(OrderWorkflow, OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+		PaymentMode: "invoice",
+	})
+
+	err := env.GetWorkflowError()
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != UnknownPaymentModeError {
+		t.Fatalf("Expected a %s application error, got %v", UnknownPaymentModeError, err)
+	}
+}
+
 func TestOrderWorkflow_InventoryUnavailable(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
 
-	env.OnActivity(ValidateInventory, []OrderItem{}).Return(&InventoryResult{Available: false}, nil)
+	env.OnActivity(ValidateInventory, mock.Anything, []OrderItem{}).Return(&InventoryResult{Available: false}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	request := OrderRequest{
 		OrderID:     "order-123",
@@ -75,3 +157,1161 @@ func TestOrderWorkflow_InventoryUnavailable(t *testing.T) {
 		t.Errorf("Expected status INVENTORY_UNAVAILABLE, got %s", result.Status)
 	}
 }
+
+func TestOrderWorkflow_HoldsShippingUntilPaymentClears(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID:     "txn-789",
+		Status:            "APPROVED",
+		PaymentMethodType: "unverified",
+	}, nil)
+
+	shipped := false
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil).
+		Run(func(args mock.Arguments) { shipped = true })
+
+	shippedBeforeClearance := false
+	env.RegisterDelayedCallback(func() {
+		shippedBeforeClearance = shipped
+	}, time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(PaymentClearanceSignal, true)
+	}, time.Hour*2)
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if shippedBeforeClearance {
+		t.Error("Expected shipping to wait for the clearance signal")
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+}
+
+func TestItemsTotal_NoFloatDrift(t *testing.T) {
+	items := []OrderItem{
+		{BookID: "book-1", Quantity: 1, Price: 0.1},
+		{BookID: "book-2", Quantity: 1, Price: 0.2},
+	}
+
+	if floatSum := items[0].Price + items[1].Price; floatSum == 0.3 {
+		t.Fatalf("Expected the float sum to drift, got exactly %v", floatSum)
+	}
+
+	if total := itemsTotal(items); total != 30 {
+		t.Errorf("Expected 30 cents, got %d", total)
+	}
+}
+
+func TestOrderWorkflow_ChargesExactItemTotal(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	items := []OrderItem{
+		{BookID: "book-1", Title: "The Maltese Falcon", Quantity: 1, Price: 0.1},
+		{BookID: "book-2", Title: "In Cold Blood", Quantity: 1, Price: 0.2},
+	}
+
+	env.OnActivity(ValidateInventory, mock.Anything, items).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// 0.1 + 0.2 is 0.30000000000000004 in float64; the charge must be exactly 0.30
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     0.3,
+	}).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil).Once()
+
+	request := OrderRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Items:      items,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_PersistsAuditTrail(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+
+	var persisted []OrderEvent
+	env.OnActivity(PersistOrderAudit, mock.Anything, "order-123", mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { persisted = args.Get(2).([]OrderEvent) }).Once()
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	expected := []string{"ORDER_RECEIVED", "INVENTORY_RESERVED", "PAYMENT_APPROVED", "SHIPPED"}
+	if len(persisted) != len(expected) {
+		t.Fatalf("Expected %d persisted events, got %d", len(expected), len(persisted))
+	}
+	for i, eventType := range expected {
+		if persisted[i].Type != eventType {
+			t.Errorf("Expected event %d to be %s, got %s", i, eventType, persisted[i].Type)
+		}
+	}
+
+	if len(result.Events) != len(persisted) {
+		t.Errorf("Expected result to carry %d events, got %d", len(persisted), len(result.Events))
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_PersistsAuditTrailOnCancel(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(
+		func(ctx workflow.Context, request PaymentRequest) (*PaymentResult, error) {
+			if err := workflow.Sleep(ctx, time.Hour*2); err != nil {
+				return nil, err
+			}
+			return &PaymentResult{TransactionID: "txn-789", Status: "APPROVED"}, nil
+		})
+	env.OnActivity(PersistOrderAudit, mock.Anything, "order-123", mock.Anything).Return(nil).Once()
+
+	// Cancel while the payment is still processing
+	env.RegisterDelayedCallback(func() {
+		env.CancelWorkflow()
+	}, time.Hour)
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	if env.GetWorkflowError() == nil {
+		t.Fatal("Expected the cancelled order to return an error")
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_ManualApproval(t *testing.T) {
+	tests := []struct {
+		name      string
+		approved  bool
+		status    string
+		captured  bool
+		voided    bool
+		shipLabel string
+	}{
+		{"approve captures and ships", true, "COMPLETED", true, false, "TRK-123"},
+		{"reject voids the authorization", false, "REJECTED", false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			noOrderCheckpoint(env)
+			noOrderCheckpoint(env)
+
+			env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+			env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnWorkflow(PaymentWorkflow, mock.Anything, PaymentRequest{
+				OrderID:       "order-123",
+				CustomerID:    "customer-456",
+				Amount:        2500.00,
+				AuthorizeOnly: true,
+			}).Return(&PaymentResult{TransactionID: "AUTH-789", Status: "AUTHORIZED"}, nil)
+
+			captured, voided := false, false
+			env.OnActivity(CapturePayment, mock.Anything, "AUTH-789", 2500.00).Return(&ChargeResult{TransactionID: "TXN-789"}, nil).
+				Run(func(args mock.Arguments) { captured = true })
+			env.OnActivity(VoidPayment, mock.Anything, "AUTH-789").Return(nil).
+				Run(func(args mock.Arguments) { voided = true })
+			env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+			env.OnActivity(ReleaseInventory, mock.Anything, mock.Anything).Return(nil)
+
+			env.RegisterDelayedCallback(func() {
+				env.SignalWorkflow(OrderApprovalSignal, tt.approved)
+			}, time.Hour)
+
+			request := OrderRequest{
+				OrderID:               "order-123",
+				CustomerID:            "customer-456",
+				Items:                 []OrderItem{},
+				TotalAmount:           2500.00,
+				RequireManualApproval: true,
+			}
+
+			env.ExecuteWorkflow(OrderWorkflow, request)
+
+			var result OrderResult
+			err := env.GetWorkflowResult(&result)
+
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+
+			if captured != tt.captured {
+				t.Errorf("Expected captured=%v, got %v", tt.captured, captured)
+			}
+
+			if voided != tt.voided {
+				t.Errorf("Expected voided=%v, got %v", tt.voided, voided)
+			}
+
+			if result.ShippingLabel != tt.shipLabel {
+				t.Errorf("Expected shipping label %q, got %q", tt.shipLabel, result.ShippingLabel)
+			}
+		})
+	}
+}
+
+func TestOrderWorkflow_CancelDuringApprovalVoids(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{TransactionID: "AUTH-789", Status: "AUTHORIZED"}, nil)
+
+	env.OnActivity(VoidPayment, mock.Anything, "AUTH-789").Return(nil).Once()
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+	env.OnActivity(CapturePayment, mock.Anything, mock.Anything, mock.Anything).Return(&ChargeResult{}, nil).Never()
+	env.OnActivity(GenerateShippingLabel, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ShippingResult{}, nil).Never()
+
+	// The order is cancelled while it waits for an approval that never comes
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(CancelOrderSignal, nil)
+	}, time.Hour)
+
+	request := OrderRequest{
+		OrderID:               "order-123",
+		CustomerID:            "customer-456",
+		Items:                 []OrderItem{},
+		TotalAmount:           2500.00,
+		RequireManualApproval: true,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "CANCELLED" {
+		t.Errorf("Expected status CANCELLED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+// noOrderCheckpoint mocks the checkpoint store for an order with no earlier runs
+func noOrderCheckpoint(env *testsuite.TestWorkflowEnvironment) {
+	env.OnActivity(activities.GetOrderCheckpoint, mock.Anything, mock.Anything).Return(&OrderCheckpoint{}, nil)
+	env.OnActivity(activities.SaveOrderCheckpoint, mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
+func TestOrderWorkflow_RecoversChargeFromCheckpoint(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	// A previous run crashed after charging but before shipping
+	env.OnActivity(activities.GetOrderCheckpoint, mock.Anything, "order-123").Return(&OrderCheckpoint{
+		OrderID:           "order-123",
+		PaymentID:         "txn-789",
+		PaymentMethodType: "card",
+	}, nil)
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{}, nil).Never()
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil).Once()
+
+	var saved OrderCheckpoint
+	env.OnActivity(activities.SaveOrderCheckpoint, mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { saved = args.Get(1).(OrderCheckpoint) })
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+
+	if result.PaymentID != "txn-789" {
+		t.Errorf("Expected the checkpointed payment txn-789, got %s", result.PaymentID)
+	}
+
+	if saved.PaymentID != "txn-789" || saved.ShippingLabel != "TRK-123" {
+		t.Errorf("Expected the checkpoint to keep the payment and record the label, got %+v", saved)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_RunsBeforeCheckpointingSkipCheckpoints(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	// A run started before checkpointing existed replays as the default version
+	env.OnGetVersion(orderCheckpointChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+
+	env.AssertActivityNotCalled(t, "GetOrderCheckpoint", mock.Anything, mock.Anything)
+	env.AssertActivityNotCalled(t, "SaveOrderCheckpoint", mock.Anything, mock.Anything)
+}
+
+func TestOrderWorkflow_CapturesPerShipment(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, PaymentRequest{
+		OrderID:       "order-123",
+		CustomerID:    "customer-456",
+		Amount:        64.97,
+		AuthorizeOnly: true,
+	}).Return(&PaymentResult{TransactionID: "AUTH-789", Status: "AUTHORIZED"}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123-1", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-1"}, nil).Once()
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123-2", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-2"}, nil).Once()
+
+	var captures []float64
+	env.OnActivity(CapturePayment, mock.Anything, "AUTH-789", mock.Anything).Return(&ChargeResult{TransactionID: "TXN-789"}, nil).
+		Run(func(args mock.Arguments) { captures = append(captures, args.Get(2).(float64)) })
+
+	first := OrderItem{BookID: "BOOK-1", Title: "Test Book", Quantity: 2, Price: 24.99}
+	second := OrderItem{BookID: "BOOK-2", Title: "Backordered Book", Quantity: 1, Price: 14.99}
+	request := OrderRequest{
+		OrderID:           "order-123",
+		CustomerID:        "customer-456",
+		Items:             []OrderItem{first, second},
+		ChargePerShipment: true,
+		Shipments: []Shipment{
+			{ShipmentID: "order-123-1", Items: []OrderItem{first}},
+			{ShipmentID: "order-123-2", Items: []OrderItem{second}},
+		},
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected status COMPLETED, got %s", result.Status)
+	}
+
+	if len(captures) != 2 || captures[0] != 49.98 || captures[1] != 14.99 {
+		t.Fatalf("Expected captures of 49.98 then 14.99, got %v", captures)
+	}
+
+	if total := toCents(captures[0]) + toCents(captures[1]); total != toCents(64.97) {
+		t.Errorf("Expected captures to sum to the order total 64.97, got %v", total.Float64())
+	}
+
+	if strings.Join(result.ShipmentLabels, ",") != "TRK-1,TRK-2" || result.ShippingLabel != "TRK-2" {
+		t.Errorf("Expected labels TRK-1,TRK-2 with TRK-2 last, got %v / %s", result.ShipmentLabels, result.ShippingLabel)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_DeadLettersFailedWebhook(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+
+	// The partner endpoint is down for good
+	attempts := 0
+	env.OnActivity(SendOrderWebhook, mock.Anything, "https://partner.example.com/orders", mock.Anything).
+		Return(errors.New("503 Service Unavailable")).
+		Run(func(args mock.Arguments) { attempts++ })
+
+	var deadLetter WebhookDeadLetter
+	env.OnActivity(RecordWebhookDeadLetter, mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { deadLetter = args.Get(1).(WebhookDeadLetter) }).Once()
+
+	request := OrderRequest{
+		OrderID:            "order-123",
+		CustomerID:         "customer-456",
+		Items:              []OrderItem{},
+		TotalAmount:        99.99,
+		WebhookURL:         "https://partner.example.com/orders",
+		WebhookMaxAttempts: 3,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "COMPLETED" {
+		t.Errorf("Expected the order to complete despite the webhook, got %s", result.Status)
+	}
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 delivery attempts, got %d", attempts)
+	}
+
+	if deadLetter.Payload.OrderID != "order-123" || deadLetter.URL != "https://partner.example.com/orders" {
+		t.Errorf("Expected a dead letter for order-123, got %+v", deadLetter)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_ShippingFailureIsTyped(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true, ReservationID: "RES-1"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(nil, errors.New("carrier unavailable"))
+	env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil)
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil)
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Expected a FAILED result rather than an error, got %v", err)
+	}
+	if result.Status != "FAILED" || result.Failure == nil {
+		t.Fatalf("Expected a FAILED result with a failure record, got %+v", result)
+	}
+	if result.Failure.ErrorType != ShippingError {
+		t.Errorf("Expected error type %s, got %q", ShippingError, result.Failure.ErrorType)
+	}
+	if !strings.Contains(result.Failure.ErrorMessage, "carrier unavailable") {
+		t.Errorf("Expected the activity failure as the cause, got %q", result.Failure.ErrorMessage)
+	}
+}
+
+func TestOrderWorkflow_FailureRecordsCompensations(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true, ReservationID: "RES-1"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(nil, errors.New("carrier unavailable"))
+	env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil).Once()
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+
+	env.ExecuteWorkflow(OrderWorkflow, OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	})
+
+	var result OrderResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Expected a FAILED result rather than an error, got %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "FAILED" || result.Failure == nil {
+		t.Fatalf("Expected a FAILED result with a failure record, got %+v", result)
+	}
+	expected := OrderFailure{
+		Step:          "shipping",
+		ErrorType:     ShippingError,
+		ErrorMessage:  result.Failure.ErrorMessage,
+		Compensations: []string{"REFUNDED", "INVENTORY_RELEASED"},
+	}
+	if !reflect.DeepEqual(*result.Failure, expected) {
+		t.Errorf("Expected failure %+v, got %+v", expected, *result.Failure)
+	}
+	if result.PaymentID != "txn-789" {
+		t.Errorf("Expected the refunded payment txn-789, got %q", result.PaymentID)
+	}
+	if len(result.Events) == 0 || result.Events[len(result.Events)-1].Type != "FAILED" {
+		t.Errorf("Expected the timeline to end with FAILED, got %+v", result.Events)
+	}
+}
+
+func TestOrderWorkflow_AttemptsEveryCompensation(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(nil, errors.New("carrier unavailable"))
+
+	env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil).Once()
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(errors.New("inventory service down"))
+
+	var persisted []OrderEvent
+	env.OnActivity(PersistOrderAudit, mock.Anything, "order-123", mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { persisted = args.Get(2).([]OrderEvent) })
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	if err := env.GetWorkflowResult(&result); err != nil || result.Status != "FAILED" {
+		t.Fatalf("Expected the shipping failure to fail the order, got %s (%v)", result.Status, err)
+	}
+	if len(result.Failure.FailedCompensations) != 1 || result.Failure.FailedCompensations[0].Name != "INVENTORY_RELEASED" {
+		t.Errorf("Expected the inventory release as the failed compensation, got %+v", result.Failure.FailedCompensations)
+	}
+
+	env.AssertExpectations(t)
+
+	var refunded bool
+	var failure string
+	for _, event := range persisted {
+		switch event.Type {
+		case "REFUNDED":
+			refunded = true
+		case "COMPENSATION_FAILED":
+			failure = event.Detail
+		case "INVENTORY_RELEASED":
+			t.Error("Expected the failed inventory release not to be recorded as done")
+		}
+	}
+
+	if !refunded {
+		t.Error("Expected the refund to succeed despite the inventory release failing")
+	}
+
+	if !strings.HasPrefix(failure, "INVENTORY_RELEASED: ") {
+		t.Errorf("Expected the inventory release failure to be reported, got %q", failure)
+	}
+}
+
+func TestOrderWorkflow_CompensatesCompletedSteps(t *testing.T) {
+	tests := []struct {
+		name          string
+		inventory     *InventoryResult
+		inventoryErr  error
+		payment       *PaymentResult
+		paymentErr    error
+		shippingErr   error
+		compensations []string
+	}{
+		{
+			name:         "inventory failure has nothing to undo",
+			inventoryErr: errors.New("inventory service down"),
+		},
+		{
+			name:          "payment failure releases inventory",
+			inventory:     &InventoryResult{Available: true, ReservationID: "RES-1"},
+			paymentErr:    errors.New("gateway timeout"),
+			compensations: []string{"INVENTORY_RELEASED"},
+		},
+		{
+			name:          "declined payment releases inventory",
+			inventory:     &InventoryResult{Available: true, ReservationID: "RES-1"},
+			payment:       &PaymentResult{TransactionID: "txn-789", Status: "DECLINED"},
+			compensations: []string{"INVENTORY_RELEASED"},
+		},
+		{
+			name:          "shipping failure refunds then releases inventory",
+			inventory:     &InventoryResult{Available: true, ReservationID: "RES-1"},
+			payment:       &PaymentResult{TransactionID: "txn-789", Status: "APPROVED"},
+			shippingErr:   errors.New("carrier unavailable"),
+			compensations: []string{"REFUNDED", "INVENTORY_RELEASED"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			noOrderCheckpoint(env)
+
+			env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(tt.inventory, tt.inventoryErr)
+			env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(tt.payment, tt.paymentErr)
+			env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(nil, tt.shippingErr)
+
+			// The refund and release run concurrently
+			var mu sync.Mutex
+			var ran []string
+			env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil).
+				Run(func(args mock.Arguments) { mu.Lock(); ran = append(ran, "REFUNDED"); mu.Unlock() })
+			env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).
+				Run(func(args mock.Arguments) { mu.Lock(); ran = append(ran, "INVENTORY_RELEASED"); mu.Unlock() })
+
+			var persisted []OrderEvent
+			env.OnActivity(PersistOrderAudit, mock.Anything, "order-123", mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { persisted = args.Get(2).([]OrderEvent) })
+
+			request := OrderRequest{
+				OrderID:     "order-123",
+				CustomerID:  "customer-456",
+				Items:       []OrderItem{},
+				TotalAmount: 99.99,
+			}
+
+			env.ExecuteWorkflow(OrderWorkflow, request)
+
+			var result OrderResult
+			if err := env.GetWorkflowResult(&result); err == nil && result.Status == "COMPLETED" {
+				t.Fatal("Expected the order not to complete")
+			}
+
+			sort.Strings(ran)
+			expected := append([]string(nil), tt.compensations...)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(ran, expected) {
+				t.Errorf("Expected compensations %v, got %v", tt.compensations, ran)
+			}
+
+			var recorded []string
+			for _, event := range persisted {
+				if event.Type == "REFUNDED" || event.Type == "INVENTORY_RELEASED" {
+					recorded = append(recorded, event.Type)
+				}
+			}
+			if !reflect.DeepEqual(recorded, tt.compensations) {
+				t.Errorf("Expected compensation events %v, got %v", tt.compensations, recorded)
+			}
+		})
+	}
+}
+
+func TestOrderWorkflow_RunsCompensationsConcurrently(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		version        workflow.Version
+		elapsed        time.Duration // Time spent compensating
+	}{
+		{"together by default", 0, 1, time.Minute},
+		{"one at a time when capped", 1, 1, 2 * time.Minute},
+		{"one at a time in older runs", 0, workflow.DefaultVersion, 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.SetStartTime(start)
+			noOrderCheckpoint(env)
+
+			env.OnGetVersion(orderConcurrentCompensationChange, workflow.DefaultVersion, 1).Return(tt.version)
+			env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true, ReservationID: "RES-1"}, nil)
+			env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{TransactionID: "txn-789", Status: "APPROVED"}, nil)
+			env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(nil, errors.New("carrier unavailable"))
+			env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil).After(time.Minute).Once()
+			env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).After(time.Minute).Once()
+
+			env.ExecuteWorkflow(OrderWorkflow, OrderRequest{
+				OrderID:                    "order-123",
+				CustomerID:                 "customer-456",
+				Items:                      []OrderItem{},
+				TotalAmount:                99.99,
+				MaxConcurrentCompensations: tt.maxConcurrency,
+			})
+
+			var result OrderResult
+			if err := env.GetWorkflowResult(&result); err != nil || result.Status != "FAILED" {
+				t.Fatalf("Expected the shipping failure to fail the order, got %s (%v)", result.Status, err)
+			}
+			if !reflect.DeepEqual(result.Failure.Compensations, []string{"REFUNDED", "INVENTORY_RELEASED"}) {
+				t.Errorf("Expected both compensations, newest first, got %v", result.Failure.Compensations)
+			}
+			// Shipping retries take seconds; each compensation takes a minute
+			if elapsed := env.Now().Sub(start); elapsed < tt.elapsed || elapsed >= tt.elapsed+time.Minute {
+				t.Errorf("Expected compensating to take %v, got %v in all", tt.elapsed, elapsed)
+			}
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderWorkflow_AbortsExpiredReservation(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		paymentDelay  time.Duration
+		reservedUntil time.Time
+		charged       bool
+	}{
+		{"expired before payment", 0, start.Add(-time.Minute), false},
+		{"expired during payment", 2 * time.Hour, start.Add(time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			env.SetStartTime(start)
+			noOrderCheckpoint(env)
+
+			env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+				Available:     true,
+				ReservationID: "RES-1",
+				ReservedUntil: tt.reservedUntil,
+			}, nil)
+			env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			payment := env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+				TransactionID: "txn-789",
+				Status:        "APPROVED",
+			}, nil).After(tt.paymentDelay)
+			refund := env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil)
+			if tt.charged {
+				refund.Once()
+			} else {
+				payment.Never()
+				refund.Never()
+			}
+			env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+			env.OnActivity(GenerateShippingLabel, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ShippingResult{}, nil).Never()
+
+			request := OrderRequest{
+				OrderID:     "order-123",
+				CustomerID:  "customer-456",
+				Items:       []OrderItem{},
+				TotalAmount: 99.99,
+			}
+
+			env.ExecuteWorkflow(OrderWorkflow, request)
+
+			var result OrderResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != "RESERVATION_EXPIRED" {
+				t.Errorf("Expected status RESERVATION_EXPIRED, got %s", result.Status)
+			}
+
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOrderWorkflow_CancelDuringPaymentRefunds(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// The charge goes through after the customer has already cancelled
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil).After(time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(CancelOrderSignal, nil)
+	}, time.Minute*30)
+
+	env.OnActivity(RefundPayment, mock.Anything, "txn-789").Return(nil).Once()
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+	env.OnActivity(GenerateShippingLabel, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ShippingResult{}, nil).Never()
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "CANCELLED" {
+		t.Errorf("Expected status CANCELLED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_CancelBeforePaymentSkipsRefund(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil).After(time.Hour)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(CancelOrderSignal, nil)
+	}, time.Minute*30)
+
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{}, nil).Never()
+	env.OnActivity(RefundPayment, mock.Anything, mock.Anything).Return(nil).Never()
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "CANCELLED" {
+		t.Errorf("Expected status CANCELLED, got %s", result.Status)
+	}
+
+	if result.PaymentID != "" {
+		t.Errorf("Expected no payment for an order cancelled before charging, got %s", result.PaymentID)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_CancelVoidsInFlightCharge(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(PaymentWorkflow)
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{
+		Available:     true,
+		ReservationID: "RES-1",
+	}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+	env.OnActivity(CheckFraud, mock.Anything, mock.Anything).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
+
+	// The order is cancelled while the gateway is still processing the charge
+	env.OnActivity(ChargePaymentMethod, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-789"}, nil).After(time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(CancelOrderSignal, nil)
+	}, time.Minute*30)
+
+	env.OnActivity(VoidPayment, mock.Anything, "txn-789").Return(nil).Once()
+	env.OnActivity(ReleaseInventory, mock.Anything, "RES-1").Return(nil).Once()
+	env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, mock.Anything).Return(nil).Never()
+	env.OnActivity(RefundPayment, mock.Anything, mock.Anything).Return(nil).Never()
+	env.OnActivity(GenerateShippingLabel, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ShippingResult{}, nil).Never()
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	var result OrderResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "CANCELLED" {
+		t.Errorf("Expected status CANCELLED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderWorkflow_StatusQuery(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, mock.Anything).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+
+	// The carrier is slow, leaving the order in the shipping step for an hour
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil).After(time.Hour)
+
+	var status OrderStatus
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(OrderStatusQuery)
+		if err != nil {
+			t.Errorf("Query failed: %v", err)
+			return
+		}
+		if err := value.Get(&status); err != nil {
+			t.Errorf("Decoding status failed: %v", err)
+		}
+	}, time.Minute*30)
+
+	request := OrderRequest{
+		OrderID:     "order-123",
+		CustomerID:  "customer-456",
+		Items:       []OrderItem{},
+		TotalAmount: 99.99,
+	}
+
+	env.ExecuteWorkflow(OrderWorkflow, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if status.Step != "shipping" {
+		t.Errorf("Expected step shipping, got %q", status.Step)
+	}
+
+	if status.PaymentID != "txn-789" {
+		t.Errorf("Expected payment ID txn-789, got %q", status.PaymentID)
+	}
+
+	if status.UpdatedAt.IsZero() {
+		t.Error("Expected the last transition time to be set")
+	}
+
+	value, err := env.QueryWorkflow(OrderStatusQuery)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if err := value.Get(&status); err != nil {
+		t.Fatalf("Decoding status failed: %v", err)
+	}
+	if status.Step != "done" {
+		t.Errorf("Expected step done after completion, got %q", status.Step)
+	}
+}
+
+func TestOrderWorkflow_ArchivesFinalResult(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	noOrderCheckpoint(env)
+
+	env.OnActivity(ValidateInventory, mock.Anything, []OrderItem{}).Return(&InventoryResult{Available: true}, nil)
+	env.OnActivity(GenerateShippingLabel, mock.Anything, "order-123", mock.Anything, mock.Anything).Return(&ShippingResult{TrackingNumber: "TRK-123"}, nil)
+	env.OnActivity(PersistOrderAudit, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.ArchiveOrder, mock.Anything, mock.MatchedBy(func(result OrderResult) bool {
+		return result.OrderID == "order-123" &&
+			result.Status == "COMPLETED" &&
+			result.PaymentID == "txn-789" &&
+			result.ShippingLabel == "TRK-123" &&
+			len(result.Events) > 0
+	})).Return(nil).Once()
+
+	env.OnWorkflow(PaymentWorkflow, mock.Anything, mock.Anything).Return(&PaymentResult{
+		TransactionID: "txn-789",
+		Status:        "APPROVED",
+	}, nil)
+
+	env.ExecuteWorkflow(OrderWorkflow, OrderRequest{
+		OrderID:        "order-123",
+		CustomerID:     "customer-456",
+		Items:          []OrderItem{},
+		TotalAmount:    99.99,
+		ArchiveResults: true,
+	})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+}
+
+type recordingOrderArchive struct {
+	orders []ArchivedOrder
+}
+
+func (a *recordingOrderArchive) Put(ctx context.Context, order ArchivedOrder) error {
+	a.orders = append(a.orders, order)
+	return nil
+}
+
+func TestArchiveOrder_AppliesRetention(t *testing.T) {
+	archive := &recordingOrderArchive{}
+	a := NewActivities(WorkerConfig{OrderArchiveRetention: 90 * 24 * time.Hour})
+	a.OrderArchive = archive
+
+	if err := a.ArchiveOrder(context.Background(), OrderResult{OrderID: "order-123", Status: "COMPLETED"}); err != nil {
+		t.Fatalf("ArchiveOrder failed: %v", err)
+	}
+
+	if len(archive.orders) != 1 {
+		t.Fatalf("Expected 1 archived order, got %d", len(archive.orders))
+	}
+	order := archive.orders[0]
+	if order.Result.OrderID != "order-123" {
+		t.Errorf("Expected order-123 archived, got %q", order.Result.OrderID)
+	}
+	if got := order.RetainUntil.Sub(order.ArchivedAt); got != 90*24*time.Hour {
+		t.Errorf("Expected retention %v, got %v", 90*24*time.Hour, got)
+	}
+}
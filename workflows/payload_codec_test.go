@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"bytes"
+	"testing"
+
+	commonpb "go.temporal.io/api/common/v1"
+)
+
+func TestAESPayloadCodec_RoundTrip(t *testing.T) {
+	codec, err := NewAESPayloadCodec("payments-2024-01", bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("Creating codec failed: %v", err)
+	}
+
+	original := &commonpb.Payload{
+		Metadata: map[string][]byte{"encoding": []byte("json/plain")},
+		Data:     []byte(`{"OrderID":"order-123","CustomerID":"customer-456"}`),
+	}
+
+	encoded, err := codec.Encode([]*commonpb.Payload{original})
+	if err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+
+	if bytes.Contains(encoded[0].Data, []byte("customer-456")) {
+		t.Error("Expected the encoded payload not to contain the customer ID in plaintext")
+	}
+
+	if string(encoded[0].Metadata["encoding"]) != "binary/encrypted" {
+		t.Errorf("Expected encoding binary/encrypted, got %s", encoded[0].Metadata["encoding"])
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decoding failed: %v", err)
+	}
+
+	if !bytes.Equal(decoded[0].Data, original.Data) {
+		t.Errorf("Expected decoded data %s, got %s", original.Data, decoded[0].Data)
+	}
+
+	if string(decoded[0].Metadata["encoding"]) != "json/plain" {
+		t.Errorf("Expected the original encoding json/plain, got %s", decoded[0].Metadata["encoding"])
+	}
+
+	// A codec holding a different key must refuse rather than return garbage
+	other, _ := NewAESPayloadCodec("payments-2024-02", bytes.Repeat([]byte{0x17}, 32))
+	if _, err := other.Decode(encoded); err == nil {
+		t.Error("Expected decoding with another key to fail")
+	}
+}
+
+func TestNewAESPayloadCodec_RejectsBadKey(t *testing.T) {
+	if _, err := NewAESPayloadCodec("payments", []byte("too-short")); err == nil {
+		t.Error("Expected a 9 byte key to be rejected")
+	}
+
+	if _, err := clientOptions(WorkerConfig{PayloadEncryptionKey: bytes.Repeat([]byte{1}, 32)}); err == nil {
+		t.Error("Expected a key without an ID to be rejected")
+	}
+}
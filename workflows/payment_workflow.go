@@ -1,7 +1,9 @@
 package workflows
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.temporal.io/sdk/temporal"
@@ -9,51 +11,292 @@ import (
 )
 
 type PaymentRequest struct {
-	OrderID    string
-	CustomerID string
-	Amount     float64
-	Currency   string
+	OrderID         string
+	CustomerID      string
+	Amount          float64
+	Currency        string
+	TrustedCustomer bool          // Deprecated: V2 looks trust up with CheckTrustStatus; only runs started before that read it
+	PaymentMethod   PaymentMethod // Empty charges the customer's default method
+	AuthorizeOnly   bool          // PaymentWorkflow only; hold the funds for a later CapturePayment or VoidPayment
+
+	// IdempotencyKey is set by PaymentWorkflowV2 for each charge, so
+	// ChargePaymentMethodV2 retries return the first charge rather than
+	// charging again
+	IdempotencyKey string
+
+	// MaxPaymentMethodSwaps is how many times PaymentWorkflowV2 accepts a
+	// new method through UpdatePaymentMethodSignal after a decline
+	MaxPaymentMethodSwaps int
+
+	// Installments splits a PaymentWorkflowV2 charge into this many equal
+	// charges, the first also taking any remainder cents. Zero or one
+	// charges the whole amount at once.
+	Installments int
+
+	// Velocity is the customer's recent transaction history, checked
+	// against MaxTransactionsPerHour by CheckFraudV2
+	Velocity VelocityContext
+
+	// CardCurrency is the currency the customer's card is charged in, when
+	// it differs from Currency, the order's. PaymentWorkflowV2 converts the
+	// amount with ConvertCurrency before charging.
+	CardCurrency string
+
+	// RiskThreshold is the fraud risk score above which the payment is
+	// declined, e.g. a stricter one for high-value orders. Zero uses the
+	// workflow's default: 0.8 for CheckFraud scores, 0.75 for CheckFraudV2.
+	RiskThreshold float64
+
+	// ReviewThreshold sends PaymentWorkflowV2 payments scoring above it,
+	// but not above RiskThreshold, to human fraud review instead of
+	// approving them. Zero reviews nothing.
+	ReviewThreshold float64
+	ReviewTimeout   time.Duration // How long to wait for a reviewer before declining; zero uses defaultFraudReviewTimeout
+
+	// ChallengeThreshold has PaymentWorkflowV2 ask the customer to pass a
+	// 3-D Secure challenge for payments scoring above it, but not above
+	// ReviewThreshold or RiskThreshold, instead of approving them. Zero
+	// challenges nothing.
+	ChallengeThreshold float64
+	ChallengeTimeout   time.Duration // How long to wait for the challenge before declining; zero uses defaultChallengeTimeout
+
+	// SettlementCurrency is the merchant's base currency. PaymentWorkflowV2
+	// converts orders in any other Currency to it before charging, unless
+	// CardCurrency names the currency to charge. Empty uses
+	// DefaultSettlementCurrency.
+	SettlementCurrency string
+}
+
+// DefaultSettlementCurrency is the base currency payments settle in when a
+// request doesn't configure one
+const DefaultSettlementCurrency = "USD"
+
+// chargeCurrency is the currency PaymentWorkflowV2 charges request in
+func chargeCurrency(request PaymentRequest) string {
+	switch {
+	case request.CardCurrency != "":
+		return request.CardCurrency
+	case request.SettlementCurrency != "":
+		return request.SettlementCurrency
+	}
+	return DefaultSettlementCurrency
+}
+
+// VelocityContext counts a customer's transactions in the window before
+// this payment
+type VelocityContext struct {
+	RecentTransactions int
+	Window             time.Duration // Zero means an hour
+}
+
+// PaymentMethod identifies a stored card or account to charge
+type PaymentMethod struct {
+	Type  string // "card", "bank_transfer"
+	Token string // Vault token; raw card details never enter workflow history
+}
+
+// UpdatePaymentMethodSignal is sent to PaymentWorkflowV2 with a new
+// PaymentMethod to retry the charge with after a decline
+const UpdatePaymentMethodSignal = "update-payment-method"
+
+// AlternatePaymentMethodSignal is sent to PaymentWorkflow with a
+// PaymentMethod to retry a charge that failed for insufficient funds
+const AlternatePaymentMethodSignal = "alternate_payment_method"
+
+// paymentMethodUpdateWindow is how long a declined payment waits for a new
+// payment method before giving up
+const paymentMethodUpdateWindow = time.Minute * 30
+
+// Default risk scores above which fraud check results are declined. V2
+// scores are calibrated against a stricter threshold.
+const (
+	v1RiskThreshold = 0.8
+	v2RiskThreshold = 0.75
+)
+
+// riskThreshold is request's RiskThreshold, or fallback when it has none
+func riskThreshold(request PaymentRequest, fallback float64) float64 {
+	if request.RiskThreshold > 0 {
+		return request.RiskThreshold
+	}
+	return fallback
+}
+
+// trustedFraudCheckLimit is the amount, in trustedFraudCheckCurrency, below
+// which PaymentWorkflowV2 skips the fraud check for trusted customers
+const (
+	trustedFraudCheckLimit    Cents = 100_00
+	trustedFraudCheckCurrency       = "USD"
+)
+
+// paymentTrustStatusChange versions PaymentWorkflowV2's CheckTrustStatus
+// lookup, which replaced trusting the request's TrustedCustomer
+const paymentTrustStatusChange = "payment-trust-status"
+
+// orderCurrency is the currency request.Amount is in. An order without a
+// Currency is in the settlement currency.
+func orderCurrency(request PaymentRequest) string {
+	switch {
+	case request.Currency != "":
+		return request.Currency
+	case request.SettlementCurrency != "":
+		return request.SettlementCurrency
+	}
+	return DefaultSettlementCurrency
+}
+
+// Fraud decisions recorded with RecordFraudDecision
+const (
+	FraudDecisionApproved = "APPROVED"
+	FraudDecisionDeclined = "DECLINED" // Risk score above the threshold
+	FraudDecisionFlagged  = "FLAGGED"  // Within the threshold, but the check raised flags
+	FraudDecisionReview   = "REVIEW"   // Between the review and risk thresholds; a reviewer decides
+
+	// Between the challenge threshold and the review or risk threshold;
+	// the customer's 3-D Secure challenge decides
+	FraudDecisionChallenge = "CHALLENGE"
+)
+
+// FraudReviewDecisionSignal is sent to PaymentWorkflowV2 with a bool to
+// approve (true) or decline (false) a payment queued for fraud review
+const FraudReviewDecisionSignal = "review-decision"
+
+// defaultFraudReviewTimeout is how long a payment waits for a fraud
+// reviewer before it's declined
+const defaultFraudReviewTimeout = time.Hour * 4
+
+// ChallengeResultSignal is sent to PaymentWorkflowV2 with a bool once the
+// customer has passed (true) or failed (false) a 3-D Secure challenge
+const ChallengeResultSignal = "challenge_result"
+
+// defaultChallengeTimeout is how long a payment waits for the customer to
+// complete a 3-D Secure challenge before it's declined
+const defaultChallengeTimeout = time.Minute * 15
+
+// fraudDecision derives the decision for a fraud check from its result
+// alone, so replays always record the same one
+func fraudDecision(result FraudCheckResult, riskThreshold float64) string {
+	switch {
+	case result.RiskScore > riskThreshold:
+		return FraudDecisionDeclined
+	case len(result.Flags) > 0:
+		return FraudDecisionFlagged
+	default:
+		return FraudDecisionApproved
+	}
+}
+
+// recordFraudDecision writes the compliance record of a fraud decision. No
+// payment may go on without one, so the write is retried until it lands;
+// only a record the log rejects fails at once.
+func recordFraudDecision(ctx workflow.Context, request PaymentRequest, result FraudCheckResult, decision string) error {
+	recordCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:        time.Second,
+			BackoffCoefficient:     2.0,
+			MaximumInterval:        time.Minute * 5,
+			NonRetryableErrorTypes: []string{InvalidFraudRecordError},
+		},
+	})
+	err := workflow.ExecuteActivity(recordCtx, RecordFraudDecision, request, result, decision).Get(ctx, nil)
+	if err != nil {
+		workflow.GetLogger(ctx).Error("Recording fraud decision failed",
+			"orderID", request.OrderID,
+			"decision", decision,
+			"error", err)
+		return workflowError(FraudRecordError, "recording fraud decision", err)
+	}
+	return nil
 }
 
 type PaymentResult struct {
-	TransactionID string
-	Status        string
-	ProcessedAt   time.Time
-	ErrorMessage  string
+	TransactionID     string
+	Status            string
+	PaymentMethodType string
+	ProcessedAt       time.Time
+	ErrorMessage      string
+	DeclineReason     string   // "INVALID_CARD", "FRAUD_RISK", or both comma-separated
+	Metadata          []string // Processing markers, e.g. "FRAUD_CHECK_SKIPPED"
+
+	// PaymentWorkflowV2 only: the order's amount and the amount sent to the
+	// gateway. They differ when the card's currency needed converting.
+	OriginalAmount   float64
+	OriginalCurrency string
+	ChargedAmount    float64
+	ChargedCurrency  string
+
+	// TransactionIDs are an installment payment's charges in order.
+	// TransactionID is the first of them.
+	TransactionIDs []string
 }
 
+// Payment method types whose funds can still be reversed after the charge,
+// so shipment is held until the payment clears
+var clearanceHoldMethods = map[string]bool{
+	"bank_transfer": true,
+	"unverified":    true,
+}
+
+// HoldForClearance reports whether fulfillment must wait for the payment to clear
+func HoldForClearance(result PaymentResult) bool {
+	return clearanceHoldMethods[result.PaymentMethodType]
+}
+
+// paymentActivityOptions is the retry policy for payment operations.
+// Per EstimateMaxDuration, one activity can take up to 10m30s with retries.
+// WARNING: MaximumAttempts of 5 may cause duplicate charges if not idempotent
+var paymentActivityOptions = workflow.ActivityOptions{
+	StartToCloseTimeout: time.Minute * 2,
+	HeartbeatTimeout:    time.Second * 30,
+	RetryPolicy:         defaultRetryPolicy(RetryPolicyPayment),
+}
+
+// paymentFraudFlagChange versions PaymentWorkflow's FlagPaymentFraudV2
+// lookup, which runs an EvaluateFeatureFlag activity before the fraud check
+const paymentFraudFlagChange = "payment-fraud-flag"
+
 // PaymentWorkflow handles payment processing with fraud detection.
 //
 // DEPRECATED: Use PaymentWorkflowV2 for new integrations.
 // This workflow will be removed in v3.0.
 //
-// Retry Policy Configuration:
-//   - InitialInterval: 2 seconds (NOTE: differs from OrderWorkflow's 1 second)
+// Retry Policy Configuration: defaultRetryPolicy(RetryPolicyPayment)
+//   - InitialInterval: 2 seconds (OrderWorkflow's is 1 second)
 //   - BackoffCoefficient: 2.0
 //   - MaximumInterval: 30 seconds
 //   - MaximumAttempts: 5
+//
+// A charge that fails with InsufficientFundsError waits for an
+// AlternatePaymentMethodSignal and is retried once with that method.
+//
+// Cancelling the workflow stops it before the charge, or voids a charge or
+// authorization that was in flight, and returns Status "CANCELLED".
 func PaymentWorkflow(ctx workflow.Context, request PaymentRequest) (*PaymentResult, error) {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("Starting payment workflow", "orderID", request.OrderID, "amount", request.Amount)
 
-	// Activity options with specific retry policy for payment operations
-	// WARNING: MaximumAttempts of 5 may cause duplicate charges if not idempotent
-	activityOptions := workflow.ActivityOptions{
-		StartToCloseTimeout: time.Minute * 2,
-		HeartbeatTimeout:    time.Second * 30,
-		RetryPolicy: &temporal.RetryPolicy{
-			InitialInterval:        time.Second * 2,
-			BackoffCoefficient:     2.0,
-			MaximumInterval:        time.Second * 30,
-			MaximumAttempts:        5,
-			NonRetryableErrorTypes: []string{"FraudDetectedError", "InsufficientFundsError"},
-		},
+	// Round to the currency's minor units before anything is charged
+	request.Amount = roundToMinorUnits(request.Amount, currencyMinorUnits(orderCurrency(request)))
+
+	ctx = workflow.WithActivityOptions(ctx, paymentActivityOptions)
+
+	// Step 1: Run fraud detection. Runs started before the fraud check flag
+	// existed never evaluated it, so on replay they keep CheckFraud.
+	fraudCheck, threshold := CheckFraud, v1RiskThreshold
+	if workflow.GetVersion(ctx, paymentFraudFlagChange, workflow.DefaultVersion, 1) == 1 {
+		flags := newFeatureFlags(ctx, request.CustomerID)
+		if flags.Enabled(FlagPaymentFraudV2) {
+			fraudCheck, threshold = CheckFraudV2, v2RiskThreshold
+		}
 	}
-	ctx = workflow.WithActivityOptions(ctx, activityOptions)
 
-	// Step 1: Run fraud detection
 	var fraudResult FraudCheckResult
-	err := workflow.ExecuteActivity(ctx, CheckFraud, request).Get(ctx, &fraudResult)
+	err := workflow.ExecuteActivity(ctx, fraudCheck, request).Get(ctx, &fraudResult)
+	if ctx.Err() != nil {
+		logger.Info("Payment cancelled before charging", "orderID", request.OrderID)
+		return &PaymentResult{Status: "CANCELLED"}, nil
+	}
 	if err != nil {
 		return &PaymentResult{
 			Status:       "FRAUD_CHECK_FAILED",
@@ -61,7 +304,12 @@ func PaymentWorkflow(ctx workflow.Context, request PaymentRequest) (*PaymentResu
 		}, nil
 	}
 
-	if fraudResult.RiskScore > 0.8 {
+	decision := fraudDecision(fraudResult, riskThreshold(request, threshold))
+	if err := recordFraudDecision(ctx, request, fraudResult, decision); err != nil {
+		return nil, err
+	}
+
+	if decision == FraudDecisionDeclined {
 		logger.Warn("High fraud risk detected", "score", fraudResult.RiskScore)
 		return &PaymentResult{
 			Status:       "FRAUD_SUSPECTED",
@@ -69,9 +317,38 @@ func PaymentWorkflow(ctx workflow.Context, request PaymentRequest) (*PaymentResu
 		}, nil
 	}
 
-	// Step 2: Charge payment method
+	// Step 2: Charge payment method. Orders held for review only authorize
+	// it here and capture once approved, so no confirmation is sent yet.
+	charge := ChargePaymentMethod
+	if request.AuthorizeOnly {
+		charge = AuthorizePayment
+	}
+
+	// A cancel mustn't abandon a charge mid-flight with its outcome unknown,
+	// so the charge runs to completion and is voided if it was cancelled
+	chargeCtx, _ := workflow.NewDisconnectedContext(ctx)
 	var chargeResult ChargeResult
-	err = workflow.ExecuteActivity(ctx, ChargePaymentMethod, request).Get(ctx, &chargeResult)
+	err = workflow.ExecuteActivity(chargeCtx, charge, request).Get(chargeCtx, &chargeResult)
+
+	// Insufficient funds is worth one more try if the customer can pay
+	// another way
+	var appErr *temporal.ApplicationError
+	if errors.As(err, &appErr) && appErr.Type() == InsufficientFundsError && ctx.Err() == nil {
+		logger.Info("Insufficient funds, waiting for an alternate payment method", "orderID", request.OrderID)
+		var method PaymentMethod
+		ok, _ := workflow.GetSignalChannel(ctx, AlternatePaymentMethodSignal).ReceiveWithTimeout(ctx, paymentMethodUpdateWindow, &method)
+		if ctx.Err() != nil {
+			logger.Info("Payment cancelled before charging", "orderID", request.OrderID)
+			return &PaymentResult{Status: "CANCELLED"}, nil
+		}
+		if ok {
+			request.PaymentMethod = method
+			err = workflow.ExecuteActivity(chargeCtx, charge, request).Get(chargeCtx, &chargeResult)
+		}
+	}
+	if err == nil && ctx.Err() != nil {
+		return voidCancelledCharge(chargeCtx, chargeResult, request.AuthorizeOnly), nil
+	}
 	if err != nil {
 		logger.Error("Payment charge failed", "error", err)
 		return &PaymentResult{
@@ -80,16 +357,66 @@ func PaymentWorkflow(ctx workflow.Context, request PaymentRequest) (*PaymentResu
 		}, nil
 	}
 
+	if request.AuthorizeOnly {
+		return &PaymentResult{
+			TransactionID:     chargeResult.TransactionID,
+			Status:            "AUTHORIZED",
+			PaymentMethodType: chargeResult.PaymentMethodType,
+			ProcessedAt:       workflow.Now(ctx),
+		}, nil
+	}
+
 	// Step 3: Send confirmation (fire and forget)
-	workflow.ExecuteActivity(ctx, SendPaymentConfirmation, chargeResult.TransactionID)
+	workflow.ExecuteActivity(ctx, activities.SendPaymentConfirmation, chargeResult.TransactionID)
 
 	return &PaymentResult{
-		TransactionID: chargeResult.TransactionID,
-		Status:        "APPROVED",
-		ProcessedAt:   workflow.Now(ctx),
+		TransactionID:     chargeResult.TransactionID,
+		Status:            "APPROVED",
+		PaymentMethodType: chargeResult.PaymentMethodType,
+		ProcessedAt:       workflow.Now(ctx),
 	}, nil
 }
 
+// voidCancelledCharge voids a charge or authorization made after the
+// payment was cancelled. The charge hasn't settled yet, so voiding releases
+// the funds without a refund. If the void fails the payment is returned as
+// taken, so the caller refunds it instead.
+func voidCancelledCharge(ctx workflow.Context, chargeResult ChargeResult, authorizeOnly bool) *PaymentResult {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Payment cancelled during charge, voiding", "transactionID", chargeResult.TransactionID)
+
+	result := &PaymentResult{
+		TransactionID:     chargeResult.TransactionID,
+		Status:            "CANCELLED",
+		PaymentMethodType: chargeResult.PaymentMethodType,
+		ProcessedAt:       workflow.Now(ctx),
+	}
+	if err := workflow.ExecuteActivity(ctx, VoidPayment, chargeResult.TransactionID).Get(ctx, nil); err != nil {
+		logger.Error("Voiding cancelled payment failed", "transactionID", chargeResult.TransactionID, "error", err)
+		result.Status = "APPROVED"
+		if authorizeOnly {
+			result.Status = "AUTHORIZED"
+		}
+	}
+	return result
+}
+
+// paymentAmountPrecisionChange versions PaymentWorkflowV2's
+// ValidateCurrencyAmount check, which runs before anything else
+const paymentAmountPrecisionChange = "payment-amount-precision"
+
+// paymentSpendingLimitChange versions PaymentWorkflowV2's CheckSpendingLimit
+// step after the fraud check
+const paymentSpendingLimitChange = "payment-spending-limit"
+
+// paymentCurrencyConversionChange versions PaymentWorkflowV2's
+// ConvertCurrency step before the balance check
+const paymentCurrencyConversionChange = "payment-currency-conversion"
+
+// paymentBalanceCheckChange versions PaymentWorkflowV2's VerifyBalance
+// check before the charge
+const paymentBalanceCheckChange = "payment-balance-check"
+
 // PaymentWorkflowV2 is the updated payment workflow with improved retry logic.
 // Uses circuit breaker pattern for external payment gateway calls.
 func PaymentWorkflowV2(ctx workflow.Context, request PaymentRequest) (*PaymentResult, error) {
@@ -100,51 +427,389 @@ func PaymentWorkflowV2(ctx workflow.Context, request PaymentRequest) (*PaymentRe
 	activityOptions := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute * 3,
 		HeartbeatTimeout:    time.Second * 45,
-		RetryPolicy: &temporal.RetryPolicy{
-			InitialInterval:        time.Second,
-			BackoffCoefficient:     1.5,
-			MaximumInterval:        time.Second * 15,
-			MaximumAttempts:        3,
-			NonRetryableErrorTypes: []string{"FraudDetectedError", "InsufficientFundsError", "InvalidCardError"},
-		},
+		RetryPolicy:         defaultRetryPolicy(RetryPolicyPaymentV2),
 	}
 	ctx = workflow.WithActivityOptions(ctx, activityOptions)
 
+	// Reject amounts finer than the currency allows, e.g. 100.50 JPY, before
+	// rounding could hide them. Runs started before the check skip it.
+	if workflow.GetVersion(ctx, paymentAmountPrecisionChange, workflow.DefaultVersion, 1) == 1 {
+		var validAmount bool
+		err := workflow.ExecuteActivity(ctx, activities.ValidateCurrencyAmount, request.Amount, request.Currency).Get(ctx, &validAmount)
+		if err != nil {
+			return nil, workflowError(PaymentValidationError, "validating currency amount", err)
+		}
+		if !validAmount {
+			logger.Warn("Amount doesn't match currency precision", "amount", request.Amount, "currency", request.Currency)
+			return &PaymentResult{
+				Status: "INVALID_AMOUNT_PRECISION",
+			}, nil
+		}
+	}
+
+	// Round to the currency's minor units before anything is charged
+	request.Amount = roundToMinorUnits(request.Amount, currencyMinorUnits(orderCurrency(request)))
+
 	// Parallel fraud check and card validation
 	var fraudResult FraudCheckResult
 	var cardValid bool
+	var metadata []string
 
 	selector := workflow.NewSelector(ctx)
+	pending := 0
+	fraudChecked := false
 
-	fraudFuture := workflow.ExecuteActivity(ctx, CheckFraudV2, request)
-	selector.AddFuture(fraudFuture, func(f workflow.Future) {
-		f.Get(ctx, &fraudResult)
-	})
+	// Trusted customers aren't fraud-checked on small purchases. Trust is
+	// looked up rather than taken from the request; payments that started
+	// before the lookup existed keep reading TrustedCustomer on replay.
+	var skipFraudCheck bool
+	if workflow.GetVersion(ctx, paymentTrustStatusChange, workflow.DefaultVersion, 1) == 1 {
+		var trust TrustStatus
+		err := workflow.ExecuteActivity(ctx, activities.CheckTrustStatus, request.CustomerID, request.Amount, orderCurrency(request)).Get(ctx, &trust)
+		if err != nil {
+			// Not knowing only costs a fraud check
+			logger.Warn("Checking trust status failed", "customerID", request.CustomerID, "error", err)
+		}
+		skipFraudCheck = err == nil && trust.SkipFraudCheck
+	} else {
+		skipFraudCheck = request.TrustedCustomer && toCents(request.Amount) < trustedFraudCheckLimit
+	}
+	if skipFraudCheck {
+		logger.Info("Skipping fraud check for trusted customer", "customerID", request.CustomerID)
+		metadata = append(metadata, "FRAUD_CHECK_SKIPPED")
+	} else {
+		fraudChecked = true
+		fraudFuture := workflow.ExecuteActivity(ctx, CheckFraudV2, request)
+		selector.AddFuture(fraudFuture, func(f workflow.Future) {
+			f.Get(ctx, &fraudResult)
+		})
+		pending++
+	}
 
 	cardFuture := workflow.ExecuteActivity(ctx, ValidateCard, request.CustomerID)
 	selector.AddFuture(cardFuture, func(f workflow.Future) {
 		f.Get(ctx, &cardValid)
 	})
+	pending++
 
-	for i := 0; i < 2; i++ {
+	for i := 0; i < pending; i++ {
 		selector.Select(ctx)
 	}
 
-	if !cardValid || fraudResult.RiskScore > 0.75 {
+	fraudDeclined := false
+	if fraudChecked {
+		decision := fraudDecision(fraudResult, riskThreshold(request, v2RiskThreshold))
+		if decision != FraudDecisionDeclined && request.ReviewThreshold > 0 && fraudResult.RiskScore > request.ReviewThreshold {
+			decision = FraudDecisionReview
+		} else if decision != FraudDecisionDeclined && request.ChallengeThreshold > 0 && fraudResult.RiskScore > request.ChallengeThreshold {
+			decision = FraudDecisionChallenge
+		}
+		if err := recordFraudDecision(ctx, request, fraudResult, decision); err != nil {
+			return nil, err
+		}
+
+		// An invalid card is declined anyway, so isn't worth a reviewer's
+		// or the customer's time
+		if (decision == FraudDecisionReview || decision == FraudDecisionChallenge) && cardValid {
+			var marker string
+			if decision == FraudDecisionReview {
+				decision, marker = awaitFraudReview(ctx, request, fraudResult)
+			} else {
+				decision, marker = awaitChallenge(ctx, request)
+			}
+			metadata = append(metadata, marker)
+			if err := recordFraudDecision(ctx, request, fraudResult, decision); err != nil {
+				return nil, err
+			}
+		}
+		fraudDeclined = decision == FraudDecisionDeclined
+	}
+
+	if reason := declineReason(cardValid, fraudDeclined); reason != "" {
 		return &PaymentResult{
-			Status: "DECLINED",
+			Status:        "DECLINED",
+			DeclineReason: reason,
+			Metadata:      metadata,
 		}, nil
 	}
 
+	// Cap fraud exposure at the customer's rolling spending limit. Runs
+	// started before the limit existed skip it.
+	if workflow.GetVersion(ctx, paymentSpendingLimitChange, workflow.DefaultVersion, 1) == 1 {
+		amountCurrency := orderCurrency(request)
+		var limit LimitResult
+		err := workflow.ExecuteActivity(ctx, activities.CheckSpendingLimit, request.CustomerID, request.Amount, amountCurrency).Get(ctx, &limit)
+		if err != nil {
+			return nil, workflowError(PaymentValidationError, "checking spending limit", err)
+		}
+		if !limit.Allowed {
+			logger.Warn("Payment exceeds spending limit",
+				"customerID", request.CustomerID,
+				"amount", request.Amount,
+				"currency", amountCurrency,
+				"spent", limit.Spent,
+				"limit", limit.Limit.Amount)
+			return &PaymentResult{
+				Status:   "SPENDING_LIMIT_EXCEEDED",
+				Metadata: metadata,
+			}, nil
+		}
+	}
+
+	// Charge cross-border orders in the card's currency, and anything else
+	// in the settlement currency. Fraud checks above saw the order amount;
+	// the balance check and charge see the converted one. Orders without a
+	// Currency are taken to be in the settlement currency already, as are
+	// orders in runs that started before conversion.
+	originalAmount, originalCurrency := request.Amount, request.Currency
+	converts := workflow.GetVersion(ctx, paymentCurrencyConversionChange, workflow.DefaultVersion, 1) == 1
+	if target := chargeCurrency(request); converts && request.Currency != "" && !strings.EqualFold(target, request.Currency) {
+		var conversion ConversionResult
+		err := workflow.ExecuteActivity(ctx, activities.ConvertCurrency, request.Amount, request.Currency, target).Get(ctx, &conversion)
+		if err != nil {
+			return nil, workflowError(PaymentValidationError, "converting currency", err)
+		}
+		logger.Info("Converted payment to charge currency",
+			"orderID", request.OrderID,
+			"from", request.Currency,
+			"to", conversion.Currency,
+			"rate", conversion.Rate)
+		request.Amount = conversion.Amount
+		request.Currency = conversion.Currency
+	}
+
+	// Check the balance up front so an underfunded account doesn't turn into
+	// a hard decline on the gateway. Runs started before the check skip it.
+	if workflow.GetVersion(ctx, paymentBalanceCheckChange, workflow.DefaultVersion, 1) == 1 {
+		var sufficientBalance bool
+		err := workflow.ExecuteActivity(ctx, VerifyBalance, request.CustomerID, request.Amount).Get(ctx, &sufficientBalance)
+		if err != nil {
+			return nil, workflowError(PaymentValidationError, "verifying balance", err)
+		}
+		if !sufficientBalance {
+			return &PaymentResult{
+				Status:   "INSUFFICIENT_BALANCE",
+				Metadata: metadata,
+			}, nil
+		}
+	}
+
+	// After a gateway decline the customer can switch to another payment
+	// method without re-entering the order, up to MaxPaymentMethodSwaps times
+	paymentMethods := workflow.GetSignalChannel(ctx, UpdatePaymentMethodSignal)
+	for swaps := 0; ; swaps++ {
+		request.IdempotencyKey = chargeIdempotencyKey(ctx, request.OrderID, swaps)
+		charge := chargeV2
+		if request.Installments > 1 {
+			charge = chargeInstallments
+		}
+		result, err := charge(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		result.Metadata = metadata
+		result.OriginalAmount, result.OriginalCurrency = originalAmount, originalCurrency
+		result.ChargedAmount, result.ChargedCurrency = request.Amount, request.Currency
+		if result.Status != "DECLINED" || swaps >= request.MaxPaymentMethodSwaps {
+			return result, nil
+		}
+
+		logger.Info("Waiting for a new payment method",
+			"orderID", request.OrderID,
+			"declineReason", result.DeclineReason)
+		var method PaymentMethod
+		if ok, _ := paymentMethods.ReceiveWithTimeout(ctx, paymentMethodUpdateWindow, &method); !ok {
+			return result, nil
+		}
+		request.PaymentMethod = method
+	}
+}
+
+// awaitFraudReview queues a borderline payment for review and waits for
+// the reviewer's FraudReviewDecisionSignal. It returns the decision and a
+// metadata marker for how it was reached; payments that can't be queued or
+// aren't reviewed in time are declined.
+func awaitFraudReview(ctx workflow.Context, request PaymentRequest, fraudResult FraudCheckResult) (string, string) {
+	logger := workflow.GetLogger(ctx)
+	if err := workflow.ExecuteActivity(ctx, QueueForReview, request, fraudResult).Get(ctx, nil); err != nil {
+		logger.Error("Queueing payment for fraud review failed", "orderID", request.OrderID, "error", err)
+		return FraudDecisionDeclined, "FRAUD_REVIEW_UNAVAILABLE"
+	}
+
+	timeout := request.ReviewTimeout
+	if timeout <= 0 {
+		timeout = defaultFraudReviewTimeout
+	}
+	logger.Info("Awaiting fraud review", "orderID", request.OrderID, "riskScore", fraudResult.RiskScore, "timeout", timeout)
+
+	var approved bool
+	if ok, _ := workflow.GetSignalChannel(ctx, FraudReviewDecisionSignal).ReceiveWithTimeout(ctx, timeout, &approved); !ok {
+		logger.Warn("Fraud review timed out", "orderID", request.OrderID)
+		return FraudDecisionDeclined, "FRAUD_REVIEW_TIMED_OUT"
+	}
+	if !approved {
+		return FraudDecisionDeclined, "FRAUD_REVIEWED"
+	}
+	return FraudDecisionApproved, "FRAUD_REVIEWED"
+}
+
+// awaitChallenge sends the customer a 3-D Secure challenge and waits for
+// its ChallengeResultSignal. Like awaitFraudReview, it returns the decision
+// and a metadata marker; challenges that can't be sent or aren't completed
+// in time are declined.
+func awaitChallenge(ctx workflow.Context, request PaymentRequest) (string, string) {
+	logger := workflow.GetLogger(ctx)
+	if err := workflow.ExecuteActivity(ctx, Request3DSChallenge, request).Get(ctx, nil); err != nil {
+		logger.Error("Requesting 3-D Secure challenge failed", "orderID", request.OrderID, "error", err)
+		return FraudDecisionDeclined, "CHALLENGE_UNAVAILABLE"
+	}
+
+	timeout := request.ChallengeTimeout
+	if timeout <= 0 {
+		timeout = defaultChallengeTimeout
+	}
+	logger.Info("Awaiting 3-D Secure challenge", "orderID", request.OrderID, "timeout", timeout)
+
+	var passed bool
+	if ok, _ := workflow.GetSignalChannel(ctx, ChallengeResultSignal).ReceiveWithTimeout(ctx, timeout, &passed); !ok {
+		logger.Warn("3-D Secure challenge timed out", "orderID", request.OrderID)
+		return FraudDecisionDeclined, "CHALLENGE_TIMED_OUT"
+	}
+	if !passed {
+		return FraudDecisionDeclined, "CHALLENGE_FAILED"
+	}
+	return FraudDecisionApproved, "CHALLENGE_PASSED"
+}
+
+// chargeIdempotencyKey identifies one charge of this run: the order and run
+// IDs, plus the attempt for charges retried with a new payment method
+func chargeIdempotencyKey(ctx workflow.Context, orderID string, swaps int) string {
+	key := orderID + ":" + workflow.GetInfo(ctx).WorkflowExecution.RunID
+	if swaps > 0 {
+		key = fmt.Sprintf("%s:%d", key, swaps)
+	}
+	return key
+}
+
+// chargeInstallments charges request.Amount as request.Installments
+// separate charges, split by splitCents. When an installment doesn't go
+// through, the ones already taken are refunded so the customer is never
+// left part-charged, and that installment's result or error is returned.
+func chargeInstallments(ctx workflow.Context, request PaymentRequest) (*PaymentResult, error) {
+	logger := workflow.GetLogger(ctx)
+	total := toCents(request.Amount)
+	if total < Cents(request.Installments) {
+		logger.Warn("Amount too small for installments", "amount", request.Amount, "installments", request.Installments)
+		return &PaymentResult{
+			Status: "INVALID_INSTALLMENTS",
+		}, nil
+	}
+
+	var transactionIDs []string
+	var last *PaymentResult
+	for i, amount := range splitCents(total, request.Installments) {
+		installment := request
+		installment.Amount = amount.Float64()
+		installment.IdempotencyKey = fmt.Sprintf("%s:installment-%d", request.IdempotencyKey, i+1)
+		result, err := chargeV2(ctx, installment)
+		if err != nil || result.Status != "APPROVED" {
+			refundInstallments(ctx, request.OrderID, transactionIDs)
+			return result, err
+		}
+		transactionIDs = append(transactionIDs, result.TransactionID)
+		last = result
+	}
+
+	return &PaymentResult{
+		TransactionID:     transactionIDs[0],
+		TransactionIDs:    transactionIDs,
+		Status:            "APPROVED",
+		PaymentMethodType: last.PaymentMethodType,
+		ProcessedAt:       last.ProcessedAt,
+	}, nil
+}
+
+// refundInstallments refunds the installments of a payment that couldn't
+// be completed. Best effort: a failed refund is logged for manual follow-up.
+func refundInstallments(ctx workflow.Context, orderID string, transactionIDs []string) {
+	logger := workflow.GetLogger(ctx)
+	for _, transactionID := range transactionIDs {
+		if err := workflow.ExecuteActivity(ctx, RefundPayment, transactionID).Get(ctx, nil); err != nil {
+			logger.Error("Refunding installment failed", "orderID", orderID, "transactionID", transactionID, "error", err)
+		}
+	}
+}
+
+// chargeV2 charges request's payment method and maps the gateway's answer
+// to a PaymentResult. Gateway declines are results, not errors.
+func chargeV2(ctx workflow.Context, request PaymentRequest) (*PaymentResult, error) {
 	var chargeResult ChargeResult
-	err := workflow.ExecuteActivity(ctx, ChargePaymentMethodV2, request).Get(ctx, &chargeResult)
+	err := workflow.ExecuteActivity(ctx, activities.ChargePaymentMethodV2, request).Get(ctx, &chargeResult)
 	if err != nil {
-		return nil, err
+		var appErr *temporal.ApplicationError
+		if !errors.As(err, &appErr) || appErr.Type() != GatewayDeclinedError {
+			return nil, workflowError(PaymentGatewayError, "charging payment method", err)
+		}
+		var gatewayCode string
+		_ = appErr.Details(&gatewayCode)
+		status, reason := mapGatewayResponse(gatewayCode)
+		workflow.GetLogger(ctx).Info("Gateway declined charge", "orderID", request.OrderID, "gatewayCode", gatewayCode)
+		return &PaymentResult{
+			Status:        status,
+			DeclineReason: reason,
+		}, nil
+	}
+
+	status, reason := mapGatewayResponse(chargeResult.GatewayCode)
+	if status != "APPROVED" {
+		return &PaymentResult{
+			TransactionID: chargeResult.TransactionID,
+			Status:        status,
+			DeclineReason: reason,
+		}, nil
 	}
 
 	return &PaymentResult{
-		TransactionID: chargeResult.TransactionID,
-		Status:        "APPROVED",
-		ProcessedAt:   workflow.Now(ctx),
+		TransactionID:     chargeResult.TransactionID,
+		Status:            status,
+		PaymentMethodType: chargeResult.PaymentMethodType,
+		ProcessedAt:       workflow.Now(ctx),
 	}, nil
 }
+
+// declineReason reports which pre-charge checks failed so support can tell
+// a bad card apart from a fraud hold. Returns "" when nothing failed.
+func declineReason(cardValid bool, fraudRisk bool) string {
+	var reasons []string
+	if !cardValid {
+		reasons = append(reasons, "INVALID_CARD")
+	}
+	if fraudRisk {
+		reasons = append(reasons, "FRAUD_RISK")
+	}
+	return strings.Join(reasons, ",")
+}
+
+// mapGatewayResponse translates a payment gateway response code into our
+// payment status and decline reason. Unknown codes are treated as declines.
+func mapGatewayResponse(code string) (status, declineReason string) {
+	switch code {
+	case "approved", "":
+		// Charges without a code come from gateways that don't report one
+		return "APPROVED", ""
+	case "insufficient_funds":
+		return "DECLINED", "INSUFFICIENT_FUNDS"
+	case "do_not_honor":
+		return "DECLINED", "DO_NOT_HONOR"
+	case "expired_card":
+		return "DECLINED", "EXPIRED_CARD"
+	case "incorrect_cvc", "invalid_card":
+		return "DECLINED", "INVALID_CARD"
+	case "fraudulent":
+		return "DECLINED", "FRAUD_RISK"
+	case "processing_error":
+		return "CHARGE_FAILED", "PROCESSING_ERROR"
+	default:
+		return "DECLINED", "GATEWAY_DECLINED"
+	}
+}
@@ -1,28 +1,39 @@
 package workflows
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
 )
 
 func TestPaymentWorkflow_Approved(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
 
-	env.OnActivity(CheckFraud, PaymentRequest{
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+
+	env.OnActivity(CheckFraud, mock.Anything, PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     50.00,
 	}).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
 
-	env.OnActivity(ChargePaymentMethod, PaymentRequest{
+	env.OnActivity(ChargePaymentMethod, mock.Anything, PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     50.00,
 	}).Return(&ChargeResult{TransactionID: "txn-abc"}, nil)
 
-	env.OnActivity(SendPaymentConfirmation, "txn-abc").Return(nil)
+	env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, "txn-abc").Return(nil)
 
 	request := PaymentRequest{
 		OrderID:    "order-123",
@@ -44,11 +55,83 @@ func TestPaymentWorkflow_Approved(t *testing.T) {
 	}
 }
 
+func TestPaymentWorkflow_InsufficientFundsAlternateMethod(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+	alternate := PaymentMethod{Type: "card", Token: "tok-backup"}
+	retried := request
+	retried.PaymentMethod = alternate
+
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+	env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(ChargePaymentMethod, mock.Anything, request).Return(nil,
+		temporal.NewNonRetryableApplicationError("insufficient funds", InsufficientFundsError, nil)).Once()
+	env.OnActivity(ChargePaymentMethod, mock.Anything, retried).Return(&ChargeResult{TransactionID: "txn-abc"}, nil).Once()
+	env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, "txn-abc").Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(AlternatePaymentMethodSignal, alternate)
+	}, time.Minute*5)
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "APPROVED" || result.TransactionID != "txn-abc" {
+		t.Errorf("Expected the alternate method's charge txn-abc to be approved, got %s %q", result.Status, result.TransactionID)
+	}
+}
+
+func TestPaymentWorkflow_InsufficientFundsNoAlternate(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+	env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(ChargePaymentMethod, mock.Anything, mock.Anything).Return(nil,
+		temporal.NewNonRetryableApplicationError("insufficient funds", InsufficientFundsError, nil)).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "CHARGE_FAILED" {
+		t.Errorf("Expected status CHARGE_FAILED once the wait for another method ran out, got %s", result.Status)
+	}
+	if !strings.Contains(result.ErrorMessage, "insufficient funds") {
+		t.Errorf("Expected the original charge failure, got %q", result.ErrorMessage)
+	}
+}
+
 func TestPaymentWorkflow_FraudDetected(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
 
-	env.OnActivity(CheckFraud, PaymentRequest{
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+
+	env.OnActivity(CheckFraud, mock.Anything, PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     50.00,
@@ -60,6 +143,384 @@ func TestPaymentWorkflow_FraudDetected(t *testing.T) {
 		Amount:     50.00,
 	}
 
+	env.OnActivity(RecordFraudDecision, mock.Anything, request, FraudCheckResult{RiskScore: 0.95}, FraudDecisionDeclined).Return(nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "FRAUD_SUSPECTED" {
+		t.Errorf("Expected status FRAUD_SUSPECTED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflow_RetriesFraudRecordUntilWritten(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+	env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
+
+	// More failures than the payment's activity retry policy would allow
+	env.OnActivity(RecordFraudDecision, mock.Anything, request, mock.Anything, FraudDecisionApproved).Return(errors.New("compliance log unavailable")).Times(5)
+	env.OnActivity(RecordFraudDecision, mock.Anything, request, mock.Anything, FraudDecisionApproved).Return(nil).Once()
+	env.OnActivity(ChargePaymentMethod, mock.Anything, request).Return(&ChargeResult{TransactionID: "txn-abc"}, nil).Once()
+	env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, "txn-abc").Return(nil)
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED once the record was written, got %s", result.Status)
+	}
+}
+
+func TestPaymentWorkflow_RejectedFraudRecordFailsPayment(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+	env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.1}, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
+		temporal.NewNonRetryableApplicationError("record rejected", InvalidFraudRecordError, nil)).Once()
+	env.OnActivity(ChargePaymentMethod, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-abc"}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != FraudRecordError {
+		t.Fatalf("Expected a %s error, got %v", FraudRecordError, err)
+	}
+	env.AssertExpectations(t)
+}
+
+func TestProcessPayment_RecordsFraudDecisionBeforeCharging(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderID string
+		status  string
+	}{
+		{"recorded decision charges", "order-123", "APPROVED"},
+		// An order with no ID can't be recorded, so isn't charged
+		{"unrecorded decision fails", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestActivityEnvironment()
+			a := NewActivities(WorkerConfig{})
+			env.RegisterActivity(a.ProcessPayment)
+
+			encoded, err := env.ExecuteActivity(a.ProcessPayment, PaymentRequest{
+				OrderID:    tt.orderID,
+				CustomerID: "customer-456",
+				Amount:     50.00,
+			})
+
+			if tt.status == "" {
+				var appErr *temporal.ApplicationError
+				if !errors.As(err, &appErr) || appErr.Type() != FraudRecordError {
+					t.Fatalf("Expected a %s error, got %v", FraudRecordError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Payment failed: %v", err)
+			}
+
+			var result PaymentResult
+			if err := encoded.Get(&result); err != nil {
+				t.Fatalf("Decoding result failed: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflow_RiskThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		status    string
+	}{
+		{"default threshold passes", 0, "APPROVED"},
+		{"strict threshold declines", 0.1, "FRAUD_SUSPECTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+
+			request := PaymentRequest{
+				OrderID:       "order-123",
+				CustomerID:    "customer-456",
+				Amount:        50.00,
+				RiskThreshold: tt.threshold,
+			}
+
+			env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(false, nil)
+			env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.12}, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnActivity(ChargePaymentMethod, mock.Anything, request).Return(&ChargeResult{TransactionID: "txn-abc"}, nil)
+			env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, "txn-abc").Return(nil)
+
+			env.ExecuteWorkflow(PaymentWorkflow, request)
+
+			var result PaymentResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_RiskThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		status    string
+	}{
+		{"default threshold passes", 0, "APPROVED"},
+		{"strict threshold declines", 0.1, "DECLINED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:       "order-123",
+				CustomerID:    "customer-456",
+				Amount:        50.00,
+				RiskThreshold: tt.threshold,
+			}
+
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.12}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+			env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 50.00).Return(true, nil)
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_FraudReviewBands(t *testing.T) {
+	approve, decline := true, false
+	tests := []struct {
+		name      string
+		riskScore float64
+		review    *bool // Reviewer's answer; nil never answers
+		queued    bool
+		status    string
+		marker    string
+	}{
+		{"low risk auto-approves", 0.3, nil, false, "APPROVED", ""},
+		{"high risk auto-declines", 0.9, nil, false, "DECLINED", ""},
+		{"borderline approved by reviewer", 0.7, &approve, true, "APPROVED", "FRAUD_REVIEWED"},
+		{"borderline declined by reviewer", 0.7, &decline, true, "DECLINED", "FRAUD_REVIEWED"},
+		{"borderline review times out", 0.7, nil, true, "DECLINED", "FRAUD_REVIEW_TIMED_OUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:         "order-123",
+				CustomerID:      "customer-456",
+				Amount:          50.00,
+				RiskThreshold:   0.8,
+				ReviewThreshold: 0.6,
+				ReviewTimeout:   time.Hour,
+			}
+
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: tt.riskScore}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+			env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 50.00).Return(true, nil)
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+			queue := env.OnActivity(QueueForReview, mock.Anything, request, FraudCheckResult{RiskScore: tt.riskScore}).Return(nil)
+			if tt.queued {
+				queue.Once()
+			} else {
+				queue.Never()
+			}
+			if tt.review != nil {
+				env.RegisterDelayedCallback(func() {
+					env.SignalWorkflow(FraudReviewDecisionSignal, *tt.review)
+				}, time.Minute*20)
+			}
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+
+			if tt.status == "DECLINED" && result.DeclineReason != "FRAUD_RISK" {
+				t.Errorf("Expected decline reason FRAUD_RISK, got %s", result.DeclineReason)
+			}
+
+			if tt.marker != "" && !strings.Contains(strings.Join(result.Metadata, ","), tt.marker) {
+				t.Errorf("Expected metadata to include %s, got %v", tt.marker, result.Metadata)
+			}
+
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_ChallengeBand(t *testing.T) {
+	pass, fail := true, false
+	tests := []struct {
+		name       string
+		riskScore  float64
+		challenge  *bool // Customer's result; nil never completes the challenge
+		challenged bool
+		status     string
+		marker     string
+	}{
+		{"low risk auto-approves", 0.3, nil, false, "APPROVED", ""},
+		{"high risk auto-declines", 0.9, nil, false, "DECLINED", ""},
+		{"challenge passed", 0.6, &pass, true, "APPROVED", "CHALLENGE_PASSED"},
+		{"challenge failed", 0.6, &fail, true, "DECLINED", "CHALLENGE_FAILED"},
+		{"challenge times out", 0.6, nil, true, "DECLINED", "CHALLENGE_TIMED_OUT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:            "order-123",
+				CustomerID:         "customer-456",
+				Amount:             50.00,
+				RiskThreshold:      0.75,
+				ChallengeThreshold: 0.5,
+				ChallengeTimeout:   time.Minute * 10,
+			}
+
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: tt.riskScore}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+			env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 50.00).Return(true, nil)
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+			env.OnActivity(QueueForReview, mock.Anything, mock.Anything, mock.Anything).Return(nil).Never()
+
+			challenge := env.OnActivity(Request3DSChallenge, mock.Anything, request).Return(nil)
+			if tt.challenged {
+				challenge.Once()
+			} else {
+				challenge.Never()
+			}
+			if tt.challenge != nil {
+				env.RegisterDelayedCallback(func() {
+					env.SignalWorkflow(ChallengeResultSignal, *tt.challenge)
+				}, time.Minute*2)
+			}
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+
+			if tt.status == "DECLINED" && result.DeclineReason != "FRAUD_RISK" {
+				t.Errorf("Expected decline reason FRAUD_RISK, got %s", result.DeclineReason)
+			}
+
+			if tt.marker != "" && !strings.Contains(strings.Join(result.Metadata, ","), tt.marker) {
+				t.Errorf("Expected metadata to include %s, got %v", tt.marker, result.Metadata)
+			}
+
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentWorkflow_FraudV2Flag(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+
+	env.OnActivity(EvaluateFeatureFlag, mock.Anything, FlagPaymentFraudV2, "customer-456").Return(true, nil).Once()
+
+	// 0.78 passes the v1 threshold but not the v2 one, so the result shows
+	// the flag held for both the scorer and the threshold
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.78}, nil)
+	env.OnActivity(CheckFraud, mock.Anything, mock.Anything).Return(&FraudCheckResult{RiskScore: 0.1}, nil).Never()
+
 	env.ExecuteWorkflow(PaymentWorkflow, request)
 
 	var result PaymentResult
@@ -72,25 +533,65 @@ func TestPaymentWorkflow_FraudDetected(t *testing.T) {
 	if result.Status != "FRAUD_SUSPECTED" {
 		t.Errorf("Expected status FRAUD_SUSPECTED, got %s", result.Status)
 	}
+
+	env.AssertExpectations(t)
+	env.AssertActivityNumberOfCalls(t, "EvaluateFeatureFlag", 1)
+}
+
+func TestPaymentWorkflow_RunsBeforeFraudFlagSkipEvaluation(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     50.00,
+	}
+
+	// A run started before the flag lookup existed replays as the default version
+	env.OnGetVersion(paymentFraudFlagChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(CheckFraud, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.1}, nil).Once()
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(ChargePaymentMethod, mock.Anything, request).Return(&ChargeResult{TransactionID: "txn-123"}, nil)
+	env.OnActivity(activities.SendPaymentConfirmation, mock.Anything, "txn-123").Return(nil)
+
+	env.ExecuteWorkflow(PaymentWorkflow, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+	env.AssertActivityNotCalled(t, "EvaluateFeatureFlag", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestPaymentWorkflowV2_Approved(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
 
-	env.OnActivity(CheckFraudV2, PaymentRequest{
+	env.OnActivity(CheckFraudV2, mock.Anything, PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     75.00,
 	}).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
 
-	env.OnActivity(ValidateCard, "customer-456").Return(true, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
 
-	env.OnActivity(ChargePaymentMethodV2, PaymentRequest{
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(true, nil)
+
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(PaymentRequest{
 		OrderID:    "order-123",
 		CustomerID: "customer-456",
 		Amount:     75.00,
-	}).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+	})).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
 
 	request := PaymentRequest{
 		OrderID:    "order-123",
@@ -111,3 +612,1394 @@ func TestPaymentWorkflowV2_Approved(t *testing.T) {
 		t.Errorf("Expected status APPROVED, got %s", result.Status)
 	}
 }
+
+// installmentCharge matches the charge of one installment of amount
+func installmentCharge(amount float64, installment int) any {
+	return mock.MatchedBy(func(r PaymentRequest) bool {
+		return r.Amount == amount && strings.HasSuffix(r.IdempotencyKey, fmt.Sprintf(":installment-%d", installment))
+	})
+}
+
+func TestPaymentWorkflowV2_Installments(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	env.OnActivity(CheckFraudV2, mock.Anything, mock.Anything).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", 100.00, DefaultSettlementCurrency).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 100.00).Return(true, nil)
+
+	// 100.00 doesn't divide by 3; the first charge takes the extra cent
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, installmentCharge(33.34, 1)).Return(&ChargeResult{TransactionID: "txn-1"}, nil).Once()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, installmentCharge(33.33, 2)).Return(&ChargeResult{TransactionID: "txn-2"}, nil).Once()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, installmentCharge(33.33, 3)).Return(&ChargeResult{TransactionID: "txn-3"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, PaymentRequest{
+		OrderID:      "order-123",
+		CustomerID:   "customer-456",
+		Amount:       100.00,
+		Installments: 3,
+	})
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED, got %s", result.Status)
+	}
+	if !reflect.DeepEqual(result.TransactionIDs, []string{"txn-1", "txn-2", "txn-3"}) {
+		t.Errorf("Expected the three installments' transactions, got %v", result.TransactionIDs)
+	}
+	if result.TransactionID != "txn-1" || result.ChargedAmount != 100.00 {
+		t.Errorf("Expected transaction txn-1 charging 100.00 in total, got %s charging %.2f", result.TransactionID, result.ChargedAmount)
+	}
+}
+
+func TestPaymentWorkflowV2_DeclinedInstallmentRefundsEarlierOnes(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	env.OnActivity(CheckFraudV2, mock.Anything, mock.Anything).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", mock.Anything).Return(true, nil)
+
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, installmentCharge(33.34, 1)).Return(&ChargeResult{TransactionID: "txn-1"}, nil).Once()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, installmentCharge(33.33, 2)).Return(nil,
+		temporal.NewNonRetryableApplicationError("card declined", GatewayDeclinedError, nil, "do_not_honor")).Once()
+	env.OnActivity(RefundPayment, mock.Anything, "txn-1").Return(nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, PaymentRequest{
+		OrderID:      "order-123",
+		CustomerID:   "customer-456",
+		Amount:       100.00,
+		Installments: 3,
+	})
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "DECLINED" {
+		t.Errorf("Expected status DECLINED, got %s", result.Status)
+	}
+	if len(result.TransactionIDs) != 0 {
+		t.Errorf("Expected no installments to stand, got %v", result.TransactionIDs)
+	}
+}
+
+func TestSplitCents(t *testing.T) {
+	tests := []struct {
+		total    Cents
+		n        int
+		expected []Cents
+	}{
+		{10000, 3, []Cents{3334, 3333, 3333}},
+		{10001, 4, []Cents{2501, 2500, 2500, 2500}},
+		{9000, 3, []Cents{3000, 3000, 3000}},
+		{5, 3, []Cents{3, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		got := splitCents(tt.total, tt.n)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("splitCents(%d, %d) = %v, expected %v", tt.total, tt.n, got, tt.expected)
+		}
+	}
+}
+
+func TestPaymentWorkflowV2_DeclineReasons(t *testing.T) {
+	tests := []struct {
+		name           string
+		cardValid      bool
+		riskScore      float64
+		expectedReason string
+		fraudDecision  string
+	}{
+		{"invalid card", false, 0.2, "INVALID_CARD", FraudDecisionApproved},
+		{"fraud risk", true, 0.9, "FRAUD_RISK", FraudDecisionDeclined},
+		{"invalid card and fraud risk", false, 0.9, "INVALID_CARD,FRAUD_RISK", FraudDecisionDeclined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:    "order-123",
+				CustomerID: "customer-456",
+				Amount:     75.00,
+			}
+
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: tt.riskScore}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(tt.cardValid, nil)
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, request, FraudCheckResult{RiskScore: tt.riskScore}, tt.fraudDecision).Return(nil).Once()
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			err := env.GetWorkflowResult(&result)
+
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != "DECLINED" {
+				t.Errorf("Expected status DECLINED, got %s", result.Status)
+			}
+
+			if result.DeclineReason != tt.expectedReason {
+				t.Errorf("Expected decline reason %s, got %s", tt.expectedReason, result.DeclineReason)
+			}
+
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCheckFraudV2_VelocityLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		velocity VelocityContext
+		exceeded bool
+	}{
+		{"no history", VelocityContext{}, false},
+		{"at the hourly limit", VelocityContext{RecentTransactions: 5, Window: time.Hour}, false},
+		{"over the hourly limit", VelocityContext{RecentTransactions: 6, Window: time.Hour}, true},
+		{"zero window is an hour", VelocityContext{RecentTransactions: 6}, true},
+		{"burst in a short window", VelocityContext{RecentTransactions: 3, Window: time.Minute * 15}, true},
+		{"spread over a day", VelocityContext{RecentTransactions: 20, Window: time.Hour * 24}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CheckFraudV2(context.Background(), PaymentRequest{
+				OrderID:    "order-123",
+				CustomerID: "customer-456",
+				Amount:     75.00,
+				Velocity:   tt.velocity,
+			})
+			if err != nil {
+				t.Fatalf("Fraud check failed: %v", err)
+			}
+
+			flagged := len(result.Flags) == 1 && result.Flags[0] == "VELOCITY_EXCEEDED"
+			if flagged != tt.exceeded {
+				t.Errorf("Expected VELOCITY_EXCEEDED flag %v, got flags %v", tt.exceeded, result.Flags)
+			}
+			if declined := result.RiskScore > v2RiskThreshold; declined != tt.exceeded {
+				t.Errorf("Expected score above %.2f to be %v, got %.2f", v2RiskThreshold, tt.exceeded, result.RiskScore)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_DeclinesHighVelocity(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+	env.RegisterActivity(CheckFraudV2)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     75.00,
+		Velocity:   VelocityContext{RecentTransactions: 12, Window: time.Hour},
+	}
+
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, request, mock.Anything, FraudDecisionDeclined).Return(nil).Once()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "DECLINED" {
+		t.Errorf("Expected status DECLINED, got %s", result.Status)
+	}
+
+	if result.DeclineReason != "FRAUD_RISK" {
+		t.Errorf("Expected decline reason FRAUD_RISK, got %s", result.DeclineReason)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_ChargesInCardCurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:      "order-123",
+		CustomerID:   "customer-456",
+		Amount:       100.00,
+		Currency:     "USD",
+		CardCurrency: "EUR",
+	}
+
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, 100.00, "USD").Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.ConvertCurrency, mock.Anything, 100.00, "USD", "EUR").Return(&ConversionResult{
+		Amount:   92.00,
+		Currency: "EUR",
+		Rate:     0.92,
+	}, nil).Once()
+
+	// The balance check and the charge both see the converted amount
+	charged := request
+	charged.Amount = 92.00
+	charged.Currency = "EUR"
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 92.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(charged)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED, got %s", result.Status)
+	}
+
+	if result.OriginalAmount != 100.00 || result.OriginalCurrency != "USD" {
+		t.Errorf("Expected original 100.00 USD, got %.2f %s", result.OriginalAmount, result.OriginalCurrency)
+	}
+
+	if result.ChargedAmount != 92.00 || result.ChargedCurrency != "EUR" {
+		t.Errorf("Expected charged 92.00 EUR, got %.2f %s", result.ChargedAmount, result.ChargedCurrency)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_SettlesInBaseCurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		settlement string
+		converted  *ConversionResult
+	}{
+		{"default settlement currency", "", &ConversionResult{Amount: 108.70, Currency: "USD", Rate: 1.087}},
+		{"configured settlement currency", "GBP", &ConversionResult{Amount: 85.87, Currency: "GBP", Rate: 0.8587}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:            "order-123",
+				CustomerID:         "customer-456",
+				Amount:             100.00,
+				Currency:           "EUR",
+				SettlementCurrency: tt.settlement,
+			}
+
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, 100.00, "EUR").Return(true, nil)
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+			env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+			env.OnActivity(activities.ConvertCurrency, mock.Anything, 100.00, "EUR", tt.converted.Currency).Return(tt.converted, nil).Once()
+
+			charged := request
+			charged.Amount = tt.converted.Amount
+			charged.Currency = tt.converted.Currency
+			env.OnActivity(VerifyBalance, mock.Anything, "customer-456", tt.converted.Amount).Return(true, nil)
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(charged)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.OriginalAmount != 100.00 || result.OriginalCurrency != "EUR" {
+				t.Errorf("Expected original 100.00 EUR, got %.2f %s", result.OriginalAmount, result.OriginalCurrency)
+			}
+
+			if result.ChargedAmount != tt.converted.Amount || result.ChargedCurrency != tt.converted.Currency {
+				t.Errorf("Expected charged %.2f %s, got %.2f %s",
+					tt.converted.Amount, tt.converted.Currency, result.ChargedAmount, result.ChargedCurrency)
+			}
+
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_SkipsConversionInBaseCurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     100.00,
+		Currency:   "usd",
+	}
+
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(activities.ConvertCurrency, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ConversionResult{}, nil).Never()
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 100.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.ChargedAmount != 100.00 {
+		t.Errorf("Expected the order amount charged unconverted, got %.2f", result.ChargedAmount)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_RunsBeforeConversionChargeOrderCurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:      "order-123",
+		CustomerID:   "customer-456",
+		Amount:       100.00,
+		Currency:     "USD",
+		CardCurrency: "EUR",
+	}
+
+	env.OnGetVersion(paymentCurrencyConversionChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, 100.00, "USD").Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 100.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertActivityNotCalled(t, "ConvertCurrency", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	env.AssertExpectations(t)
+}
+
+func TestConvertCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to string
+		want     float64
+	}{
+		{"USD to EUR", 100.00, "USD", "EUR", 92.00},
+		{"EUR to USD", 92.00, "EUR", "USD", 100.00},
+		{"rounds to whole yen", 19.99, "USD", "JPY", 3028},
+		{"lower case codes", 10.00, "usd", "gbp", 7.90},
+	}
+
+	a := NewActivities(WorkerConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.ConvertCurrency(context.Background(), tt.amount, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Conversion failed: %v", err)
+			}
+			if result.Amount != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, result.Amount)
+			}
+		})
+	}
+
+	_, err := a.ConvertCurrency(context.Background(), 10.00, "USD", "XYZ")
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != UnsupportedCurrencyError {
+		t.Errorf("Expected an %s error, got %v", UnsupportedCurrencyError, err)
+	}
+}
+
+func TestFraudDecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   FraudCheckResult
+		decision string
+	}{
+		{"low risk", FraudCheckResult{RiskScore: 0.2}, FraudDecisionApproved},
+		{"at the threshold", FraudCheckResult{RiskScore: 0.75}, FraudDecisionApproved},
+		{"above the threshold", FraudCheckResult{RiskScore: 0.76}, FraudDecisionDeclined},
+		{"flagged", FraudCheckResult{RiskScore: 0.2, Flags: []string{"VELOCITY"}}, FraudDecisionFlagged},
+		{"declined outranks flagged", FraudCheckResult{RiskScore: 0.9, Flags: []string{"VELOCITY"}}, FraudDecisionDeclined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if decision := fraudDecision(tt.result, v2RiskThreshold); decision != tt.decision {
+				t.Errorf("Expected %s, got %s", tt.decision, decision)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_InsufficientBalance(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     75.00,
+	}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(false, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "INSUFFICIENT_BALANCE" {
+		t.Errorf("Expected status INSUFFICIENT_BALANCE, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_RunsBeforeBalanceCheckSkipIt(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     75.00,
+	}
+
+	env.OnGetVersion(paymentBalanceCheckChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertActivityNotCalled(t, "VerifyBalance", mock.Anything, mock.Anything, mock.Anything)
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_SpendingLimitExceeded(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     750.00,
+	}
+
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", 750.00, DefaultSettlementCurrency).Return(&LimitResult{
+		Allowed: false,
+		Limit:   SpendingLimit{Amount: 1000, Window: time.Hour * 24},
+		Spent:   400,
+	}, nil).Once()
+	env.OnActivity(VerifyBalance, mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Never()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "SPENDING_LIMIT_EXCEEDED" {
+		t.Errorf("Expected status SPENDING_LIMIT_EXCEEDED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_SpendingLimitSeesOrderCurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:            "order-123",
+		CustomerID:         "customer-456",
+		Amount:             15000,
+		Currency:           "JPY",
+		SettlementCurrency: "EUR",
+	}
+
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// The limit is checked on the yen amount, not read as 15,000 of some
+	// other currency
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", 15000.0, "JPY").Return(&LimitResult{
+		Allowed: false,
+		Limit:   SpendingLimit{Amount: 50, Window: time.Hour * 24},
+	}, nil).Once()
+	env.OnActivity(activities.ConvertCurrency, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ConversionResult{}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "SPENDING_LIMIT_EXCEEDED" {
+		t.Errorf("Expected status SPENDING_LIMIT_EXCEEDED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_RunsBeforeSpendingLimitSkipIt(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     25.00,
+	}
+
+	env.OnGetVersion(paymentSpendingLimitChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 25.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertActivityNotCalled(t, "CheckSpendingLimit", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	env.AssertExpectations(t)
+}
+
+// memorySpendingLedger is a SpendingLedger with one customer's limit and
+// recent spend
+type memorySpendingLedger struct {
+	limits map[string]SpendingLimit
+	spent  float64
+}
+
+func (l memorySpendingLedger) Limit(ctx context.Context, customerID string) (SpendingLimit, bool, error) {
+	limit, ok := l.limits[customerID]
+	return limit, ok, nil
+}
+
+func (l memorySpendingLedger) SpentSince(ctx context.Context, customerID string, since time.Time) (float64, error) {
+	return l.spent, nil
+}
+
+func TestCheckSpendingLimit(t *testing.T) {
+	a := &Activities{
+		SpendingLedger: memorySpendingLedger{
+			limits: map[string]SpendingLimit{"customer-456": {Amount: 1000, Window: time.Hour * 24}},
+			spent:  900.10,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		customerID string
+		amount     float64
+		currency   string
+		allowed    bool
+	}{
+		{"within the limit", "customer-456", 50.00, "USD", true},
+		{"exactly at the limit", "customer-456", 99.90, "USD", true},
+		{"over the limit", "customer-456", 99.91, "USD", false},
+		{"default limit", "customer-789", 3000.00, "USD", true},
+		{"converted within the limit", "customer-456", 91.90, "EUR", true},
+		{"converted over the limit", "customer-456", 92.00, "eur", false},
+		{"over the limit in yen", "customer-456", 15150, "JPY", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.CheckSpendingLimit(context.Background(), tt.customerID, tt.amount, tt.currency)
+			if err != nil {
+				t.Fatalf("Checking spending limit failed: %v", err)
+			}
+			if result.Allowed != tt.allowed {
+				t.Errorf("Expected allowed=%v, got %+v", tt.allowed, result)
+			}
+		})
+	}
+}
+
+func TestCheckSpendingLimit_UnsupportedCurrency(t *testing.T) {
+	a := &Activities{SpendingLedger: memorySpendingLedger{}}
+
+	_, err := a.CheckSpendingLimit(context.Background(), "customer-456", 100, "XYZ")
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != UnsupportedCurrencyError {
+		t.Fatalf("Expected an %s error, got %v", UnsupportedCurrencyError, err)
+	}
+}
+
+func TestMapGatewayResponse(t *testing.T) {
+	tests := []struct {
+		code           string
+		expectedStatus string
+		expectedReason string
+	}{
+		{"approved", "APPROVED", ""},
+		{"insufficient_funds", "DECLINED", "INSUFFICIENT_FUNDS"},
+		{"do_not_honor", "DECLINED", "DO_NOT_HONOR"},
+		{"expired_card", "DECLINED", "EXPIRED_CARD"},
+		{"processing_error", "CHARGE_FAILED", "PROCESSING_ERROR"},
+		{"something_new", "DECLINED", "GATEWAY_DECLINED"},
+	}
+
+	for _, tt := range tests {
+		status, reason := mapGatewayResponse(tt.code)
+		if status != tt.expectedStatus || reason != tt.expectedReason {
+			t.Errorf("mapGatewayResponse(%q) = %s/%s, expected %s/%s",
+				tt.code, status, reason, tt.expectedStatus, tt.expectedReason)
+		}
+	}
+}
+
+func TestPaymentWorkflowV2_GatewayDecline(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     75.00,
+	}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(nil,
+		temporal.NewNonRetryableApplicationError("card declined", GatewayDeclinedError, nil, "do_not_honor"))
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "DECLINED" {
+		t.Errorf("Expected status DECLINED, got %s", result.Status)
+	}
+
+	if result.DeclineReason != "DO_NOT_HONOR" {
+		t.Errorf("Expected decline reason DO_NOT_HONOR, got %s", result.DeclineReason)
+	}
+}
+
+func TestPaymentWorkflowV2_UpdatePaymentMethodAfterDecline(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:               "order-123",
+		CustomerID:            "customer-456",
+		Amount:                75.00,
+		PaymentMethod:         PaymentMethod{Type: "card", Token: "tok-declined"},
+		MaxPaymentMethodSwaps: 1,
+	}
+	newMethod := PaymentMethod{Type: "card", Token: "tok-backup"}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(nil,
+		temporal.NewNonRetryableApplicationError("card declined", GatewayDeclinedError, nil, "do_not_honor")).Once()
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.MatchedBy(func(r PaymentRequest) bool {
+		return r.PaymentMethod == newMethod
+	})).Return(&ChargeResult{TransactionID: "txn-v2-456", GatewayCode: "approved"}, nil).Once()
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(UpdatePaymentMethodSignal, newMethod)
+	}, time.Minute)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED, got %s", result.Status)
+	}
+
+	if result.TransactionID != "txn-v2-456" {
+		t.Errorf("Expected transaction txn-v2-456, got %s", result.TransactionID)
+	}
+
+	env.AssertExpectations(t)
+}
+
+// untrustedCustomer mocks the trust lookup so the payment is fraud-checked
+func untrustedCustomer(env *testsuite.TestWorkflowEnvironment) {
+	env.OnActivity(activities.CheckTrustStatus, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&TrustStatus{}, nil).Maybe()
+}
+
+func TestPaymentWorkflowV2_TrustedCustomerSkipsFraudCheck(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     25.00,
+	}
+
+	env.OnActivity(activities.CheckTrustStatus, mock.Anything, "customer-456", 25.00, DefaultSettlementCurrency).Return(&TrustStatus{
+		Trusted:        true,
+		SkipFraudCheck: true,
+	}, nil).Once()
+	env.OnActivity(CheckFraudV2, mock.Anything, mock.Anything).Return(&FraudCheckResult{}, nil).Never()
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Never()
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 25.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "APPROVED" {
+		t.Errorf("Expected status APPROVED, got %s", result.Status)
+	}
+
+	if len(result.Metadata) != 1 || result.Metadata[0] != "FRAUD_CHECK_SKIPPED" {
+		t.Errorf("Expected metadata [FRAUD_CHECK_SKIPPED], got %v", result.Metadata)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_IgnoresClientSuppliedTrust(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:         "order-123",
+		CustomerID:      "customer-456",
+		Amount:          25.00,
+		TrustedCustomer: true,
+	}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil).Once()
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 25.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if len(result.Metadata) != 0 {
+		t.Errorf("Expected the fraud check to run, got metadata %v", result.Metadata)
+	}
+}
+
+func TestPaymentWorkflowV2_RunsBeforeTrustLookupReadRequest(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := PaymentRequest{
+		OrderID:         "order-123",
+		CustomerID:      "customer-456",
+		Amount:          25.00,
+		TrustedCustomer: true,
+	}
+
+	env.OnGetVersion(paymentTrustStatusChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(CheckFraudV2, mock.Anything, mock.Anything).Return(&FraudCheckResult{}, nil).Never()
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 25.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertActivityNotCalled(t, "CheckTrustStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	env.AssertExpectations(t)
+}
+
+// memoryTrustStore is a CustomerTrustStore of trusted customer IDs
+type memoryTrustStore map[string]bool
+
+func (s memoryTrustStore) Trusted(ctx context.Context, customerID string) (bool, error) {
+	return s[customerID], nil
+}
+
+func TestCheckTrustStatus(t *testing.T) {
+	a := &Activities{CustomerTrust: memoryTrustStore{"customer-456": true}}
+
+	tests := []struct {
+		name       string
+		customerID string
+		amount     float64
+		currency   string
+		trusted    bool
+		skip       bool
+	}{
+		{"small purchase", "customer-456", 99.99, "USD", true, true},
+		{"at the limit", "customer-456", 100.00, "USD", true, false},
+		{"small in yen", "customer-456", 9000, "JPY", true, true},
+		{"over the limit once converted", "customer-456", 90.00, "GBP", true, false},
+		{"untrusted", "customer-789", 10.00, "USD", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := a.CheckTrustStatus(context.Background(), tt.customerID, tt.amount, tt.currency)
+			if err != nil {
+				t.Fatalf("Checking trust status failed: %v", err)
+			}
+			if status.Trusted != tt.trusted || status.SkipFraudCheck != tt.skip {
+				t.Errorf("Expected trusted=%v skip=%v, got %+v", tt.trusted, tt.skip, status)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_InvalidAmountPrecision(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+	env.RegisterActivity(NewActivities(WorkerConfig{}).ValidateCurrencyAmount)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     100.50,
+		Currency:   "JPY",
+	}
+
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, mock.Anything).Return(&ChargeResult{}, nil).Never()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "INVALID_AMOUNT_PRECISION" {
+		t.Errorf("Expected status INVALID_AMOUNT_PRECISION, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestPaymentWorkflowV2_RunsBeforePrecisionCheckSkipIt(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     25.00,
+	}
+
+	env.OnGetVersion(paymentAmountPrecisionChange, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 25.00).Return(true, nil)
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil)
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertActivityNotCalled(t, "ValidateCurrencyAmount", mock.Anything, mock.Anything, mock.Anything)
+	env.AssertExpectations(t)
+}
+
+func TestValidateCurrencyAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		currency string
+		valid    bool
+	}{
+		{"JPY with decimals", 100.50, "JPY", false},
+		{"JPY whole yen", 100, "JPY", true},
+		{"USD with two decimals", 19.99, "USD", true},
+		{"USD with three decimals", 19.999, "USD", false},
+		{"USD float sum", 0.1 + 0.2, "USD", true},
+		{"KWD with three decimals", 1.125, "KWD", true},
+		{"unlisted currency uses two decimals", 5.25, "", true},
+	}
+
+	a := NewActivities(WorkerConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := a.ValidateCurrencyAmount(context.Background(), tt.amount, tt.currency)
+			if err != nil {
+				t.Fatalf("Validation failed: %v", err)
+			}
+
+			if valid != tt.valid {
+				t.Errorf("Expected %v %s valid=%v, got %v", tt.amount, tt.currency, tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_ChargesThreeDecimalCurrency(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+	env.RegisterActivity(NewActivities(WorkerConfig{}).ValidateCurrencyAmount)
+
+	request := PaymentRequest{
+		OrderID:      "order-123",
+		CustomerID:   "customer-456",
+		Amount:       1.234,
+		Currency:     "BHD",
+		CardCurrency: "BHD",
+	}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(RecordFraudDecision, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", 1.234, "BHD").Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 1.234).Return(true, nil)
+
+	// Charged to the fils, not rounded to 1.23
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123"}, nil).Once()
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	var result PaymentResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.ChargedAmount != 1.234 {
+		t.Errorf("Expected 1.234 BHD charged, got %.3f", result.ChargedAmount)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestRoundToMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		expected float64
+	}{
+		{1.234, "BHD", 1.234},
+		{1.2345, "KWD", 1.235},
+		{19.999, "USD", 20.00},
+		{0.1 + 0.2, "USD", 0.30},
+		{100.4, "JPY", 100},
+	}
+
+	for _, tt := range tests {
+		if got := roundToMinorUnits(tt.amount, currencyMinorUnits(tt.currency)); got != tt.expected {
+			t.Errorf("Expected %v %s to round to %v, got %v", tt.amount, tt.currency, tt.expected, got)
+		}
+	}
+}
+
+func TestPaymentWorkflowV2_RetriesRateLimitsNotDeclines(t *testing.T) {
+	rateLimited := temporal.NewApplicationErrorWithOptions("rate limited", GatewayRateLimitedError,
+		temporal.ApplicationErrorOptions{Details: []any{"rate_limited"}, NextRetryDelay: time.Minute})
+	// Retryable on its own, so only the policy's NonRetryableErrorTypes stops a retry
+	declined := temporal.NewApplicationError("declined", GatewayDeclinedError, "do_not_honor")
+
+	tests := []struct {
+		name     string
+		firstErr error
+		charges  int
+		status   string
+	}{
+		{"rate limit is retried", rateLimited, 2, "APPROVED"},
+		{"decline is not retried", declined, 1, "DECLINED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			untrustedCustomer(env)
+
+			request := PaymentRequest{
+				OrderID:    "order-123",
+				CustomerID: "customer-456",
+				Amount:     75.00,
+			}
+
+			env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+			env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+			env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+			env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+			env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(true, nil)
+
+			charges := 0
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(nil, tt.firstErr).Once().
+				Run(func(args mock.Arguments) { charges++ })
+			env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123", GatewayCode: "approved"}, nil).Maybe().
+				Run(func(args mock.Arguments) { charges++ })
+
+			env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+			var result PaymentResult
+			err := env.GetWorkflowResult(&result)
+
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if charges != tt.charges {
+				t.Errorf("Expected %d charge attempts, got %d", tt.charges, charges)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+		})
+	}
+}
+
+func TestClassifyGatewayCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		errType string
+	}{
+		{"approved", ""},
+		{"processing_error", ""},
+		{"rate_limited", GatewayRateLimitedError},
+		{"do_not_honor", GatewayDeclinedError},
+		{"fraudulent", GatewayDeclinedError},
+	}
+
+	for _, tt := range tests {
+		err := classifyGatewayCode(tt.code, DefaultGatewayRateLimitBackoff)
+		if tt.errType == "" {
+			if err != nil {
+				t.Errorf("Expected %s to be returned as a result, got %v", tt.code, err)
+			}
+			continue
+		}
+
+		var appErr *temporal.ApplicationError
+		if !errors.As(err, &appErr) || appErr.Type() != tt.errType {
+			t.Errorf("Expected %s to classify as %s, got %v", tt.code, tt.errType, err)
+		}
+	}
+}
+
+// sameCharge matches a ChargePaymentMethodV2 request for request, whatever
+// idempotency key the workflow gave it
+func sameCharge(request PaymentRequest) any {
+	return mock.MatchedBy(func(r PaymentRequest) bool {
+		r.IdempotencyKey = ""
+		return r == request
+	})
+}
+
+// memoryChargeLedger is a ChargeLedger over a map
+type memoryChargeLedger map[string]ChargeResult
+
+func (l memoryChargeLedger) Lookup(ctx context.Context, idempotencyKey string) (*ChargeResult, error) {
+	result, ok := l[idempotencyKey]
+	if !ok {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+func (l memoryChargeLedger) Record(ctx context.Context, idempotencyKey string, result ChargeResult) error {
+	l[idempotencyKey] = result
+	return nil
+}
+
+func TestChargePaymentMethodV2_ChargesOncePerIdempotencyKey(t *testing.T) {
+	gatewayCharges := 0
+	a := &Activities{
+		ChargeLedger: memoryChargeLedger{},
+		ChargeGateway: func(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
+			gatewayCharges++
+			return &ChargeResult{
+				TransactionID: fmt.Sprintf("txn-%d", gatewayCharges),
+				Amount:        request.Amount,
+				GatewayCode:   "approved",
+			}, nil
+		},
+	}
+
+	request := PaymentRequest{
+		OrderID:        "order-123",
+		CustomerID:     "customer-456",
+		Amount:         75.00,
+		IdempotencyKey: "order-123:run-1",
+	}
+
+	first, err := a.ChargePaymentMethodV2(context.Background(), request)
+	if err != nil {
+		t.Fatalf("First charge failed: %v", err)
+	}
+	second, err := a.ChargePaymentMethodV2(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Second charge failed: %v", err)
+	}
+
+	if gatewayCharges != 1 {
+		t.Errorf("Expected 1 gateway charge, got %d", gatewayCharges)
+	}
+
+	if *first != *second {
+		t.Errorf("Expected the same charge result twice, got %+v and %+v", first, second)
+	}
+}
+
+func TestChargePaymentMethodV2_RecordsOnlyFinalOutcomes(t *testing.T) {
+	tests := []struct {
+		code    string
+		charges int
+	}{
+		{"approved", 1},
+		{"do_not_honor", 1},
+		{"processing_error", 2},
+		{"rate_limited", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			gatewayCharges := 0
+			a := &Activities{
+				ChargeLedger: memoryChargeLedger{},
+				ChargeGateway: func(ctx context.Context, request PaymentRequest) (*ChargeResult, error) {
+					gatewayCharges++
+					return &ChargeResult{
+						TransactionID: fmt.Sprintf("txn-%d", gatewayCharges),
+						GatewayCode:   tt.code,
+					}, nil
+				},
+			}
+
+			request := PaymentRequest{
+				OrderID:        "order-123",
+				IdempotencyKey: "order-123:run-1",
+			}
+			for i := 0; i < 2; i++ {
+				a.ChargePaymentMethodV2(context.Background(), request)
+			}
+
+			if gatewayCharges != tt.charges {
+				t.Errorf("Expected %d gateway charges, got %d", tt.charges, gatewayCharges)
+			}
+		})
+	}
+}
+
+func TestPaymentWorkflowV2_DerivesIdempotencyKey(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	untrustedCustomer(env)
+
+	request := PaymentRequest{
+		OrderID:    "order-123",
+		CustomerID: "customer-456",
+		Amount:     75.00,
+	}
+
+	env.OnActivity(CheckFraudV2, mock.Anything, request).Return(&FraudCheckResult{RiskScore: 0.2}, nil)
+	env.OnActivity(ValidateCard, mock.Anything, "customer-456").Return(true, nil)
+	env.OnActivity(activities.ValidateCurrencyAmount, mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	env.OnActivity(activities.CheckSpendingLimit, mock.Anything, "customer-456", mock.Anything, mock.Anything).Return(&LimitResult{Allowed: true}, nil)
+	env.OnActivity(VerifyBalance, mock.Anything, "customer-456", 75.00).Return(true, nil)
+
+	// The first attempt times out after reaching the gateway; the retry
+	// must carry the same key so the gateway doesn't charge twice
+	var keys []string
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(nil, errors.New("gateway timeout")).Once().
+		Run(func(args mock.Arguments) { keys = append(keys, args.Get(1).(PaymentRequest).IdempotencyKey) })
+	env.OnActivity(activities.ChargePaymentMethodV2, mock.Anything, sameCharge(request)).Return(&ChargeResult{TransactionID: "txn-v2-123", GatewayCode: "approved"}, nil).Once().
+		Run(func(args mock.Arguments) { keys = append(keys, args.Get(1).(PaymentRequest).IdempotencyKey) })
+
+	env.ExecuteWorkflow(PaymentWorkflowV2, request)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 charge attempts, got %d", len(keys))
+	}
+
+	if !strings.HasPrefix(keys[0], "order-123:") || keys[0] != keys[1] {
+		t.Errorf("Expected both attempts to share an order-derived key, got %v", keys)
+	}
+}
+
+// memoryConfirmationStore is a ConfirmationStore over a map
+type memoryConfirmationStore map[string]bool
+
+func (s memoryConfirmationStore) Sent(ctx context.Context, idempotencyKey string) (bool, error) {
+	return s[idempotencyKey], nil
+}
+
+func (s memoryConfirmationStore) MarkSent(ctx context.Context, idempotencyKey string) error {
+	s[idempotencyKey] = true
+	return nil
+}
+
+func TestSendPaymentConfirmation_SendsOncePerTransaction(t *testing.T) {
+	delivered := map[string]int{}
+	a := &Activities{
+		Confirmations: memoryConfirmationStore{},
+		DeliverConfirmation: func(ctx context.Context, transactionID string) error {
+			delivered[transactionID]++
+			return nil
+		},
+	}
+
+	// The first attempt's result was lost, so the activity is retried
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := a.SendPaymentConfirmation(context.Background(), "txn-abc"); err != nil {
+			t.Fatalf("Attempt %d failed: %v", attempt+1, err)
+		}
+	}
+	if err := a.SendPaymentConfirmation(context.Background(), "txn-def"); err != nil {
+		t.Fatalf("Sending another transaction's confirmation failed: %v", err)
+	}
+
+	if delivered["txn-abc"] != 1 {
+		t.Errorf("Expected 1 confirmation for txn-abc, got %d", delivered["txn-abc"])
+	}
+
+	if delivered["txn-def"] != 1 {
+		t.Errorf("Expected other transactions to still be confirmed, got %d", delivered["txn-def"])
+	}
+}
+
+func TestSendPaymentConfirmation_FailedDeliveryIsRetried(t *testing.T) {
+	attempts := 0
+	a := &Activities{
+		Confirmations: memoryConfirmationStore{},
+		DeliverConfirmation: func(ctx context.Context, transactionID string) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("smtp timeout")
+			}
+			return nil
+		},
+	}
+
+	if err := a.SendPaymentConfirmation(context.Background(), "txn-abc"); err == nil {
+		t.Fatal("Expected the failed delivery to be returned for retry")
+	}
+	if err := a.SendPaymentConfirmation(context.Background(), "txn-abc"); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Expected a failed delivery not to be recorded as sent, got %d attempts", attempts)
+	}
+}
@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type RefundRequest struct {
+	OrderID       string
+	TransactionID string      // Charge being refunded
+	Items         []OrderItem // Line items to refund; Quantity is the quantity returned
+}
+
+type RefundResult struct {
+	RefundID string
+	Amount   float64
+	Status   string // "REFUNDED", "NO_REFUND_ITEMS" or "REFUND_EXCEEDS_CHARGE"
+}
+
+// RefundWorkflow refunds part of a charge for the returned line items.
+// Refunds larger than what's left of the original charge are rejected
+// without calling the gateway.
+func RefundWorkflow(ctx workflow.Context, request RefundRequest) (*RefundResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting refund", "orderID", request.OrderID, "transactionID", request.TransactionID)
+
+	amount := itemsTotal(request.Items)
+	if amount <= 0 {
+		return &RefundResult{Status: "NO_REFUND_ITEMS"}, nil
+	}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 2,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval: time.Second,
+			MaximumAttempts: 3,
+		},
+	})
+
+	var refundable float64
+	if err := workflow.ExecuteActivity(ctx, GetRefundableAmount, request.TransactionID).Get(ctx, &refundable); err != nil {
+		logger.Error("Looking up refundable amount failed", "error", err)
+		return nil, err
+	}
+	if amount > toCents(refundable) {
+		logger.Warn("Refund exceeds charge", "amount", amount.Float64(), "refundable", refundable)
+		return &RefundResult{Amount: amount.Float64(), Status: "REFUND_EXCEEDS_CHARGE"}, nil
+	}
+
+	var result RefundResult
+	err := workflow.ExecuteActivity(ctx, RefundPaymentPartial, request.TransactionID, amount.Float64()).Get(ctx, &result)
+	if err != nil {
+		logger.Error("Partial refund failed", "error", err)
+		return nil, err
+	}
+	result.Status = "REFUNDED"
+
+	logger.Info("Refund completed", "refundID", result.RefundID, "amount", result.Amount)
+	return &result, nil
+}
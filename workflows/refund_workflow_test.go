@@ -0,0 +1,76 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestRefundWorkflow_RefundsLineItems(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	env.OnActivity(GetRefundableAmount, mock.Anything, "TXN-123").Return(100.00, nil)
+	env.OnActivity(RefundPaymentPartial, mock.Anything, "TXN-123", 49.98).Return(&RefundResult{
+		RefundID: "RFD-1",
+		Amount:   49.98,
+	}, nil).Once()
+
+	request := RefundRequest{
+		OrderID:       "ORDER-123",
+		TransactionID: "TXN-123",
+		Items: []OrderItem{
+			{BookID: "BOOK-1", Title: "Test Book", Quantity: 2, Price: 24.99},
+		},
+	}
+
+	env.ExecuteWorkflow(RefundWorkflow, request)
+
+	var result RefundResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "REFUNDED" {
+		t.Errorf("Expected status REFUNDED, got %s", result.Status)
+	}
+
+	if result.RefundID != "RFD-1" || result.Amount != 49.98 {
+		t.Errorf("Expected refund RFD-1 of 49.98, got %+v", result)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestRefundWorkflow_RejectsRefundExceedingCharge(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	// 30.00 of the original 50.00 charge was already refunded
+	env.OnActivity(GetRefundableAmount, mock.Anything, "TXN-123").Return(20.00, nil)
+	env.OnActivity(RefundPaymentPartial, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Never()
+
+	request := RefundRequest{
+		OrderID:       "ORDER-123",
+		TransactionID: "TXN-123",
+		Items: []OrderItem{
+			{BookID: "BOOK-1", Title: "Test Book", Quantity: 1, Price: 24.99},
+		},
+	}
+
+	env.ExecuteWorkflow(RefundWorkflow, request)
+
+	var result RefundResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "REFUND_EXCEEDS_CHARGE" {
+		t.Errorf("Expected status REFUND_EXCEEDS_CHARGE, got %s", result.Status)
+	}
+
+	if result.RefundID != "" {
+		t.Errorf("Expected no refund ID, got %s", result.RefundID)
+	}
+}
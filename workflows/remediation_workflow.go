@@ -0,0 +1,86 @@
+package workflows
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+type RemediationRequest struct {
+	RepositoryURL string
+	Branch        string   // Branch the fixes are applied on top of
+	Remediations  []string // Vulnerability.Remediation suggestions, e.g. "Upgrade lodash to >= 4.17.21"
+}
+
+type RemediationResult struct {
+	Applied []string
+	Skipped []SkippedRemediation // Suggestions that didn't verify, in request order
+}
+
+type SkippedRemediation struct {
+	Remediation string
+	Reason      string
+}
+
+// VerificationResult is whether a remediation kept the build and tests green
+type VerificationResult struct {
+	Safe   bool
+	Reason string // Why it isn't safe, e.g. the failing build step
+}
+
+// RemediationWorkflow auto-applies suggested fixes, but only those
+// VerifyRemediation shows keep the build green. The rest are reported as
+// skipped for a person to look at.
+func RemediationWorkflow(ctx workflow.Context, request RemediationRequest) (*RemediationResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Starting remediation", "repo", request.RepositoryURL, "count", len(request.Remediations))
+
+	// Verification runs a full build and test pass per remediation
+	verifyCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 30,
+		HeartbeatTimeout:    time.Minute * 2,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval: time.Second * 30,
+			MaximumAttempts: 2,
+		},
+	})
+	futures := make([]workflow.Future, len(request.Remediations))
+	for i, remediation := range request.Remediations {
+		futures[i] = workflow.ExecuteActivity(verifyCtx, VerifyRemediation, remediation)
+	}
+
+	result := &RemediationResult{}
+	for i, remediation := range request.Remediations {
+		var verification VerificationResult
+		if err := futures[i].Get(ctx, &verification); err != nil {
+			// Unverified is not verified-safe
+			logger.Warn("Verifying remediation failed", "remediation", remediation, "error", err)
+			result.Skipped = append(result.Skipped, SkippedRemediation{Remediation: remediation, Reason: err.Error()})
+			continue
+		}
+		if !verification.Safe {
+			logger.Info("Skipping unsafe remediation", "remediation", remediation, "reason", verification.Reason)
+			result.Skipped = append(result.Skipped, SkippedRemediation{Remediation: remediation, Reason: verification.Reason})
+			continue
+		}
+		result.Applied = append(result.Applied, remediation)
+	}
+
+	if len(result.Applied) > 0 {
+		applyCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute * 5,
+			RetryPolicy: &temporal.RetryPolicy{
+				MaximumAttempts: 3,
+			},
+		})
+		err := workflow.ExecuteActivity(applyCtx, ApplyRemediations, request.RepositoryURL, request.Branch, result.Applied).Get(ctx, nil)
+		if err != nil {
+			logger.Error("Applying remediations failed", "error", err)
+			return nil, err
+		}
+	}
+
+	logger.Info("Remediation finished", "applied", len(result.Applied), "skipped", len(result.Skipped))
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package workflows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestRemediationWorkflow_SkipsUnverifiedRemediations(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	safe := "Upgrade lodash to >= 4.17.21"
+	unsafe := "Upgrade react to >= 19.0.0"
+
+	env.OnActivity(VerifyRemediation, mock.Anything, safe).Return(&VerificationResult{Safe: true}, nil)
+	env.OnActivity(VerifyRemediation, mock.Anything, unsafe).Return(&VerificationResult{
+		Safe:   false,
+		Reason: "test //web:app_test failed",
+	}, nil)
+
+	var applied []string
+	env.OnActivity(ApplyRemediations, mock.Anything, "https://github.com/example/repo", "main", mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { applied = args.Get(3).([]string) }).Once()
+
+	request := RemediationRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		Remediations:  []string{safe, unsafe},
+	}
+
+	env.ExecuteWorkflow(RemediationWorkflow, request)
+
+	var result RemediationResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(applied) != 1 || applied[0] != safe {
+		t.Errorf("Expected only %q to be applied, got %v", safe, applied)
+	}
+
+	if len(result.Skipped) != 1 || result.Skipped[0].Remediation != unsafe {
+		t.Fatalf("Expected %q to be skipped, got %+v", unsafe, result.Skipped)
+	}
+
+	if result.Skipped[0].Reason != "test //web:app_test failed" {
+		t.Errorf("Expected the verification failure as the reason, got %q", result.Skipped[0].Reason)
+	}
+
+	env.AssertExpectations(t)
+}
@@ -0,0 +1,42 @@
+package workflows
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// ReportGenerationRequest is the input to ReportGenerationWorkflow
+type ReportGenerationRequest struct {
+	ScanID          string // The scan's workflow ID
+	Vulnerabilities []Vulnerability
+	SBOMURL         string // Linked from the report; empty when the scan has no SBOM
+	ReportFormat    string // One of the ReportFormat constants; empty is JSON
+	AuthSecret      string // Names the secret holding report storage's auth headers
+}
+
+// ReportGenerationWorkflow generates a scan's report on its own, for scans
+// run with SecurityScanRequest.DeferReport. The scan returns without
+// waiting; poll this workflow, whose ID is the result's ReportWorkflowID,
+// for the ReportResult.
+func ReportGenerationWorkflow(ctx workflow.Context, request ReportGenerationRequest) (*ReportResult, error) {
+	logger := workflow.GetLogger(ctx)
+	logger.Info("Generating deferred scan report",
+		"scanID", request.ScanID,
+		"vulnerabilities", len(request.Vulnerabilities))
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+
+	var report ReportResult
+	if err := workflow.ExecuteActivity(ctx, activities.GenerateSecurityReport, request.Vulnerabilities, request.SBOMURL, request.ReportFormat, request.AuthSecret).Get(ctx, &report); err != nil {
+		logger.Error("Deferred report generation failed", "scanID", request.ScanID, "error", err)
+		return nil, err
+	}
+	return &report, nil
+}
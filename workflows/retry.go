@@ -0,0 +1,57 @@
+package workflows
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+// Retry policy kinds for defaultRetryPolicy
+const (
+	RetryPolicyOrder     = "order"
+	RetryPolicyPayment   = "payment"
+	RetryPolicyPaymentV2 = "payment_v2"
+)
+
+// defaultRetryPolicy returns the activity retry policy for a kind of
+// workflow, so the policies are defined in one place:
+//
+//   - RetryPolicyOrder, the standard policy: 3 attempts, 1s initial
+//     interval doubling up to 1m.
+//   - RetryPolicyPayment (PaymentWorkflow): 5 attempts, 2s initial interval
+//     doubling up to 30s. The longer first wait gives the gateway time to
+//     settle before a charge is retried.
+//   - RetryPolicyPaymentV2 (PaymentWorkflowV2): 3 attempts, 1s initial
+//     interval growing by 1.5 up to 15s, with gateway declines and invalid
+//     cards never retried.
+//
+// The order and payment policies share a backoff coefficient of 2. Any
+// other kind gets the standard policy. Each call returns a new policy, so
+// callers may change it.
+func defaultRetryPolicy(kind string) *temporal.RetryPolicy {
+	switch kind {
+	case RetryPolicyPayment:
+		return &temporal.RetryPolicy{
+			InitialInterval:        time.Second * 2,
+			BackoffCoefficient:     2.0,
+			MaximumInterval:        time.Second * 30,
+			MaximumAttempts:        5,
+			NonRetryableErrorTypes: []string{"FraudDetectedError", InsufficientFundsError},
+		}
+	case RetryPolicyPaymentV2:
+		return &temporal.RetryPolicy{
+			InitialInterval:        time.Second,
+			BackoffCoefficient:     1.5,
+			MaximumInterval:        time.Second * 15,
+			MaximumAttempts:        3,
+			NonRetryableErrorTypes: []string{"FraudDetectedError", InsufficientFundsError, "InvalidCardError", GatewayDeclinedError},
+		}
+	default:
+		return &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    3,
+		}
+	}
+}
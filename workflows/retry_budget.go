@@ -0,0 +1,119 @@
+package workflows
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// EstimateMaxDuration returns the worst-case time an activity can take under
+// policy when every attempt runs to attemptTimeout and then fails: all
+// attempts plus the backoff waits between them. Use it to size workflow
+// timeouts around retried activities.
+//
+// Unset policy fields take Temporal's defaults. A policy without a
+// MaximumAttempts cap retries forever, so the result is 0 (unbounded).
+func EstimateMaxDuration(policy *temporal.RetryPolicy, attemptTimeout time.Duration) time.Duration {
+	if policy == nil || policy.MaximumAttempts <= 0 {
+		return 0
+	}
+
+	interval := policy.InitialInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	coefficient := policy.BackoffCoefficient
+	if coefficient < 1 {
+		coefficient = 2.0
+	}
+	maxInterval := policy.MaximumInterval
+	if maxInterval <= 0 {
+		maxInterval = interval * 100
+	}
+
+	total := attemptTimeout * time.Duration(policy.MaximumAttempts)
+	for retry := int32(1); retry < policy.MaximumAttempts; retry++ {
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+		total += interval
+		interval = time.Duration(float64(interval) * coefficient)
+	}
+	return total
+}
+
+// validateActivityTimeouts checks that options leave room for at least one
+// full attempt. A ScheduleToCloseTimeout shorter than StartToCloseTimeout
+// cuts every attempt short, so retries could never succeed.
+func validateActivityTimeouts(options workflow.ActivityOptions) error {
+	if options.StartToCloseTimeout <= 0 {
+		return fmt.Errorf("StartToCloseTimeout must be set")
+	}
+	if options.ScheduleToCloseTimeout > 0 && options.ScheduleToCloseTimeout < options.StartToCloseTimeout {
+		return fmt.Errorf("ScheduleToCloseTimeout %s is shorter than a single attempt (%s)",
+			options.ScheduleToCloseTimeout, options.StartToCloseTimeout)
+	}
+	return nil
+}
+
+// Scanner retry defaults. Scans are expensive, so a failed one is retried
+// once unless the request asks for more.
+const (
+	defaultScanRetryInitialInterval = time.Second * 5
+	defaultScanRetryMaxAttempts     = 2
+	scanRetryMaximumInterval        = time.Minute * 2
+)
+
+// InvalidRetryPolicyError is the non-retryable application error type
+// SecurityScanWorkflow fails with for retry overrides out of range
+const InvalidRetryPolicyError = "InvalidRetryPolicy"
+
+// buildScanRetryPolicy builds the scanners' retry policy, applying
+// request's overrides. Temporal has no jitter setting, so ScanRetryJitter
+// stretches the initial interval by a share of itself picked from seed,
+// the workflow ID: scans rate-limited at the same moment back off by
+// different amounts, and a replay of one scan builds the same policy.
+func buildScanRetryPolicy(request SecurityScanRequest, seed string) (*temporal.RetryPolicy, error) {
+	invalid := func(format string, args ...any) error {
+		return temporal.NewNonRetryableApplicationError(fmt.Sprintf(format, args...), InvalidRetryPolicyError, nil)
+	}
+	if request.ScanRetryInitialInterval < 0 {
+		return nil, invalid("ScanRetryInitialInterval must be positive, got %s", request.ScanRetryInitialInterval)
+	}
+	if request.ScanRetryMaxAttempts < 0 {
+		return nil, invalid("ScanRetryMaxAttempts must be positive, got %d", request.ScanRetryMaxAttempts)
+	}
+	if request.ScanRetryJitter < 0 || request.ScanRetryJitter > 1 {
+		return nil, invalid("ScanRetryJitter must be between 0 and 1, got %g", request.ScanRetryJitter)
+	}
+
+	interval := defaultScanRetryInitialInterval
+	if request.ScanRetryInitialInterval > 0 {
+		interval = request.ScanRetryInitialInterval
+	}
+	if request.ScanRetryJitter > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(seed))
+		share := float64(h.Sum32()) / math.MaxUint32
+		interval += time.Duration(float64(interval) * request.ScanRetryJitter * share)
+	}
+	attempts := int32(defaultScanRetryMaxAttempts)
+	if request.ScanRetryMaxAttempts > 0 {
+		attempts = request.ScanRetryMaxAttempts
+	}
+
+	maxInterval := scanRetryMaximumInterval
+	if interval > maxInterval {
+		maxInterval = interval
+	}
+	return &temporal.RetryPolicy{
+		InitialInterval:    interval,
+		BackoffCoefficient: 1.5,
+		MaximumInterval:    maxInterval,
+		MaximumAttempts:    attempts,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package workflows
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestEstimateMaxDuration_PaymentPolicy(t *testing.T) {
+	// 5 attempts of 2m, plus backoffs of 2s, 4s, 8s and 16s
+	expected := time.Minute*10 + time.Second*30
+
+	got := EstimateMaxDuration(paymentActivityOptions.RetryPolicy, paymentActivityOptions.StartToCloseTimeout)
+	if got != expected {
+		t.Errorf("Expected worst case %s, got %s", expected, got)
+	}
+}
+
+func TestEstimateMaxDuration_CapsBackoffAtMaximumInterval(t *testing.T) {
+	policy := &temporal.RetryPolicy{
+		InitialInterval:    time.Second * 10,
+		BackoffCoefficient: 3.0,
+		MaximumInterval:    time.Second * 20,
+		MaximumAttempts:    4,
+	}
+
+	// Backoffs of 10s, then 30s and 90s capped to 20s
+	expected := time.Minute*4 + time.Second*50
+
+	if got := EstimateMaxDuration(policy, time.Minute); got != expected {
+		t.Errorf("Expected worst case %s, got %s", expected, got)
+	}
+}
+
+func TestEstimateMaxDuration_Unbounded(t *testing.T) {
+	if got := EstimateMaxDuration(nil, time.Minute); got != 0 {
+		t.Errorf("Expected 0 for the default unlimited policy, got %s", got)
+	}
+
+	if got := EstimateMaxDuration(&temporal.RetryPolicy{InitialInterval: time.Second}, time.Minute); got != 0 {
+		t.Errorf("Expected 0 without MaximumAttempts, got %s", got)
+	}
+}
+
+func TestValidateActivityTimeouts(t *testing.T) {
+	if err := validateActivityTimeouts(paymentActivityOptions); err != nil {
+		t.Errorf("Expected payment options to be valid, got %v", err)
+	}
+
+	tooShort := workflow.ActivityOptions{
+		StartToCloseTimeout:    time.Minute * 2,
+		ScheduleToCloseTimeout: time.Minute,
+	}
+	if err := validateActivityTimeouts(tooShort); err == nil {
+		t.Error("Expected an error when ScheduleToCloseTimeout can't fit one attempt")
+	}
+}
+
+func TestBuildScanRetryPolicy(t *testing.T) {
+	policy, err := buildScanRetryPolicy(SecurityScanRequest{}, "scan-1")
+	if err != nil {
+		t.Fatalf("Building the default policy failed: %v", err)
+	}
+	if policy.InitialInterval != time.Second*5 || policy.MaximumAttempts != 2 {
+		t.Errorf("Expected 2 attempts 5s apart by default, got %+v", policy)
+	}
+
+	policy, err = buildScanRetryPolicy(SecurityScanRequest{
+		ScanRetryMaxAttempts:     4,
+		ScanRetryInitialInterval: time.Second * 30,
+	}, "scan-1")
+	if err != nil {
+		t.Fatalf("Building an overridden policy failed: %v", err)
+	}
+	if policy.InitialInterval != time.Second*30 || policy.MaximumAttempts != 4 {
+		t.Errorf("Expected 4 attempts 30s apart, got %+v", policy)
+	}
+	if policy.MaximumInterval < policy.InitialInterval {
+		t.Errorf("Expected MaximumInterval of at least %s, got %s", policy.InitialInterval, policy.MaximumInterval)
+	}
+}
+
+func TestBuildScanRetryPolicy_Jitter(t *testing.T) {
+	request := SecurityScanRequest{ScanRetryInitialInterval: time.Second * 10, ScanRetryJitter: 0.5}
+
+	intervals := make(map[time.Duration]bool)
+	for _, seed := range []string{"scan-1", "scan-2", "scan-3", "scan-4"} {
+		policy, err := buildScanRetryPolicy(request, seed)
+		if err != nil {
+			t.Fatalf("Building a jittered policy failed: %v", err)
+		}
+		if policy.InitialInterval < time.Second*10 || policy.InitialInterval > time.Second*15 {
+			t.Errorf("Expected an interval between 10s and 15s for %s, got %s", seed, policy.InitialInterval)
+		}
+
+		again, _ := buildScanRetryPolicy(request, seed)
+		if again.InitialInterval != policy.InitialInterval {
+			t.Errorf("Expected the same interval for %s on replay, got %s then %s", seed, policy.InitialInterval, again.InitialInterval)
+		}
+		intervals[policy.InitialInterval] = true
+	}
+	if len(intervals) < 2 {
+		t.Errorf("Expected jitter to spread scans' intervals, got %v", intervals)
+	}
+}
+
+func TestBuildScanRetryPolicy_RejectsInvalidOverrides(t *testing.T) {
+	for name, request := range map[string]SecurityScanRequest{
+		"negative interval": {ScanRetryInitialInterval: -time.Second},
+		"negative attempts": {ScanRetryMaxAttempts: -1},
+		"negative jitter":   {ScanRetryJitter: -0.1},
+		"jitter above one":  {ScanRetryJitter: 1.5},
+	} {
+		_, err := buildScanRetryPolicy(request, "scan-1")
+		var appErr *temporal.ApplicationError
+		if !errors.As(err, &appErr) || appErr.Type() != InvalidRetryPolicyError {
+			t.Errorf("%s: expected an %s error, got %v", name, InvalidRetryPolicyError, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	tests := []struct {
+		kind     string
+		expected *temporal.RetryPolicy
+	}{
+		{RetryPolicyOrder, &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    time.Minute,
+			MaximumAttempts:    3,
+		}},
+		{RetryPolicyPayment, &temporal.RetryPolicy{
+			InitialInterval:        time.Second * 2,
+			BackoffCoefficient:     2.0,
+			MaximumInterval:        time.Second * 30,
+			MaximumAttempts:        5,
+			NonRetryableErrorTypes: []string{"FraudDetectedError", "InsufficientFundsError"},
+		}},
+		{RetryPolicyPaymentV2, &temporal.RetryPolicy{
+			InitialInterval:        time.Second,
+			BackoffCoefficient:     1.5,
+			MaximumInterval:        time.Second * 15,
+			MaximumAttempts:        3,
+			NonRetryableErrorTypes: []string{"FraudDetectedError", "InsufficientFundsError", "InvalidCardError", GatewayDeclinedError},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			got := defaultRetryPolicy(tt.kind)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDefaultRetryPolicy_UnknownKindIsStandard(t *testing.T) {
+	got := defaultRetryPolicy("refund")
+	if !reflect.DeepEqual(got, defaultRetryPolicy(RetryPolicyOrder)) {
+		t.Errorf("Expected the order policy for an unknown kind, got %+v", got)
+	}
+}
+
+func TestDefaultRetryPolicy_ReturnsCopies(t *testing.T) {
+	policy := defaultRetryPolicy(RetryPolicyOrder)
+	policy.MaximumAttempts = 10
+
+	if got := defaultRetryPolicy(RetryPolicyOrder).MaximumAttempts; got != 3 {
+		t.Errorf("Expected a changed policy not to leak, got %d attempts", got)
+	}
+}
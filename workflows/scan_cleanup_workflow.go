@@ -0,0 +1,62 @@
+package workflows
+
+import (
+	"errors"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// cleanupBatchSize caps how many scan results one DeleteScanResults call removes
+const cleanupBatchSize = 100
+
+type CleanupResult struct {
+	Cutoff  time.Time // Scans completed before this were purged
+	Deleted int
+}
+
+// ScanCleanupWorkflow purges stored scan results that completed more than
+// olderThan ago. It's meant to run on a Temporal Schedule, e.g. nightly
+// with olderThan set to the retention period.
+func ScanCleanupWorkflow(ctx workflow.Context, olderThan time.Duration) (*CleanupResult, error) {
+	logger := workflow.GetLogger(ctx)
+
+	// A zero retention would wipe every stored scan
+	if olderThan <= 0 {
+		return nil, errors.New("retention must be positive")
+	}
+
+	cutoff := workflow.Now(ctx).Add(-olderThan)
+	logger.Info("Starting scan cleanup", "cutoff", cutoff)
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+
+	var expired []string
+	if err := workflow.ExecuteActivity(ctx, activities.ListExpiredScans, cutoff).Get(ctx, &expired); err != nil {
+		return nil, err
+	}
+
+	result := &CleanupResult{Cutoff: cutoff}
+	for start := 0; start < len(expired); start += cleanupBatchSize {
+		end := start + cleanupBatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+
+		batch := expired[start:end]
+		if err := workflow.ExecuteActivity(ctx, activities.DeleteScanResults, batch).Get(ctx, nil); err != nil {
+			logger.Error("Deleting scan results failed", "deleted", result.Deleted, "error", err)
+			return nil, err
+		}
+		result.Deleted += len(batch)
+	}
+
+	logger.Info("Scan cleanup finished", "deleted", result.Deleted)
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package workflows
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/testsuite"
+)
+
+// memoryScanResultStore is a ScanResultStore over scan completion times
+type memoryScanResultStore struct {
+	completedAt map[string]time.Time
+}
+
+func (s *memoryScanResultStore) ListCompletedBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	var expired []string
+	for scanID, completedAt := range s.completedAt {
+		if completedAt.Before(cutoff) {
+			expired = append(expired, scanID)
+		}
+	}
+	return expired, nil
+}
+
+func (s *memoryScanResultStore) Delete(ctx context.Context, scanIDs []string) error {
+	for _, scanID := range scanIDs {
+		delete(s.completedAt, scanID)
+	}
+	return nil
+}
+
+func TestScanCleanupWorkflow_DeletesExpiredScans(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := &memoryScanResultStore{completedAt: map[string]time.Time{
+		"SEC-old-1": now.AddDate(0, 0, -120),
+		"SEC-old-2": now.AddDate(0, 0, -91),
+		"SEC-new-1": now.AddDate(0, 0, -89),
+		"SEC-new-2": now.Add(-time.Hour),
+	}}
+	a := &Activities{ScanResults: store}
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetStartTime(now)
+	env.RegisterActivity(a.ListExpiredScans)
+	env.RegisterActivity(a.DeleteScanResults)
+
+	env.ExecuteWorkflow(ScanCleanupWorkflow, time.Hour*24*90)
+
+	var result CleanupResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Deleted != 2 {
+		t.Errorf("Expected 2 deleted scans, got %d", result.Deleted)
+	}
+
+	for _, scanID := range []string{"SEC-old-1", "SEC-old-2"} {
+		if _, ok := store.completedAt[scanID]; ok {
+			t.Errorf("Expected %s to be deleted", scanID)
+		}
+	}
+
+	for _, scanID := range []string{"SEC-new-1", "SEC-new-2"} {
+		if _, ok := store.completedAt[scanID]; !ok {
+			t.Errorf("Expected %s to be retained", scanID)
+		}
+	}
+}
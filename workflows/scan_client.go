@@ -0,0 +1,68 @@
+package workflows
+
+import (
+	"context"
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+)
+
+// Scan priorities for SecurityScanRequest.Priority
+const (
+	ScanPriorityHigh   = "high" // e.g. scans blocking a pull request
+	ScanPriorityNormal = "normal"
+	ScanPriorityLow    = "low" // e.g. nightly scans
+)
+
+// RouteScan returns the task queue a scan runs on. High-priority scans go
+// to SecurityPriorityTaskQueue, which has its own worker; everything else
+// shares SecurityTaskQueue.
+func RouteScan(request SecurityScanRequest) string {
+	if request.Priority == ScanPriorityHigh {
+		return SecurityPriorityTaskQueue
+	}
+	return SecurityTaskQueue
+}
+
+// ScanOption customizes how StartSecurityScan starts SecurityScanWorkflow
+type ScanOption func(*client.StartWorkflowOptions)
+
+// WithRetryPolicy retries the whole workflow run with policy
+func WithRetryPolicy(policy *temporal.RetryPolicy) ScanOption {
+	return func(options *client.StartWorkflowOptions) {
+		options.RetryPolicy = policy
+	}
+}
+
+// WithTimeout bounds the workflow execution, including any retries
+func WithTimeout(timeout time.Duration) ScanOption {
+	return func(options *client.StartWorkflowOptions) {
+		options.WorkflowExecutionTimeout = timeout
+	}
+}
+
+// WithTaskQueue starts the scan on a queue other than the one RouteScan picks
+func WithTaskQueue(taskQueue string) ScanOption {
+	return func(options *client.StartWorkflowOptions) {
+		options.TaskQueue = taskQueue
+	}
+}
+
+// StartSecurityScan starts a SecurityScanWorkflow on the queue RouteScan
+// picks and returns without waiting for it to finish. Execution settings
+// are applied from opts.
+func StartSecurityScan(ctx context.Context, c client.Client, request SecurityScanRequest, agentCtx AgentContext, opts ...ScanOption) (client.WorkflowRun, error) {
+	opts = append([]ScanOption{WithTaskQueue(RouteScan(request))}, opts...)
+	return c.ExecuteWorkflow(ctx, securityScanStartOptions(opts...), SecurityScanWorkflow, request, agentCtx)
+}
+
+func securityScanStartOptions(opts ...ScanOption) client.StartWorkflowOptions {
+	options := client.StartWorkflowOptions{
+		TaskQueue: SecurityTaskQueue,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -0,0 +1,90 @@
+package workflows
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+)
+
+// recordingClient records the options workflows are started with
+type recordingClient struct {
+	client.Client
+	options client.StartWorkflowOptions
+}
+
+func (c *recordingClient) ExecuteWorkflow(ctx context.Context, options client.StartWorkflowOptions, workflow any, args ...any) (client.WorkflowRun, error) {
+	c.options = options
+	return nil, nil
+}
+
+func TestSecurityScanStartOptions_Defaults(t *testing.T) {
+	options := securityScanStartOptions()
+
+	if options.TaskQueue != SecurityTaskQueue {
+		t.Errorf("Expected task queue %s, got %s", SecurityTaskQueue, options.TaskQueue)
+	}
+
+	if options.RetryPolicy != nil || options.WorkflowExecutionTimeout != 0 {
+		t.Errorf("Expected no retry policy or timeout by default, got %+v", options)
+	}
+}
+
+func TestSecurityScanStartOptions_FunctionalOptions(t *testing.T) {
+	policy := &temporal.RetryPolicy{MaximumAttempts: 2}
+
+	options := securityScanStartOptions(
+		WithRetryPolicy(policy),
+		WithTimeout(time.Hour),
+		WithTaskQueue("security-scanning-priority"),
+	)
+
+	if options.RetryPolicy != policy {
+		t.Errorf("Expected retry policy %+v, got %+v", policy, options.RetryPolicy)
+	}
+
+	if options.WorkflowExecutionTimeout != time.Hour {
+		t.Errorf("Expected execution timeout 1h, got %s", options.WorkflowExecutionTimeout)
+	}
+
+	if options.TaskQueue != "security-scanning-priority" {
+		t.Errorf("Expected task queue security-scanning-priority, got %s", options.TaskQueue)
+	}
+}
+
+func TestStartSecurityScan_RoutesByPriority(t *testing.T) {
+	tests := []struct {
+		priority  string
+		taskQueue string
+	}{
+		{ScanPriorityHigh, SecurityPriorityTaskQueue},
+		{ScanPriorityNormal, SecurityTaskQueue},
+		{ScanPriorityLow, SecurityTaskQueue},
+		{"", SecurityTaskQueue},
+	}
+
+	for _, tt := range tests {
+		c := &recordingClient{}
+		request := SecurityScanRequest{RepositoryURL: "https://github.com/example/repo", Priority: tt.priority}
+
+		if _, err := StartSecurityScan(context.Background(), c, request, AgentContext{}); err != nil {
+			t.Fatalf("StartSecurityScan failed: %v", err)
+		}
+
+		if c.options.TaskQueue != tt.taskQueue {
+			t.Errorf("Expected priority %q to dispatch to %s, got %s", tt.priority, tt.taskQueue, c.options.TaskQueue)
+		}
+	}
+
+	// An explicit queue still wins over the route
+	c := &recordingClient{}
+	request := SecurityScanRequest{Priority: ScanPriorityHigh}
+	if _, err := StartSecurityScan(context.Background(), c, request, AgentContext{}, WithTaskQueue("security-scanning-canary")); err != nil {
+		t.Fatalf("StartSecurityScan failed: %v", err)
+	}
+	if c.options.TaskQueue != "security-scanning-canary" {
+		t.Errorf("Expected WithTaskQueue to override the route, got %s", c.options.TaskQueue)
+	}
+}
@@ -0,0 +1,59 @@
+package workflows
+
+import (
+	"path"
+	"strings"
+)
+
+// dependencyManifests are the lockfiles and manifests the dependency
+// scanner reads
+var dependencyManifests = map[string]bool{
+	"go.mod":            true,
+	"package.json":      true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"requirements.txt":  true,
+	"Pipfile":           true,
+	"pyproject.toml":    true,
+	"pom.xml":           true,
+	"build.gradle":      true,
+	"Gemfile":           true,
+	"Cargo.toml":        true,
+}
+
+// scanTypeForFile returns the scan type a repository file calls for, or ""
+func scanTypeForFile(file string) string {
+	name := path.Base(file)
+	switch {
+	case dependencyManifests[name]:
+		return "dependency"
+	case name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".dockerfile"):
+		return "container"
+	case strings.HasSuffix(name, ".tf") || name == "Chart.yaml":
+		return "iac"
+	}
+	return ""
+}
+
+// detectScanTypes returns the scan types repository files call for, in
+// scanTypeOrder and without duplicates
+func detectScanTypes(files []string) []string {
+	found := make(map[string]bool)
+	for _, file := range files {
+		if scanType := scanTypeForFile(file); scanType != "" {
+			found[scanType] = true
+		}
+	}
+
+	var scanTypes []string
+	for _, scanType := range scanTypeOrder {
+		if found[scanType] {
+			scanTypes = append(scanTypes, scanType)
+		}
+	}
+	return scanTypes
+}
+
+// scanTypeOrder is the order detectScanTypes returns scan types in, so the
+// same files always give the same list
+var scanTypeOrder = []string{"container", "dependency", "iac"}
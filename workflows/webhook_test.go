@@ -0,0 +1,87 @@
+package workflows
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const samplePushPayload = `{
+  "ref": "refs/heads/main",
+  "before": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+  "after": "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+  "deleted": false,
+  "repository": {
+    "full_name": "example/repo",
+    "clone_url": "https://github.com/example/repo.git"
+  },
+  "commits": [
+    {"id": "1f2e3d", "added": ["cmd/server/main.go"], "modified": ["go.mod"], "removed": []},
+    {"id": "6113728f", "added": [], "modified": ["go.mod", "internal/auth/token.go"], "removed": ["legacy.go"]}
+  ]
+}`
+
+func TestScanRequestFromWebhook_Push(t *testing.T) {
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(samplePushPayload), &payload); err != nil {
+		t.Fatalf("Decoding payload failed: %v", err)
+	}
+	payload.Event = "push"
+
+	request, err := scanRequestFromWebhook(payload)
+	if err != nil {
+		t.Fatalf("Parsing payload failed: %v", err)
+	}
+
+	if request.RepositoryURL != "https://github.com/example/repo.git" {
+		t.Errorf("Expected repository https://github.com/example/repo.git, got %s", request.RepositoryURL)
+	}
+
+	if request.Branch != "main" {
+		t.Errorf("Expected branch main, got %s", request.Branch)
+	}
+
+	if request.CommitSHA != "6113728f27ae82c7b1a177c8d03f9e96e0adf246" {
+		t.Errorf("Expected the pushed head commit, got %s", request.CommitSHA)
+	}
+
+	expectedFiles := "cmd/server/main.go,go.mod,internal/auth/token.go"
+	if got := strings.Join(request.ChangedFiles, ","); got != expectedFiles {
+		t.Errorf("Expected changed files %s, got %s", expectedFiles, got)
+	}
+}
+
+func TestScanRequestFromWebhook_RejectsMalformed(t *testing.T) {
+	valid := func() WebhookPayload {
+		return WebhookPayload{
+			Event:      "push",
+			Ref:        "refs/heads/main",
+			After:      "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+			Repository: WebhookRepository{CloneURL: "https://github.com/example/repo.git"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*WebhookPayload)
+	}{
+		{"unsupported event", func(p *WebhookPayload) { p.Event = "issues" }},
+		{"tag push", func(p *WebhookPayload) { p.Ref = "refs/tags/v1.0.0" }},
+		{"branch deleted", func(p *WebhookPayload) { p.Deleted = true }},
+		{"missing commit", func(p *WebhookPayload) { p.After = "" }},
+		{"malformed commit", func(p *WebhookPayload) { p.After = "$(whoami)" }},
+		{"unsafe repository URL", func(p *WebhookPayload) { p.Repository.CloneURL = "https://x;rm -rf /" }},
+		{"pull request without body", func(p *WebhookPayload) { p.Event = "pull_request" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := valid()
+			tt.mutate(&payload)
+
+			if _, err := scanRequestFromWebhook(payload); err == nil {
+				t.Error("Expected the payload to be rejected")
+			}
+		})
+	}
+}
@@ -1,9 +1,21 @@
 package workflows
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"time"
 
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/uber-go/tally/v4"
+	tallyprom "github.com/uber-go/tally/v4/prometheus"
+	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	sdktally "go.temporal.io/sdk/contrib/tally"
 	"go.temporal.io/sdk/worker"
 )
 
@@ -11,101 +23,629 @@ const (
 	OrderTaskQueue    = "order-processing"
 	PaymentTaskQueue  = "payment-processing"
 	SecurityTaskQueue = "security-scanning"
+	RefundTaskQueue   = "refund-processing"
+
+	// SecurityPriorityTaskQueue serves ScanPriorityHigh scans, so urgent
+	// PR-blocking scans don't wait behind nightly ones
+	SecurityPriorityTaskQueue = "security-scanning-priority"
 )
 
 // WorkerConfig holds configuration for Temporal workers
 type WorkerConfig struct {
-	TemporalHost      string
-	TemporalNamespace string
-	WorkerID          string
+	TemporalHost          string
+	TemporalNamespace     string
+	Namespaces            []string // StartNamespaceWorkers only; serves each listed namespace instead of TemporalNamespace
+	WorkerID              string
+	MaxScansPerRepository int // Security worker only; zero uses DefaultMaxScansPerRepository
+
+	// Security worker only; how long a scan holds its repository scan slot
+	// if it never releases it. Zero uses DefaultRepoScanSlotLease.
+	RepoScanSlotLease time.Duration
+
+	// Security worker only; zero uses DefaultNotificationSuppressionWindow
+	NotificationSuppressionWindow time.Duration
+
+	// Payment worker only; adds to or overrides the decimal places
+	// ValidateCurrencyAmount allows per currency code
+	CurrencyMinorUnits map[string]int
+
+	// Payment worker only; zero uses DefaultGatewayRateLimitBackoff
+	GatewayRateLimitBackoff time.Duration
+
+	// Order worker only; how long ArchiveOrder keeps archived orders.
+	// Zero uses DefaultOrderArchiveRetention.
+	OrderArchiveRetention time.Duration
+
+	// PayloadEncryptionKey, when set, encrypts workflow payloads with
+	// AESPayloadCodec so payment details aren't stored in history in
+	// plaintext. Every worker and client exchanging payloads with payment
+	// workflows needs the same key, including the order worker, which starts
+	// them as child workflows.
+	PayloadEncryptionKeyID string
+	PayloadEncryptionKey   []byte
+
+	// TLSCertPath and TLSKeyPath are the PEM client certificate and key for
+	// mTLS, as Temporal Cloud requires. ServerName overrides the name the
+	// server's certificate is verified against. Leaving all three empty
+	// connects without TLS, unless APIKey is set.
+	TLSCertPath string
+	TLSKeyPath  string
+	ServerName  string
+
+	// APIKey authenticates to Temporal Cloud instead of a client
+	// certificate. Setting it connects over TLS.
+	APIKey string
+
+	// MetricsListenAddr, e.g. ":9090", is where the Start*Worker functions,
+	// StartAllWorkers and StartNamespaceWorkers serve SDK and workflow
+	// metrics for Prometheus to scrape, at /metrics. Empty serves none.
+	MetricsListenAddr string
+
+	// DrainTimeout is how long a stopping worker waits for in-flight
+	// activities to finish before abandoning them. Zero uses
+	// DefaultDrainTimeout.
+	DrainTimeout time.Duration
 }
 
-// StartOrderWorker initializes and starts the order processing worker
-func StartOrderWorker(config WorkerConfig) error {
-	c, err := client.Dial(client.Options{
+// DefaultDrainTimeout is how long stopping workers wait for in-flight
+// activities when WorkerConfig.DrainTimeout is zero
+const DefaultDrainTimeout = 30 * time.Second
+
+// clientOptions builds the client options for config, adding TLS and
+// credentials when configured and the encrypting data converter when a
+// payload key is configured
+func clientOptions(config WorkerConfig) (client.Options, error) {
+	options := client.Options{
 		HostPort:  config.TemporalHost,
 		Namespace: config.TemporalNamespace,
+	}
+	tlsConfig, err := clientTLSConfig(config)
+	if err != nil {
+		return client.Options{}, err
+	}
+	options.ConnectionOptions.TLS = tlsConfig
+	if config.APIKey != "" {
+		options.Credentials = client.NewAPIKeyStaticCredentials(config.APIKey)
+	}
+	if len(config.PayloadEncryptionKey) > 0 {
+		codec, err := NewAESPayloadCodec(config.PayloadEncryptionKeyID, config.PayloadEncryptionKey)
+		if err != nil {
+			return client.Options{}, err
+		}
+		options.DataConverter = encryptingDataConverter(codec)
+	}
+	return options, nil
+}
+
+// clientTLSConfig is the TLS config for connecting to Temporal, or nil to
+// connect without TLS when config sets no TLS fields and no APIKey
+func clientTLSConfig(config WorkerConfig) (*tls.Config, error) {
+	mTLS := config.TLSCertPath != "" || config.TLSKeyPath != ""
+	if !mTLS && config.ServerName == "" && config.APIKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: config.ServerName}
+	if !mTLS {
+		return tlsConfig, nil
+	}
+	if config.TLSCertPath == "" || config.TLSKeyPath == "" {
+		return nil, errors.New("TLSCertPath and TLSKeyPath must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(config.TLSCertPath, config.TLSKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS client certificate %s: %w", config.TLSCertPath, err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return tlsConfig, nil
+}
+
+// workerOptions are the options every worker starts with
+func workerOptions(config WorkerConfig) worker.Options {
+	drainTimeout := config.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+	return worker.Options{
+		Identity:          config.WorkerID,
+		WorkerStopTimeout: drainTimeout,
+	}
+}
+
+// runWorker runs w until ctx is cancelled, then stops it, waiting up to the
+// worker's stop timeout for in-flight activities. A fatal worker error,
+// such as its namespace being deleted, ends it early and is returned.
+func runWorker(ctx context.Context, w worker.Worker) error {
+	interruptCh := make(chan interface{})
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(interruptCh)
+		case <-stopped:
+		}
+	}()
+	return w.Run(interruptCh)
+}
+
+// dialClient connects to Temporal with clientOptions, reporting SDK
+// metrics to metrics unless it's nil
+func dialClient(config WorkerConfig, metrics client.MetricsHandler) (client.Client, error) {
+	options, err := clientOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	if metrics != nil {
+		options.MetricsHandler = metrics
+	}
+	return client.Dial(options)
+}
+
+// newClientWithMetrics dials Temporal like dialClient. When config sets
+// MetricsListenAddr, the client reports to a Prometheus registry served at
+// /metrics on that address. closeClient closes the client and stops
+// serving.
+func newClientWithMetrics(config WorkerConfig) (c client.Client, closeClient func(), err error) {
+	if config.MetricsListenAddr == "" {
+		c, err := dialClient(config, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, c.Close, nil
+	}
+
+	metrics, stopServing, err := serveMetrics(config.MetricsListenAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err = dialClient(config, metrics)
+	if err != nil {
+		stopServing()
+		return nil, nil, err
+	}
+	return c, func() {
+		c.Close()
+		stopServing()
+	}, nil
+}
+
+// serveMetrics serves a Prometheus registry at /metrics on addr, returning
+// a MetricsHandler that reports to it and a func that stops serving
+func serveMetrics(addr string) (client.MetricsHandler, func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening for metrics on %s: %w", addr, err)
+	}
+
+	reporter := tallyprom.NewReporter(tallyprom.Options{
+		Registerer: prom.NewRegistry(),
+		OnRegisterError: func(err error) {
+			log.Printf("Registering metric failed: %v", err)
+		},
 	})
+	scope, scopeCloser := tally.NewRootScope(tally.ScopeOptions{
+		CachedReporter:  reporter,
+		Separator:       tallyprom.DefaultSeparator,
+		SanitizeOptions: &sdktally.PrometheusSanitizeOptions,
+	}, time.Second)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reporter.HTTPHandler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Serving metrics failed: %v", err)
+		}
+	}()
+	return sdktally.NewMetricsHandler(sdktally.NewPrometheusNamingScope(scope)), func() {
+		server.Close()
+		scopeCloser.Close()
+	}, nil
+}
+
+// closingClient is a client whose Close also runs cleanup, such as
+// stopping the metrics server newClientWithMetrics started for it
+type closingClient struct {
+	client.Client
+	close func()
+}
+
+func (c closingClient) Close() {
+	c.close()
+}
+
+// StartOrderWorker initializes and runs the order processing worker until
+// ctx is cancelled, then drains it
+func StartOrderWorker(ctx context.Context, config WorkerConfig) error {
+	c, closeClient, err := newClientWithMetrics(config)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
+	defer closeClient()
 
-	w := worker.New(c, OrderTaskQueue, worker.Options{
-		Identity: config.WorkerID,
-	})
+	w := worker.New(c, OrderTaskQueue, workerOptions(config))
+	registerOrderWorker(recoverActivityPanics(w), NewActivities(config))
 
+	log.Printf("Starting order worker on queue: %s", OrderTaskQueue)
+	return runWorker(ctx, w)
+}
+
+// registerOrderWorker registers everything served on OrderTaskQueue, with
+// a's methods as the activities that need dependencies. Shared with the
+// integration harness so tests exercise the real registrations.
+func registerOrderWorker(r worker.Registry, a *Activities) {
 	// Register workflows
-	w.RegisterWorkflow(OrderWorkflow)
+	r.RegisterWorkflow(OrderWorkflow)
+	r.RegisterWorkflow(BatchOrderWorkflow)
 
 	// Register activities
-	w.RegisterActivity(ValidateInventory)
-	w.RegisterActivity(GenerateShippingLabel)
-	w.RegisterActivity(RefundPayment)
-
-	log.Printf("Starting order worker on queue: %s", OrderTaskQueue)
-	return w.Run(worker.InterruptCh())
+	r.RegisterActivity(ValidateInventory)
+	r.RegisterActivity(GenerateShippingLabel)
+	r.RegisterActivity(RefundPayment)
+	r.RegisterActivity(ReleaseInventory)
+	r.RegisterActivity(CapturePayment)
+	r.RegisterActivity(VoidPayment)
+	r.RegisterActivity(a.ProcessPayment)
+	r.RegisterActivity(PersistOrderAudit)
+	r.RegisterActivity(a.ArchiveOrder)
+	r.RegisterActivity(SendOrderWebhook)
+	r.RegisterActivity(RecordWebhookDeadLetter)
+	r.RegisterActivity(a.GetOrderCheckpoint)
+	r.RegisterActivity(a.SaveOrderCheckpoint)
+	registerSharedActivities(r)
 }
 
-// StartPaymentWorker initializes and starts the payment processing worker
-func StartPaymentWorker(config WorkerConfig) error {
-	c, err := client.Dial(client.Options{
-		HostPort:  config.TemporalHost,
-		Namespace: config.TemporalNamespace,
-	})
+// StartPaymentWorker initializes and runs the payment processing worker
+// until ctx is cancelled, then drains it
+func StartPaymentWorker(ctx context.Context, config WorkerConfig) error {
+	c, closeClient, err := newClientWithMetrics(config)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
+	defer closeClient()
 
-	w := worker.New(c, PaymentTaskQueue, worker.Options{
-		Identity: config.WorkerID,
-	})
+	w := worker.New(c, PaymentTaskQueue, workerOptions(config))
+	registerPaymentWorker(recoverActivityPanics(w), NewActivities(config))
 
+	log.Printf("Starting payment worker on queue: %s", PaymentTaskQueue)
+	return runWorker(ctx, w)
+}
+
+// registerPaymentWorker registers everything served on PaymentTaskQueue.
+func registerPaymentWorker(r worker.Registry, a *Activities) {
 	// Register both v1 and v2 workflows for migration period
-	w.RegisterWorkflow(PaymentWorkflow)
-	w.RegisterWorkflow(PaymentWorkflowV2)
+	r.RegisterWorkflow(PaymentWorkflow)
+	r.RegisterWorkflow(PaymentWorkflowV2)
 
 	// Register activities
-	w.RegisterActivity(CheckFraud)
-	w.RegisterActivity(CheckFraudV2)
-	w.RegisterActivity(ValidateCard)
-	w.RegisterActivity(ChargePaymentMethod)
-	w.RegisterActivity(ChargePaymentMethodV2)
-	w.RegisterActivity(SendPaymentConfirmation)
+	r.RegisterActivity(CheckFraud)
+	r.RegisterActivity(CheckFraudV2)
+	r.RegisterActivity(RecordFraudDecision)
+	r.RegisterActivity(QueueForReview)
+	r.RegisterActivity(Request3DSChallenge)
+	r.RegisterActivity(a.ValidateCurrencyAmount)
+	r.RegisterActivity(a.ConvertCurrency)
+	r.RegisterActivity(ValidateCard)
+	r.RegisterActivity(a.CheckTrustStatus)
+	r.RegisterActivity(a.CheckSpendingLimit)
+	r.RegisterActivity(VerifyBalance)
+	r.RegisterActivity(ChargePaymentMethod)
+	r.RegisterActivity(AuthorizePayment)
+	r.RegisterActivity(a.ChargePaymentMethodV2)
+	r.RegisterActivity(RefundPayment)
+	r.RegisterActivity(VoidPayment)
+	r.RegisterActivity(a.SendPaymentConfirmation)
+	registerSharedActivities(r)
+}
 
-	log.Printf("Starting payment worker on queue: %s", PaymentTaskQueue)
-	return w.Run(worker.InterruptCh())
+// StartRefundWorker initializes and runs the refund processing worker
+// until ctx is cancelled, then drains it
+func StartRefundWorker(ctx context.Context, config WorkerConfig) error {
+	c, closeClient, err := newClientWithMetrics(config)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	w := worker.New(c, RefundTaskQueue, workerOptions(config))
+	registerRefundWorker(recoverActivityPanics(w), NewActivities(config))
+
+	log.Printf("Starting refund worker on queue: %s", RefundTaskQueue)
+	return runWorker(ctx, w)
 }
 
-// StartSecurityWorker initializes and starts the security scanning worker
-// This worker handles AI agent-initiated security scans
-func StartSecurityWorker(config WorkerConfig) error {
-	c, err := client.Dial(client.Options{
-		HostPort:  config.TemporalHost,
-		Namespace: config.TemporalNamespace,
-	})
+// registerRefundWorker registers everything served on RefundTaskQueue.
+func registerRefundWorker(r worker.Registry, a *Activities) {
+	r.RegisterWorkflow(RefundWorkflow)
+
+	r.RegisterActivity(GetRefundableAmount)
+	r.RegisterActivity(RefundPaymentPartial)
+	registerSharedActivities(r)
+}
+
+// StartSecurityWorker initializes and runs the security scanning worker,
+// which handles AI agent-initiated security scans, until ctx is cancelled,
+// then drains it
+func StartSecurityWorker(ctx context.Context, config WorkerConfig) error {
+	return runSecurityWorker(ctx, config, SecurityTaskQueue)
+}
+
+// StartPrioritySecurityWorker runs a security worker on
+// SecurityPriorityTaskQueue. Run it alongside StartSecurityWorker.
+func StartPrioritySecurityWorker(ctx context.Context, config WorkerConfig) error {
+	return runSecurityWorker(ctx, config, SecurityPriorityTaskQueue)
+}
+
+func runSecurityWorker(ctx context.Context, config WorkerConfig, taskQueue string) error {
+	c, closeClient, err := newClientWithMetrics(config)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
+	defer closeClient()
 
-	w := worker.New(c, SecurityTaskQueue, worker.Options{
-		Identity:                  config.WorkerID,
-		MaxConcurrentActivityExecutionSize: 5, // Limit concurrent scans
-	})
+	w := worker.New(c, taskQueue, securityWorkerOptions(config))
+	registerSecurityWorker(recoverActivityPanics(w), NewActivities(config))
+
+	log.Printf("Starting security worker on queue: %s", taskQueue)
+	return runWorker(ctx, w)
+}
 
+func securityWorkerOptions(config WorkerConfig) worker.Options {
+	options := workerOptions(config)
+	options.MaxConcurrentActivityExecutionSize = 5 // Limit concurrent scans
+	return options
+}
+
+// registerSecurityWorker registers everything served on SecurityTaskQueue
+// and SecurityPriorityTaskQueue.
+func registerSecurityWorker(r worker.Registry, a *Activities) {
 	// Register security workflow
-	w.RegisterWorkflow(SecurityScanWorkflow)
+	r.RegisterWorkflow(SecurityScanWorkflow)
+	r.RegisterWorkflow(ReportGenerationWorkflow)
+	r.RegisterWorkflow(CompareBranchesWorkflow)
+	r.RegisterWorkflow(CIGateWorkflow)
+	r.RegisterWorkflow(FleetSecurityScanWorkflow)
+	r.RegisterWorkflow(ScanCleanupWorkflow)
+	r.RegisterWorkflow(RemediationWorkflow)
 
 	// Register scan activities
-	w.RegisterActivity(RunSASTScan)
-	w.RegisterActivity(RunDASTScan)
-	w.RegisterActivity(RunDependencyScan)
-	w.RegisterActivity(RunSecretsScan)
-	w.RegisterActivity(GenerateSecurityReport)
-	w.RegisterActivity(NotifyComplianceTeam)
-
-	log.Printf("Starting security worker on queue: %s", SecurityTaskQueue)
-	return w.Run(worker.InterruptCh())
+	r.RegisterActivity(LoadRepoScanConfig)
+	r.RegisterActivity(a.DetectApplicableScans)
+	r.RegisterActivity(ComputeChangedFiles)
+	r.RegisterActivity(a.CheckRepoScanConcurrency)
+	r.RegisterActivity(a.ReleaseRepoScanSlot)
+	r.RegisterActivity(a.CheckScanCache)
+	r.RegisterActivity(a.StoreScanCache)
+	r.RegisterActivity(a.RunSASTScan)
+	r.RegisterActivity(a.RunDASTScan)
+	r.RegisterActivity(RunDependencyScan)
+	r.RegisterActivity(RunSecretsScan)
+	r.RegisterActivity(GenerateSBOM)
+	r.RegisterActivity(GenerateAttestation)
+	r.RegisterActivity(a.EnrichVulnerabilities)
+	r.RegisterActivity(a.ResolveOwnership)
+	r.RegisterActivity(a.GenerateSecurityReport)
+	r.RegisterActivity(a.CheckNotificationSuppression)
+	r.RegisterActivity(a.RecordNotificationSent)
+	r.RegisterActivity(NotifyComplianceTeam)
+	r.RegisterActivity(a.ExportScanMetrics)
+	r.RegisterActivity(a.UpdateBaseline)
+	r.RegisterActivity(a.ListExpiredScans)
+	r.RegisterActivity(a.DeleteScanResults)
+	r.RegisterActivity(VerifyRemediation)
+	r.RegisterActivity(ApplyRemediations)
+	registerSharedActivities(r)
+}
+
+// registerSharedActivities registers activities every queue serves, so
+// workflows on any queue can schedule them without naming a task queue
+func registerSharedActivities(r worker.Registry) {
+	r.RegisterActivity(EvaluateFeatureFlag)
+}
+
+// WorkerDescription lists what a worker serves, by the names workflows and
+// activities are registered under, for checking a deployment before it
+// takes traffic
+type WorkerDescription struct {
+	TaskQueue  string
+	Workflows  []string
+	Activities []string
+}
+
+// describingRegistry records registrations into a WorkerDescription
+// instead of serving them
+type describingRegistry struct {
+	worker.Registry
+	description *WorkerDescription
+}
+
+func (r describingRegistry) RegisterWorkflow(w any) {
+	r.description.Workflows = append(r.description.Workflows, activityName(w))
+}
+
+func (r describingRegistry) RegisterActivity(a any) {
+	r.RegisterActivityWithOptions(a, activity.RegisterOptions{})
+}
+
+func (r describingRegistry) RegisterActivityWithOptions(a any, options activity.RegisterOptions) {
+	name := options.Name
+	if name == "" {
+		name = activityName(a)
+	}
+	r.description.Activities = append(r.description.Activities, name)
+}
+
+// describeWorker runs register against a describingRegistry
+func describeWorker(taskQueue string, register func(worker.Registry, *Activities)) WorkerDescription {
+	description := WorkerDescription{TaskQueue: taskQueue}
+	register(describingRegistry{description: &description}, NewActivities(WorkerConfig{}))
+	return description
+}
+
+// DescribeOrderWorker describes what StartOrderWorker serves, without
+// starting it
+func DescribeOrderWorker() WorkerDescription {
+	return describeWorker(OrderTaskQueue, registerOrderWorker)
+}
+
+// DescribePaymentWorker describes what StartPaymentWorker serves, without
+// starting it
+func DescribePaymentWorker() WorkerDescription {
+	return describeWorker(PaymentTaskQueue, registerPaymentWorker)
+}
+
+// DescribeRefundWorker describes what StartRefundWorker serves, without
+// starting it
+func DescribeRefundWorker() WorkerDescription {
+	return describeWorker(RefundTaskQueue, registerRefundWorker)
+}
+
+// DescribeSecurityWorker describes what StartSecurityWorker serves, without
+// starting it. StartPrioritySecurityWorker serves the same on
+// SecurityPriorityTaskQueue.
+func DescribeSecurityWorker() WorkerDescription {
+	return describeWorker(SecurityTaskQueue, registerSecurityWorker)
+}
+
+// DescribeAllWorkers describes each worker StartAllWorkers starts, in the
+// same order
+func DescribeAllWorkers() []WorkerDescription {
+	var descriptions []WorkerDescription
+	for _, spec := range workerSpecs(WorkerConfig{}) {
+		descriptions = append(descriptions, describeWorker(spec.taskQueue, spec.register))
+	}
+	return descriptions
+}
+
+// workerSpec describes the worker serving one task queue
+type workerSpec struct {
+	taskQueue string
+	options   worker.Options
+	register  func(worker.Registry, *Activities)
+}
+
+func workerSpecs(config WorkerConfig) []workerSpec {
+	return []workerSpec{
+		{OrderTaskQueue, workerOptions(config), registerOrderWorker},
+		{PaymentTaskQueue, workerOptions(config), registerPaymentWorker},
+		{SecurityTaskQueue, securityWorkerOptions(config), registerSecurityWorker},
+		{SecurityPriorityTaskQueue, securityWorkerOptions(config), registerSecurityWorker},
+		{RefundTaskQueue, workerOptions(config), registerRefundWorker},
+	}
+}
+
+// StartAllWorkers starts order, payment, security (standard and priority)
+// and refund workers on a single client, for deployments that serve every
+// queue from one process. With MetricsListenAddr set, it serves metrics
+// like the Start*Worker functions. It returns without blocking; stop
+// everything with StopAllWorkers.
+func StartAllWorkers(config WorkerConfig) ([]worker.Worker, client.Client, error) {
+	c, closeClient, err := newClientWithMetrics(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return startWorkers(config, closingClient{Client: c, close: closeClient})
+}
+
+// startWorkers starts every queue's worker on c. If one fails to start,
+// the ones already started are stopped and c is closed.
+func startWorkers(config WorkerConfig, c client.Client) ([]worker.Worker, client.Client, error) {
+	a := NewActivities(config)
+	var workers []worker.Worker
+	for _, spec := range workerSpecs(config) {
+		w := worker.New(c, spec.taskQueue, spec.options)
+		spec.register(recoverActivityPanics(w), a)
+
+		if err := w.Start(); err != nil {
+			StopAllWorkers(workers, c)
+			return nil, nil, fmt.Errorf("starting worker on queue %s: %w", spec.taskQueue, err)
+		}
+		log.Printf("Started worker on queue: %s", spec.taskQueue)
+		workers = append(workers, w)
+	}
+
+	return workers, c, nil
+}
+
+// StartNamespaceWorkers starts every queue's worker once per namespace in
+// config.Namespaces, for multi-tenant deployments where each tenant has its
+// own namespace. With MetricsListenAddr set, one endpoint serves every
+// namespace's metrics, which the SDK tags by namespace. Stop everything
+// with StopNamespaceWorkers.
+func StartNamespaceWorkers(config WorkerConfig) ([]worker.Worker, []client.Client, error) {
+	var (
+		workers []worker.Worker
+		clients []client.Client
+	)
+	var metrics client.MetricsHandler
+	stopServing := func() {}
+	if config.MetricsListenAddr != "" {
+		var err error
+		if metrics, stopServing, err = serveMetrics(config.MetricsListenAddr); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i, namespace := range workerNamespaces(config) {
+		namespaceConfig := config
+		namespaceConfig.TemporalNamespace = namespace
+		namespaceConfig.Namespaces = nil
+
+		c, err := dialClient(namespaceConfig, metrics)
+		if err != nil {
+			StopNamespaceWorkers(workers, clients)
+			if i == 0 {
+				stopServing()
+			}
+			return nil, nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+		if i == 0 {
+			// Serving stops with the first client, which
+			// StopNamespaceWorkers closes once every worker has stopped
+			first := c
+			c = closingClient{Client: first, close: func() {
+				first.Close()
+				stopServing()
+			}}
+		}
+
+		w, c, err := startWorkers(namespaceConfig, c)
+		if err != nil {
+			StopNamespaceWorkers(workers, clients)
+			return nil, nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+		workers = append(workers, w...)
+		clients = append(clients, c)
+	}
+	return workers, clients, nil
+}
+
+// StopNamespaceWorkers stops workers from StartNamespaceWorkers, then
+// closes their clients
+func StopNamespaceWorkers(workers []worker.Worker, clients []client.Client) {
+	for _, w := range workers {
+		w.Stop()
+	}
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// workerNamespaces lists the namespaces config serves: Namespaces when set,
+// otherwise just TemporalNamespace
+func workerNamespaces(config WorkerConfig) []string {
+	if len(config.Namespaces) > 0 {
+		return config.Namespaces
+	}
+	return []string{config.TemporalNamespace}
+}
+
+// StopAllWorkers gracefully stops workers from StartAllWorkers, letting
+// in-flight tasks finish, then closes the client
+func StopAllWorkers(workers []worker.Worker, c client.Client) {
+	for _, w := range workers {
+		w.Stop()
+	}
+	c.Close()
 }
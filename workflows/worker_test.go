@@ -0,0 +1,209 @@
+package workflows
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.temporal.io/sdk/worker"
+)
+
+// recordingRegistry records registered workflow and activity names
+type recordingRegistry struct {
+	worker.Registry
+	workflows  []string
+	activities []string
+}
+
+func (r *recordingRegistry) RegisterWorkflow(w any) {
+	r.workflows = append(r.workflows, activityName(w))
+}
+
+func (r *recordingRegistry) RegisterActivity(a any) {
+	r.activities = append(r.activities, activityName(a))
+}
+
+func TestWorkerSpecs_RegisterWorkflowsPerQueue(t *testing.T) {
+	expected := map[string][]string{
+		OrderTaskQueue:    {"OrderWorkflow", "BatchOrderWorkflow"},
+		PaymentTaskQueue:  {"PaymentWorkflow", "PaymentWorkflowV2"},
+		SecurityTaskQueue: {"SecurityScanWorkflow", "ReportGenerationWorkflow", "CompareBranchesWorkflow", "CIGateWorkflow", "FleetSecurityScanWorkflow", "ScanCleanupWorkflow", "RemediationWorkflow"},
+		RefundTaskQueue:   {"RefundWorkflow"},
+	}
+	expected[SecurityPriorityTaskQueue] = expected[SecurityTaskQueue]
+
+	specs := workerSpecs(WorkerConfig{WorkerID: "worker-1"})
+	if len(specs) != len(expected) {
+		t.Fatalf("Expected %d workers, got %d", len(expected), len(specs))
+	}
+
+	for _, spec := range specs {
+		registry := &recordingRegistry{}
+		spec.register(registry, NewActivities(WorkerConfig{}))
+
+		if got := strings.Join(registry.workflows, ","); got != strings.Join(expected[spec.taskQueue], ",") {
+			t.Errorf("Expected %s to register %v, got %v", spec.taskQueue, expected[spec.taskQueue], registry.workflows)
+		}
+
+		// Shared activities are served on every queue, exactly once
+		count := 0
+		for _, name := range registry.activities {
+			if name == "EvaluateFeatureFlag" {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("Expected %s to register EvaluateFeatureFlag once, got %d", spec.taskQueue, count)
+		}
+
+		if spec.options.Identity != "worker-1" {
+			t.Errorf("Expected %s worker identity worker-1, got %s", spec.taskQueue, spec.options.Identity)
+		}
+	}
+}
+
+func TestDescribeOrderWorker(t *testing.T) {
+	description := DescribeOrderWorker()
+
+	if description.TaskQueue != OrderTaskQueue {
+		t.Errorf("Expected task queue %s, got %s", OrderTaskQueue, description.TaskQueue)
+	}
+
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !contains(description.Workflows, "OrderWorkflow") {
+		t.Errorf("Expected OrderWorkflow among %v", description.Workflows)
+	}
+
+	for _, name := range []string{"ValidateInventory", "GenerateShippingLabel", "RefundPayment"} {
+		if !contains(description.Activities, name) {
+			t.Errorf("Expected %s among %v", name, description.Activities)
+		}
+	}
+}
+
+func TestDescribePaymentWorker(t *testing.T) {
+	description := DescribePaymentWorker()
+
+	if description.TaskQueue != PaymentTaskQueue {
+		t.Errorf("Expected task queue %s, got %s", PaymentTaskQueue, description.TaskQueue)
+	}
+
+	// PaymentWorkflow voids cancelled charges on its own queue
+	for _, name := range []string{"ChargePaymentMethod", "RefundPayment", "VoidPayment"} {
+		found := false
+		for _, n := range description.Activities {
+			if n == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s among %v", name, description.Activities)
+		}
+	}
+}
+
+func TestDescribeAllWorkers_MatchesWorkerSpecs(t *testing.T) {
+	descriptions := DescribeAllWorkers()
+	specs := workerSpecs(WorkerConfig{})
+	if len(descriptions) != len(specs) {
+		t.Fatalf("Expected %d descriptions, got %d", len(specs), len(descriptions))
+	}
+
+	for i, spec := range specs {
+		registry := &recordingRegistry{}
+		spec.register(registry, NewActivities(WorkerConfig{}))
+
+		if descriptions[i].TaskQueue != spec.taskQueue {
+			t.Errorf("Expected description %d for %s, got %s", i, spec.taskQueue, descriptions[i].TaskQueue)
+		}
+		if !reflect.DeepEqual(descriptions[i].Workflows, registry.workflows) || !reflect.DeepEqual(descriptions[i].Activities, registry.activities) {
+			t.Errorf("Expected %s's description to match its registrations", spec.taskQueue)
+		}
+	}
+}
+
+func TestStartWorkers_RejectsBogusTLSCertificate(t *testing.T) {
+	config := WorkerConfig{
+		TemporalHost:      "localhost:7233",
+		TemporalNamespace: "default",
+		TLSCertPath:       "/nonexistent/client.pem",
+		TLSKeyPath:        "/nonexistent/client.key",
+	}
+
+	starts := map[string]func(context.Context, WorkerConfig) error{
+		"order":    StartOrderWorker,
+		"payment":  StartPaymentWorker,
+		"refund":   StartRefundWorker,
+		"security": StartSecurityWorker,
+	}
+	for name, start := range starts {
+		t.Run(name, func(t *testing.T) {
+			err := start(context.Background(), config)
+			if err == nil {
+				t.Fatal("Expected an error for a missing TLS certificate")
+			}
+			if !strings.Contains(err.Error(), "loading TLS client certificate /nonexistent/client.pem") {
+				t.Errorf("Expected the error to name the certificate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientOptions_TLS(t *testing.T) {
+	options, err := clientOptions(WorkerConfig{TemporalHost: "localhost:7233"})
+	if err != nil {
+		t.Fatalf("clientOptions failed: %v", err)
+	}
+	if options.ConnectionOptions.TLS != nil {
+		t.Error("Expected no TLS without TLS settings")
+	}
+
+	if _, err := clientOptions(WorkerConfig{TLSCertPath: "client.pem"}); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+
+	options, err = clientOptions(WorkerConfig{APIKey: "key", ServerName: "ns.tmprl.cloud"})
+	if err != nil {
+		t.Fatalf("clientOptions failed: %v", err)
+	}
+	if options.ConnectionOptions.TLS == nil || options.ConnectionOptions.TLS.ServerName != "ns.tmprl.cloud" {
+		t.Errorf("Expected TLS verifying ns.tmprl.cloud for an API key, got %+v", options.ConnectionOptions.TLS)
+	}
+	if options.Credentials == nil {
+		t.Error("Expected API key credentials")
+	}
+}
+
+func TestStartAllWorkers_ServesMetrics(t *testing.T) {
+	// Taking the port first shows the workers try to serve metrics on it
+	// before dialing Temporal
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listening failed: %v", err)
+	}
+	defer taken.Close()
+
+	config := WorkerConfig{
+		TemporalHost:      "localhost:7233",
+		TemporalNamespace: "default",
+		Namespaces:        []string{"tenant-a", "tenant-b"},
+		MetricsListenAddr: taken.Addr().String(),
+	}
+
+	if _, _, err := StartAllWorkers(config); err == nil || !strings.Contains(err.Error(), "listening for metrics") {
+		t.Errorf("Expected StartAllWorkers to serve metrics, got %v", err)
+	}
+	if _, _, err := StartNamespaceWorkers(config); err == nil || !strings.Contains(err.Error(), "listening for metrics") {
+		t.Errorf("Expected StartNamespaceWorkers to serve metrics, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package workflows
+
+import "go.temporal.io/sdk/temporal"
+
+// Application error types PaymentWorkflowV2 fails with, and OrderWorkflow
+// reports in OrderFailure.ErrorType. Callers tell failures apart with
+// errors.As and ApplicationError.Type, or the ErrorType, e.g. to retry a
+// ShippingError but not a PaymentGatewayError.
+const (
+	OrderStateError        = "OrderStateError" // The order's checkpoint or status couldn't be loaded
+	InventoryError         = "InventoryError"
+	PaymentGatewayError    = "PaymentGatewayError"
+	PaymentValidationError = "PaymentValidationError" // The amount, balance or spending limit couldn't be checked, or the amount converted
+	FraudRecordError       = "FraudRecordError"       // The fraud decision's compliance record couldn't be written
+	ShippingError          = "ShippingError"
+)
+
+// workflowError wraps err as an ApplicationError of errType, keeping err as
+// the cause. Cancellation is returned as is so the workflow still ends
+// cancelled rather than failed.
+func workflowError(errType, message string, err error) error {
+	if temporal.IsCanceledError(err) {
+		return err
+	}
+	return temporal.NewApplicationErrorWithCause(message, errType, err)
+}